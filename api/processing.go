@@ -0,0 +1,368 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/shared-spotify/app"
+	"github.com/shared-spotify/datadog"
+	"github.com/shared-spotify/httputils"
+	"github.com/shared-spotify/logger"
+	"github.com/shared-spotify/mongoclient"
+	mongoclientapp "github.com/shared-spotify/mongoclient/app"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"net/http"
+	"time"
+)
+
+// The processing of rooms is done by the workers, the api only adds the rooms to process to the job queue
+
+const ProcessRoomJobType = "process_room"
+
+var processingAttemptFailedError = errors.New("Processing of room failed, it will be retried")
+
+func enqueueRoomProcessing(room *app.Room, ctx context.Context) error {
+	return mongoclient.EnqueueJob(ProcessRoomJobType, room.Id, ctx)
+}
+
+// Processes the room of the job, returning an error will make the job be retried until it has no attempts left
+func ProcessRoom(job *mongoclient.Job, ctx context.Context) error {
+	roomId := job.Payload
+
+	span, ctx := tracer.StartSpanFromContext(ctx, "room.process")
+	defer span.Finish()
+	span.SetTag("room_id", roomId)
+
+	room, err := mongoclientapp.GetUnprocessedRoom(roomId, ctx)
+
+	if err == mongoclientapp.NotFound {
+		logger.WithRoom(roomId).Warningf("Room to process no longer exists or was already processed %v", span)
+		return nil
+	}
+
+	if err != nil {
+		span.Finish(tracer.WithError(err))
+		return err
+	}
+
+	// the processing was reset, cancelled or is already over, so there is nothing left to do for this job
+	if room.MusicLibrary == nil || room.MusicLibrary.HasProcessingFinished() ||
+		room.MusicLibrary.HasProcessingBeenCancelled() {
+		logger.WithRoom(roomId).Warningf("Room has no processing waiting, skipping job %v", span)
+		return nil
+	}
+
+	// we re-create all the clients for the room
+	err = room.RecreateClients(ctx)
+
+	if err != nil {
+		span.Finish(tracer.WithError(err))
+		logger.WithRoom(roomId).Errorf("Failed to recreate clients when processing room %v %v", err, span)
+		return failProcessingOnLastAttempt(room, job, err, ctx)
+	}
+
+	// we always start from scratch, as a previous attempt might have been interrupted
+	room.MusicLibrary = room.MusicLibrary.Restart(len(room.Users))
+
+	logger.Logger.Infof("Starting processing of room %s for users %s - attempt %d/%d %v", roomId,
+		room.GetUserIds(), job.Attempts, job.MaxAttempts, span)
+
+	app.PublishProcessingStarted(roomId)
+
+	ctxWithTimeout, cancel := context.WithTimeout(ctx, app.TimeoutRoomProcessing)
+	defer cancel()
+
+	// add the cancel function for the room in case we need to stop processing
+	app.AddCancel(roomId, cancel)
+	defer app.RemoveCancel(roomId)
+
+	processingOver := make(chan bool, 1)
+	cancelledByOwner := false
+
+	err = room.MusicLibrary.Process(room, func(success bool, ctx context.Context) {
+		processingOver <- success
+
+	}, func(ctx context.Context) error {
+		// we update the last time checkpoint
+		room.MusicLibrary.ProcessingStatus.CheckpointTime = time.Now()
+
+		err := mongoclientapp.UpdateUnprocessedRoomIfNotCancelled(room, ctx)
+
+		// the owner cancelled the processing from another process, we stop without waiting for the heartbeat
+		if err == mongoclientapp.ProcessingCancelled {
+			cancelledByOwner = true
+			cancel()
+		}
+
+		return err
+	}, ctxWithTimeout)
+
+	if err != nil {
+		span.Finish(tracer.WithError(err))
+		logger.WithRoom(roomId).Errorf("Failed to launch processing %v %v", err, span)
+		return failProcessingOnLastAttempt(room, job, err, ctx)
+	}
+
+	success := <-processingOver
+
+	// the owner cancelled the processing, the room was already unlocked and marked as cancelled by the request
+	if job.CancelRequested || cancelledByOwner || (ctxWithTimeout.Err() == context.Canceled && ctx.Err() == nil) {
+		logger.WithRoom(roomId).Warningf("Processing of room was cancelled %v", span)
+		job.CancelRequested = true
+		return nil
+	}
+
+	// the worker is stopping, the job will be picked up again so we leave the room as it is
+	if ctx.Err() != nil {
+		logger.WithRoom(roomId).Warningf("Processing of room was interrupted %v", span)
+		return ctx.Err()
+	}
+
+	if !success && !job.IsLastAttempt() {
+		span.Finish(tracer.WithError(processingAttemptFailedError))
+		return processingAttemptFailedError
+	}
+
+	updateRoomNotProcessed(room, success, ctx)
+
+	if !room.MusicLibrary.HasProcessingSucceeded() {
+		span.Finish(tracer.WithError(processingFailedError))
+		return processingFailedError
+	}
+
+	return nil
+}
+
+// The job died without failing, as its lease expired on its last attempt, so the room is still shown as processing
+func ProcessRoomDead(job *mongoclient.Job, ctx context.Context) {
+	roomId := job.Payload
+
+	room, err := mongoclientapp.GetUnprocessedRoom(roomId, ctx)
+
+	if err != nil {
+		logger.WithRoom(roomId).Errorf("Failed to get room of dead processing job %v", err)
+		return
+	}
+
+	if room.MusicLibrary == nil || room.MusicLibrary.HasProcessingFinished() ||
+		room.MusicLibrary.HasProcessingBeenCancelled() {
+		return
+	}
+
+	logger.WithRoom(roomId).Warning("Processing job of room is dead, marking processing as failed")
+
+	updateRoomNotProcessed(room, false, ctx)
+}
+
+// Once all the attempts have failed, we mark the processing of the room as failed so users can launch it again
+func failProcessingOnLastAttempt(room *app.Room, job *mongoclient.Job, err error, ctx context.Context) error {
+	if job.IsLastAttempt() && room.MusicLibrary != nil {
+		updateRoomNotProcessed(room, false, ctx)
+	}
+
+	return err
+}
+
+/*
+  Room processing handler
+*/
+
+func RoomProcessingHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+
+	case http.MethodDelete:
+		CancelRoomProcessing(w, r)
+	default:
+		http.Error(w, "", http.StatusMethodNotAllowed)
+	}
+}
+
+// Stops the processing of the room, the room is unlocked so new members can join before the processing is launched
+// again
+func CancelRoomProcessing(w http.ResponseWriter, r *http.Request) {
+	span, ctx := tracer.StartSpanFromContext(r.Context(), "room.processing.cancel")
+	defer span.Finish()
+
+	vars := mux.Vars(r)
+	roomId := vars["roomId"]
+
+	room, user, err := getRoomAndCheckUserWithCtx(roomId, r, ctx)
+
+	if err != nil {
+		span.Finish(tracer.WithError(err))
+		handleError(err, w, r, user)
+		return
+	}
+
+	logger.WithUser(user.GetUserId()).Infof("User %s requested to cancel processing of room %s %v",
+		user.GetUserId(), roomId, span)
+
+	if !room.IsOwner(user) {
+		span.Finish(tracer.WithError(roomNotOwnerError))
+		handleError(roomNotOwnerError, w, r, user)
+		return
+	}
+
+	musicLibrary := room.MusicLibrary
+
+	if musicLibrary == nil || musicLibrary.HasProcessingFinished() || musicLibrary.HasProcessingBeenCancelled() {
+		span.Finish(tracer.WithError(processingNotInProgressError))
+		handleError(processingNotInProgressError, w, r, user)
+		return
+	}
+
+	// we first save the room as cancelled, so the processing cannot overwrite it while it is stopping
+	musicLibrary.SetProcessingCancelled()
+	*room.Locked = false
+
+	err = updateRoomWithCtx(room, ctx)
+
+	if err != nil {
+		span.Finish(tracer.WithError(err))
+		handleError(failedToCancelProcessingError, w, r, user)
+		return
+	}
+
+	// the job is either waiting in the queue or running in a worker, possibly in another process
+	err = mongoclient.RequestJobCancel(ProcessRoomJobType, roomId, ctx)
+
+	if err != nil {
+		span.Finish(tracer.WithError(err))
+		logger.WithUser(user.GetUserId()).Errorf("Failed to request cancel of processing job for room %s %v %v",
+			roomId, err, span)
+	}
+
+	// if the room is processed in this process, we stop it straight away
+	app.Cancel(roomId)
+
+	app.PublishProcessingCancelled(roomId)
+
+	datadog.Increment(1, datadog.RoomProcessingCancelled,
+		datadog.UserIdTag.Tag(user.GetId()),
+		datadog.RoomIdTag.Tag(roomId),
+		datadog.RoomNameTag.Tag(room.Name),
+	)
+
+	httputils.SendOk(w)
+}
+
+/*
+  Room processing retry handler
+*/
+
+func RoomProcessingRetryHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+
+	case http.MethodPost:
+		RetryExcludedUser(w, r)
+	default:
+		http.Error(w, "", http.StatusMethodNotAllowed)
+	}
+}
+
+// A user excluded from the processing of a room can retry to fetch its songs, the room is then processed again with
+// the library snapshots of the users already in the result, so the playlists are updated with the songs of the user
+func RetryExcludedUser(w http.ResponseWriter, r *http.Request) {
+	span, ctx := tracer.StartSpanFromContext(r.Context(), "room.processing.retry")
+	defer span.Finish()
+
+	vars := mux.Vars(r)
+	roomId := vars["roomId"]
+
+	room, user, err := getRoomAndCheckUserWithCtx(roomId, r, ctx)
+
+	if err != nil {
+		span.Finish(tracer.WithError(err))
+		handleError(err, w, r, user)
+		return
+	}
+
+	logger.WithUser(user.GetUserId()).Infof("User %s requested to retry processing of room %s %v",
+		user.GetUserId(), roomId, span)
+
+	if room.IsProcessingInProgress() {
+		span.Finish(tracer.WithError(processingInProgressError))
+		handleError(processingInProgressError, w, r, user)
+		return
+	}
+
+	if !room.HasRoomBeenProcessedSuccessfully() {
+		span.Finish(tracer.WithError(processingNotSucceededError))
+		handleError(processingNotSucceededError, w, r, user)
+		return
+	}
+
+	if !room.MusicLibrary.IsUserExcluded(user) {
+		span.Finish(tracer.WithError(userNotExcludedError))
+		handleError(userNotExcludedError, w, r, user)
+		return
+	}
+
+	// a job left by a cancelled processing might still be stopping, the room is only changed once it is over
+	job, err := mongoclient.GetJob(ProcessRoomJobType, roomId, ctx)
+
+	if err != nil {
+		span.Finish(tracer.WithError(err))
+		handleError(processingLaunchError, w, r, user)
+		return
+	}
+
+	if job != nil && job.IsQueued() {
+		span.Finish(tracer.WithError(processingAlreadyQueuedError))
+		handleError(processingAlreadyQueuedError, w, r, user)
+		return
+	}
+
+	previousMusicLibrary := room.MusicLibrary
+	previousLocked := *room.Locked
+
+	// the user from the request has a valid token, so its songs can be fetched
+	room.ReplaceUser(user)
+	*room.Locked = true
+	room.MusicLibrary = room.MusicLibrary.CreateIncrementalLibrary(room.Users, user)
+
+	// the processed room is kept until the new result replaces it, so the room is processed as an unprocessed one
+	err = updateRoomWithCtx(room, ctx)
+
+	if err != nil {
+		span.Finish(tracer.WithError(err))
+		handleError(processingLaunchError, w, r, user)
+		return
+	}
+
+	err = enqueueRoomProcessing(room, ctx)
+
+	// the job queued in the meantime processes the room as it is now
+	if err == mongoclient.ErrJobAlreadyQueued {
+		span.Finish(tracer.WithError(processingAlreadyQueuedError))
+		handleError(processingAlreadyQueuedError, w, r, user)
+		return
+	}
+
+	if err != nil {
+		span.Finish(tracer.WithError(err))
+		logger.WithUser(user.GetUserId()).Errorf("Failed to queue processing retry %s %v %v", roomId, err, span)
+
+		// nothing will process the room, so we go back to the processed room, which stays open if it was
+		if previousLocked {
+			_ = deleteRoomNotProcessed(room, ctx)
+		} else {
+			*room.Locked = previousLocked
+			room.MusicLibrary = previousMusicLibrary
+			_ = updateRoomWithCtx(room, ctx)
+		}
+
+		handleError(processingLaunchError, w, r, user)
+		return
+	}
+
+	logger.Logger.Infof("Queued processing retry of room %s for user %s %v", roomId, user.GetUserId(), span)
+
+	datadog.Increment(1, datadog.RoomProcessingRetried,
+		datadog.UserIdTag.Tag(user.GetId()),
+		datadog.RoomIdTag.Tag(roomId),
+		datadog.RoomNameTag.Tag(room.Name),
+	)
+
+	httputils.SendOk(w)
+}
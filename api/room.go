@@ -20,6 +20,8 @@ import (
 const defaultRoomName = "Room #%s"
 
 var failedToGetRoom = errors.New("Failed to get room")
+var roomTracksNotConvertedError = errors.New("Room was processed with tracks that can no longer be read, " +
+	"it needs to be processed again")
 var failedToDeleteRoom = errors.New("Failed to delete room")
 var failedToGetRooms = errors.New("Failed to get rooms")
 var roomDoesNotExistError = errors.New("Room does not exists")
@@ -27,14 +29,25 @@ var roomIsNotAccessibleError = errors.New("Room is not accessible to user")
 var failedToCreateRoom = errors.New("Failed to create room")
 var failedToAddUserToRoom = errors.New("Failed to add user to room")
 var authenticationError = errors.New("Failed to authenticate user")
-var roomLockedError = errors.New("Room is locked and not accepting new members. Create a new one to share music")
+var roomLockedError = errors.New("Room is locked and not accepting new members. Ask the owner to unlock it or " +
+	"create a new one to share music")
 var processingLaunchError = errors.New("Failed to launch processing")
 var processingInProgressError = errors.New("Processing of music is already in progress")
+var processingAlreadyQueuedError = errors.New("Processing of the room is already queued")
 var processingNotStartedError = errors.New("Processing of music has not been done, cannot get playlists")
 var processingFailedError = errors.New("Processing of music failed, cannot get playlists")
 var roomExpiredError = errors.New("Room has expired because some users are no longer connected to their music " +
 	"provider, create a new room to retry")
 var failedToCreatePlaylistError = errors.New("An error occurred while creating the playlist")
+var roomNotOwnerError = errors.New("Only the owner of the room can do this action")
+var processingNotInProgressError = errors.New("Processing of music is not in progress")
+var processingCancelledError = errors.New("Processing of music was cancelled, launch it again to get playlists")
+var failedToCancelProcessingError = errors.New("Failed to cancel processing")
+var processingNotSucceededError = errors.New("Processing of music has not succeeded, launch it again instead")
+var userNotExcludedError = errors.New("User was not excluded from the processing of the room")
+var failedToUnlockRoom = errors.New("Failed to unlock room")
+var invalidTopCountError = errors.New("Invalid top count, it cannot be negative")
+var compatibilityNotComputedError = errors.New("Compatibility was not computed for this room, process it again to get it")
 
 func addRoomNotProcessed(room *app.Room) error {
 	datadog.Increment(1, datadog.RoomCount,
@@ -53,6 +66,11 @@ func updateRoomNotProcessed(room *app.Room, success bool, ctx context.Context) {
 	// we set processing result
 	room.MusicLibrary.SetProcessingSuccess(&success)
 
+	// the result can still change to a failure if we fail to save it, so we send it once saved
+	defer func() {
+		app.PublishProcessingFinished(room.Id, room.MusicLibrary.HasProcessingSucceeded())
+	}()
+
 	// send time taken to process the room
 	datadog.Distribution(room.MusicLibrary.GetProcessingTime(), datadog.RoomProcessedTime,
 		datadog.RoomIdTag.Tag(room.Id),
@@ -145,6 +163,23 @@ func getRoom(roomId string, ctx context.Context) (*app.Room, error) {
 	unprocessedRoom, unprocessedRoomErr := mongoclientapp.GetUnprocessedRoom(roomId, ctx)
 	room, roomErr := mongoclientapp.GetRoom(roomId, ctx)
 
+	// the room is reported as failed rather than shown with blank tracks
+	if roomErr == mongoclientapp.TracksNotConverted {
+		span.Finish(tracer.WithError(roomErr))
+		logger.WithRoom(roomId).WithError(roomErr).Errorf("Failed to convert the tracks of room %v", span)
+		return nil, roomTracksNotConvertedError
+	}
+
+	// a processed room can be opened to new members and processed again, the result is kept until it is replaced
+	if unprocessedRoom != nil && room != nil && !isUnprocessedRoomStale(unprocessedRoom) {
+		if unprocessedRoom.HasRoomBeenProcessedSuccessfully() {
+			unprocessedRoom.SetPlaylists(room.GetPlaylists())
+			unprocessedRoom.SetCompatibility(room.GetCompatibility())
+		}
+
+		return unprocessedRoom, nil
+	}
+
 	// we make a check to see if do not have the same room unprocessed and processed
 	if unprocessedRoom != nil && room != nil {
 		logger.WithRoom(roomId).Warningf("Found unprocessed room with processed room, deleting unprocessed one %v", span)
@@ -188,6 +223,11 @@ func getRoom(roomId string, ctx context.Context) (*app.Room, error) {
 	return nil, failedToGetRoom
 }
 
+// an unprocessed room with a successful result that is still locked is one we failed to delete once processed
+func isUnprocessedRoomStale(unprocessedRoom *app.Room) bool {
+	return unprocessedRoom.HasRoomBeenProcessedSuccessfully() && *unprocessedRoom.Locked
+}
+
 func getRoomAndCheckUser(roomId string, r *http.Request) (*app.Room, *clientcommon.User, error) {
 	return getRoomAndCheckUserWithCtx(roomId, r, r.Context())
 }
@@ -236,16 +276,30 @@ func handleError(err error, w http.ResponseWriter, r *http.Request, user *client
 	} else if err == roomIsNotAccessibleError {
 		http.Error(w, err.Error(), http.StatusUnauthorized)
 
+	} else if err == roomNotOwnerError {
+		http.Error(w, err.Error(), http.StatusForbidden)
+
 	} else if err == authenticationError {
 		httputils.AuthenticationError(w, r)
 
 	} else if err == roomLockedError {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 
+	} else if err == processingAlreadyQueuedError {
+		http.Error(w, err.Error(), http.StatusConflict)
+
 	} else if err == app.ErrorPlaylistTypeNotFound {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 
-	} else if err == processingInProgressError || err == processingFailedError || err == processingNotStartedError {
+	} else if err == processingInProgressError || err == processingFailedError || err == processingNotStartedError ||
+		err == processingNotInProgressError || err == processingCancelledError || err == processingNotSucceededError ||
+		err == userNotExcludedError || err == app.ErrorInvalidProcessingPolicy || err == app.ErrorUnknownPlaylistGenerator ||
+		err == app.ErrorInvalidAudioFeatureThresholds || err == app.ErrorInvalidOverlapThresholds ||
+		err == app.ErrorInvalidPlaylistThresholds || err == app.ErrorInvalidMinSharedUsers ||
+		err == app.ErrorUnknownLibrarySource || err == app.ErrorInvalidSourceWeights ||
+		err == compatibilityNotComputedError || err == invalidTopCountError || err == app.ErrorUnknownPlaylistOrder ||
+		err == app.ErrorUnknownEnergyCurve || err == app.ErrorInvalidDurationOptions || err == app.ErrorDurationTooShort ||
+		err == app.ErrorReusedLibraryOptionsChanged {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 
 	} else {
@@ -298,11 +352,32 @@ func GetRooms(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rooms = append(rooms, unprocessedRooms...)
+	rooms = mergeRooms(rooms, unprocessedRooms)
 
 	httputils.SendJsonWithCtx(w, &rooms, ctx)
 }
 
+// a processed room opened again is also an unprocessed room, we only keep the one returned by getRoom
+func mergeRooms(rooms []*app.Room, unprocessedRooms []*app.Room) []*app.Room {
+	unprocessedRoomIds := make(map[string]bool)
+	mergedRooms := make([]*app.Room, 0)
+
+	for _, unprocessedRoom := range unprocessedRooms {
+		if !isUnprocessedRoomStale(unprocessedRoom) {
+			unprocessedRoomIds[unprocessedRoom.Id] = true
+			mergedRooms = append(mergedRooms, unprocessedRoom)
+		}
+	}
+
+	for _, room := range rooms {
+		if !unprocessedRoomIds[room.Id] {
+			mergedRooms = append(mergedRooms, room)
+		}
+	}
+
+	return mergedRooms
+}
+
 type CreatedRoom struct {
 	RoomId string `json:"room_id"`
 }
@@ -421,6 +496,12 @@ func DeleteRoom(w http.ResponseWriter, r *http.Request) {
 	if room.HasRoomBeenProcessed() {
 		err = mongoclientapp.DeleteRoomForUser(room, user)
 
+		// a processed room opened to new members is also an unprocessed room, the user leaves both
+		if err == nil && !*room.Locked {
+			room.RemoveUser(user)
+			err = updateRoom(room)
+		}
+
 	} else {
 		// TODO: not ideal, if room is not processed and deleted, it is deleted for ALL users
 		err = deleteRoomNotProcessed(room, nil)
@@ -495,5 +576,77 @@ func AddRoomUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	app.PublishMemberJoined(roomId, user)
+
+	httputils.SendOk(w)
+}
+
+/*
+  Room lock handler
+*/
+
+func RoomLockHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+
+	case http.MethodDelete:
+		UnlockRoom(w, r)
+	default:
+		http.Error(w, "", http.StatusMethodNotAllowed)
+	}
+}
+
+// Opens the room to new members, a processed room can then be processed again to add the songs of the new members,
+// its playlists stay available until then
+func UnlockRoom(w http.ResponseWriter, r *http.Request) {
+	span, ctx := tracer.StartSpanFromContext(r.Context(), "room.unlock")
+	defer span.Finish()
+
+	vars := mux.Vars(r)
+	roomId := vars["roomId"]
+
+	room, user, err := getRoomAndCheckUserWithCtx(roomId, r, ctx)
+
+	if err != nil {
+		span.Finish(tracer.WithError(err))
+		handleError(err, w, r, user)
+		return
+	}
+
+	logger.WithUser(user.GetUserId()).Infof("User %s requested to unlock room %s %v", user.GetUserId(), roomId, span)
+
+	if !room.IsOwner(user) {
+		span.Finish(tracer.WithError(roomNotOwnerError))
+		handleError(roomNotOwnerError, w, r, user)
+		return
+	}
+
+	if room.IsProcessingInProgress() {
+		span.Finish(tracer.WithError(processingInProgressError))
+		handleError(processingInProgressError, w, r, user)
+		return
+	}
+
+	if !*room.Locked {
+		httputils.SendOk(w)
+		return
+	}
+
+	*room.Locked = false
+
+	// a processed room is saved as an unprocessed room, which is the one used until it is processed again
+	err = updateRoomWithCtx(room, ctx)
+
+	if err != nil {
+		span.Finish(tracer.WithError(err))
+		handleError(failedToUnlockRoom, w, r, user)
+		return
+	}
+
+	datadog.Increment(1, datadog.RoomUnlocked,
+		datadog.UserIdTag.Tag(user.GetId()),
+		datadog.RoomIdTag.Tag(roomId),
+		datadog.RoomNameTag.Tag(room.Name),
+	)
+
 	httputils.SendOk(w)
 }
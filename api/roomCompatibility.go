@@ -0,0 +1,76 @@
+package api
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/shared-spotify/datadog"
+	"github.com/shared-spotify/httputils"
+	"github.com/shared-spotify/logger"
+	"net/http"
+)
+
+/*
+  Room compatibility handler
+*/
+
+func RoomCompatibilityHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+
+	case http.MethodGet:
+		GetCompatibilityForRoom(w, r)
+	default:
+		http.Error(w, "", http.StatusMethodNotAllowed)
+	}
+}
+
+func GetCompatibilityForRoom(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	roomId := vars["roomId"]
+
+	room, user, err := getRoomAndCheckUser(roomId, r)
+
+	if err != nil {
+		handleError(err, w, r, user)
+		return
+	}
+
+	logger.WithUser(user.GetUserId()).Infof("User %s requested compatibility for room %s", user.GetUserId(), roomId)
+
+	musicLibrary := room.MusicLibrary
+
+	if musicLibrary == nil {
+		handleError(processingNotStartedError, w, r, user)
+		return
+	}
+
+	if musicLibrary.HasProcessingBeenCancelled() {
+		handleError(processingCancelledError, w, r, user)
+		return
+	}
+
+	// check the processing is over and it did not fail
+	if !musicLibrary.HasProcessingFinished() {
+		handleError(processingInProgressError, w, r, user)
+		return
+	}
+
+	if musicLibrary.HasProcessingFailed() {
+		handleError(processingFailedError, w, r, user)
+		return
+	}
+
+	compatibility := room.GetCompatibility()
+
+	// rooms processed before the compatibility existed do not have it
+	if compatibility == nil {
+		handleError(compatibilityNotComputedError, w, r, user)
+		return
+	}
+
+	datadog.Increment(1, datadog.RoomCompatibilityRequest,
+		datadog.UserIdTag.Tag(user.GetId()),
+		datadog.RoomIdTag.Tag(roomId),
+		datadog.RoomNameTag.Tag(room.Name),
+	)
+
+	httputils.SendJson(w, compatibility)
+}
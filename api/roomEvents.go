@@ -0,0 +1,149 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/shared-spotify/app"
+	"github.com/shared-spotify/logger"
+	mongoclientapp "github.com/shared-spotify/mongoclient/app"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// The events of a room are sent with server sent events, the browser reconnects by itself when the stream is closed
+// and sends the Last-Event-ID header, so we continue from the last event received
+// A new stream only gets the events from now on, the state of the room before it is given by the room itself
+
+const roomEventsPollInterval = 1 * time.Second
+const roomEventsKeepAliveInterval = 15 * time.Second
+
+// the stream is closed before the write timeout of the server, the browser then reconnects
+const roomEventsStreamDuration = 4 * time.Minute
+
+const lastEventIdHeader = "Last-Event-ID"
+
+var streamingNotSupportedError = errors.New("Streaming is not supported")
+
+/*
+  Room events handler
+*/
+
+func RoomEventsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+
+	case http.MethodGet:
+		StreamRoomEvents(w, r)
+	default:
+		http.Error(w, "", http.StatusMethodNotAllowed)
+	}
+}
+
+func StreamRoomEvents(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	roomId := vars["roomId"]
+
+	_, user, err := getRoomAndCheckUser(roomId, r)
+
+	if err != nil {
+		handleError(err, w, r, user)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+
+	if !ok {
+		handleError(streamingNotSupportedError, w, r, user)
+		return
+	}
+
+	lastSequence, err := getLastEventSequence(roomId, r)
+
+	if err != nil {
+		handleError(err, w, r, user)
+		return
+	}
+
+	logger.WithUserAndRoom(user.GetUserId(), roomId).Infof("User started to stream room events after %d",
+		lastSequence)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ctx := r.Context()
+	pollTicker := time.NewTicker(roomEventsPollInterval)
+	defer pollTicker.Stop()
+	keepAliveTicker := time.NewTicker(roomEventsKeepAliveInterval)
+	defer keepAliveTicker.Stop()
+	streamOver := time.After(roomEventsStreamDuration)
+
+	for {
+		events, err := mongoclientapp.GetRoomEventsAfter(roomId, lastSequence, ctx)
+
+		if err != nil {
+			// the browser will reconnect and continue from the last event it received
+			return
+		}
+
+		for _, event := range events {
+			err = writeRoomEvent(w, event)
+
+			if err != nil {
+				logger.WithUserAndRoom(user.GetUserId(), roomId).Warningf("Failed to send room event %v", err)
+				return
+			}
+
+			lastSequence = event.Sequence
+		}
+
+		if len(events) > 0 {
+			flusher.Flush()
+		}
+
+		select {
+		case <-ctx.Done():
+			logger.WithUserAndRoom(user.GetUserId(), roomId).Info("User stopped streaming room events")
+			return
+		case <-streamOver:
+			return
+		case <-keepAliveTicker.C:
+			// comments are ignored by the browser, they only keep the connection open through proxies
+			_, err = fmt.Fprint(w, ": keep-alive\n\n")
+
+			if err != nil {
+				return
+			}
+
+			flusher.Flush()
+		case <-pollTicker.C:
+		}
+	}
+}
+
+func getLastEventSequence(roomId string, r *http.Request) (int64, error) {
+	sequence, err := strconv.ParseInt(r.Header.Get(lastEventIdHeader), 10, 64)
+
+	if err == nil {
+		return sequence, nil
+	}
+
+	// the whole history of the room is not replayed
+	return mongoclientapp.GetRoomEventSequence(roomId, r.Context())
+}
+
+func writeRoomEvent(w http.ResponseWriter, event *app.RoomEvent) error {
+	data, err := json.Marshal(event)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Sequence, event.Type, data)
+
+	return err
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/shared-spotify/app"
+	"github.com/shared-spotify/datadog"
+	"github.com/shared-spotify/httputils"
+	"github.com/shared-spotify/logger"
+	"github.com/shared-spotify/musicclient"
+	"github.com/shared-spotify/musicclient/clientcommon"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"net/http"
+)
+
+var failedToGetLibraryPlaylistsError = errors.New("Failed to get the playlists of the user")
+var failedToUpdatePlaylistSelectionError = errors.New("Failed to update the playlists chosen by the user")
+
+type RoomLibraryPlaylist struct {
+	*clientcommon.LibraryPlaylist
+	Included bool `json:"included"`
+}
+
+/*
+  Room library playlists handler
+*/
+
+func RoomLibraryPlaylistsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+
+	case http.MethodGet:
+		GetLibraryPlaylistsForRoom(w, r)
+	case http.MethodPut:
+		UpdatePlaylistSelectionForRoom(w, r)
+	default:
+		http.Error(w, "", http.StatusMethodNotAllowed)
+	}
+}
+
+// Returns the playlists of the user, and if they are included in the songs of the user for the room
+func GetLibraryPlaylistsForRoom(w http.ResponseWriter, r *http.Request) {
+	span, ctx := tracer.StartSpanFromContext(r.Context(), "room.library.playlists.get")
+	defer span.Finish()
+
+	vars := mux.Vars(r)
+	roomId := vars["roomId"]
+
+	room, user, err := getRoomAndCheckUserWithCtx(roomId, r, ctx)
+
+	if err != nil {
+		span.Finish(tracer.WithError(err))
+		handleError(err, w, r, user)
+		return
+	}
+
+	logger.WithUserAndRoom(user.GetUserId(), roomId).Infof("User requested library playlists for room %v", span)
+
+	playlists, err := musicclient.GetPlaylists(user)
+
+	if err != nil {
+		span.Finish(tracer.WithError(err))
+		handleError(failedToGetLibraryPlaylistsError, w, r, user)
+		return
+	}
+
+	libraryOptions := clientcommon.CreateLibraryOptions(room.ProcessingOptions.GetLibrarySources(),
+		room.GetPlaylistSelection(user))
+
+	roomPlaylists := make([]*RoomLibraryPlaylist, 0)
+
+	for _, playlist := range playlists {
+		roomPlaylists = append(roomPlaylists, &RoomLibraryPlaylist{playlist, libraryOptions.IncludesPlaylist(playlist)})
+	}
+
+	datadog.Increment(1, datadog.RoomLibraryPlaylistsRequest,
+		datadog.UserIdTag.Tag(user.GetId()),
+		datadog.RoomIdTag.Tag(roomId),
+		datadog.RoomNameTag.Tag(room.Name),
+	)
+
+	httputils.SendJson(w, roomPlaylists)
+}
+
+// Saves the playlists the user chose to include or exclude, they are used the next time the room is processed
+func UpdatePlaylistSelectionForRoom(w http.ResponseWriter, r *http.Request) {
+	span, ctx := tracer.StartSpanFromContext(r.Context(), "room.library.playlists.update")
+	defer span.Finish()
+
+	vars := mux.Vars(r)
+	roomId := vars["roomId"]
+
+	room, user, err := getRoomAndCheckUserWithCtx(roomId, r, ctx)
+
+	if err != nil {
+		span.Finish(tracer.WithError(err))
+		handleError(err, w, r, user)
+		return
+	}
+
+	logger.WithUserAndRoom(user.GetUserId(), roomId).Infof("User requested to update playlist selection %v", span)
+
+	var selection clientcommon.PlaylistSelection
+	err = httputils.DeserialiseBody(r, &selection)
+
+	if err != nil {
+		span.Finish(tracer.WithError(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if room.IsProcessingInProgress() {
+		span.Finish(tracer.WithError(processingInProgressError))
+		handleError(processingInProgressError, w, r, user)
+		return
+	}
+
+	// the songs of a processed room cannot change until it is unlocked to be processed again
+	if room.HasRoomBeenProcessedSuccessfully() && *room.Locked {
+		span.Finish(tracer.WithError(roomLockedError))
+		handleError(roomLockedError, w, r, user)
+		return
+	}
+
+	if room.IsUserLibraryReused(user) {
+		span.Finish(tracer.WithError(app.ErrorReusedLibraryOptionsChanged))
+		handleError(app.ErrorReusedLibraryOptionsChanged, w, r, user)
+		return
+	}
+
+	room.SetPlaylistSelection(user, &selection)
+
+	err = updateRoomWithCtx(room, ctx)
+
+	if err != nil {
+		span.Finish(tracer.WithError(err))
+		handleError(failedToUpdatePlaylistSelectionError, w, r, user)
+		return
+	}
+
+	datadog.Increment(1, datadog.RoomPlaylistSelectionUpdate,
+		datadog.UserIdTag.Tag(user.GetId()),
+		datadog.RoomIdTag.Tag(roomId),
+		datadog.RoomNameTag.Tag(room.Name),
+	)
+
+	httputils.SendOk(w)
+}
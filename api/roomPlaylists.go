@@ -1,20 +1,17 @@
 package api
 
 import (
-	"context"
 	"fmt"
 	"github.com/gorilla/mux"
 	"github.com/shared-spotify/app"
 	"github.com/shared-spotify/datadog"
 	"github.com/shared-spotify/httputils"
 	"github.com/shared-spotify/logger"
+	"github.com/shared-spotify/mongoclient"
 	"github.com/shared-spotify/musicclient"
 	"github.com/shared-spotify/musicclient/clientcommon"
-	"github.com/thoas/go-funk"
-	"github.com/zmb3/spotify"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 	"net/http"
-	"time"
 )
 
 // perform all shutdown operations here
@@ -59,6 +56,11 @@ func GetPlaylistsForRoom(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if musicLibrary.HasProcessingBeenCancelled() {
+		handleError(processingCancelledError, w, r, user)
+		return
+	}
+
 	// check the processing is over and it did not fail
 	if !musicLibrary.HasProcessingFinished() {
 		handleError(processingInProgressError, w, r, user)
@@ -80,6 +82,11 @@ func GetPlaylistsForRoom(w http.ResponseWriter, r *http.Request) {
 	httputils.SendJson(w, playlists)
 }
 
+type FindPlaylistsRequestBody struct {
+	ProcessingPolicy  *app.ProcessingPolicy  `json:"processing_policy"`
+	ProcessingOptions *app.ProcessingOptions `json:"processing_options"`
+}
+
 // Here, we launch the process of finding the musics for the users in the room
 func FindPlaylistsForRoom(w http.ResponseWriter, r *http.Request) {
 	span, ctx := tracer.StartSpanFromContext(r.Context(), "playlist.find.for.room")
@@ -108,30 +115,86 @@ func FindPlaylistsForRoom(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// we re-create all the clients for the room
-	err = room.RecreateClients(ctx)
+	var findPlaylistsRequestBody FindPlaylistsRequestBody
+	err = httputils.DeserialiseOptionalBody(r, &findPlaylistsRequestBody)
 
 	if err != nil {
 		span.Finish(tracer.WithError(err))
-		logger.WithUser(user.GetUserId()).Errorf("Failed to recreate clients when fetching common music %v %v", err, span)
-		handleError(roomExpiredError, w, r, user)
+		logger.
+			WithUserAndRoom(user.GetUserId(), roomId).
+			WithError(err).
+			Errorf("Failed to decode json body for find playlists for room %v", span)
+		handleError(err, w, r, user)
 		return
 	}
 
 	logger.WithUser(user.GetUserId()).Infof("User %s requested to find the playlists for room %s %v",
 		user.GetUserId(), roomId, span)
 
-	if room.MusicLibrary != nil && !room.MusicLibrary.HasProcessingFailed() {
+	processingPolicy := findPlaylistsRequestBody.ProcessingPolicy
+
+	if processingPolicy != nil {
+		err = processingPolicy.Validate(len(room.Users))
+
+		if err != nil {
+			span.Finish(tracer.WithError(err))
+			handleError(err, w, r, user)
+			return
+		}
+	}
+
+	processingOptions := findPlaylistsRequestBody.ProcessingOptions
+
+	if processingOptions != nil {
+		err = processingOptions.Validate(len(room.Users))
+	} else if room.ProcessingOptions != nil {
+		// the options kept from the previous time might no longer fit the users of the room
+		err = room.ProcessingOptions.Validate(len(room.Users))
+	}
+
+	if err != nil {
+		span.Finish(tracer.WithError(err))
+		handleError(err, w, r, user)
+		return
+	}
+
+	// a failed or cancelled processing can be launched again, as well as a processed room opened to new members
+	if room.MusicLibrary != nil && !room.MusicLibrary.HasProcessingFailed() &&
+		!room.MusicLibrary.HasProcessingBeenCancelled() && !(room.HasRoomBeenProcessedSuccessfully() && !*room.Locked) {
 		span.Finish(tracer.WithError(processingInProgressError))
 		handleError(processingInProgressError, w, r, user)
 		return
 	}
 
+	// we create the music library, only the songs of the users not in a previous result are fetched
+	musicLibrary := room.CreateMusicLibraryForProcessing()
+
+	// the reused users cannot be fetched again, so their libraries have to stay the way they were fetched
+	if processingOptions != nil && musicLibrary.HasReusedUsers() &&
+		!processingOptions.GetLibrarySources().Equals(room.ProcessingOptions.GetLibrarySources()) {
+		span.Finish(tracer.WithError(app.ErrorReusedLibraryOptionsChanged))
+		handleError(app.ErrorReusedLibraryOptionsChanged, w, r, user)
+		return
+	}
+
+	previousMusicLibrary := room.MusicLibrary
+	previousProcessingPolicy := room.ProcessingPolicy
+	previousProcessingOptions := room.ProcessingOptions
+	previousLocked := *room.Locked
+
 	// we lock the room, so no one should be able to enter it now
 	*room.Locked = true
 
-	// we create the music library
-	room.MusicLibrary = app.CreateSharedMusicLibrary(len(room.Users))
+	// without a policy or options in the request, the ones used the previous time are kept
+	if processingPolicy != nil {
+		room.ProcessingPolicy = processingPolicy
+	}
+
+	if processingOptions != nil {
+		room.ProcessingOptions = processingOptions
+	}
+
+	room.MusicLibrary = musicLibrary
 
 	err = updateRoomWithCtx(room, ctx)
 
@@ -142,38 +205,40 @@ func FindPlaylistsForRoom(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// we now process the library of the users (all this is done async)
-	logger.Logger.Infof("Starting processing of room %s for users %s %v", roomId, room.GetUserIds(), span)
-
-	ctxWithTimeout, cancel := context.WithTimeout(context.Background(), app.TimeoutRoomProcessing)
-	processingSpan, ctxWithTimeout := tracer.StartSpanFromContext(ctxWithTimeout, "room.process")
-
-	err = room.MusicLibrary.Process(room, func(success bool, ctx context.Context) {
-		// callback function
-		updateRoomNotProcessed(room, success, ctx)
-
-		// remove the cancel as room is done processing
-		app.RemoveCancel(roomId)
-
-		// close the span
-		processingSpan.Finish()
-
-	}, func(ctx context.Context) error {
-		// we update the last time checkpoint
-		room.MusicLibrary.ProcessingStatus.CheckpointTime = time.Now()
+	// we now add the room to the processing queue, the processing is done by the workers
+	err = enqueueRoomProcessing(room, ctx)
+
+	if err == mongoclient.ErrJobAlreadyQueued {
+		// a cancelled processing might still be stopping, so we put the room back as it was
+		if previousMusicLibrary != nil && previousMusicLibrary.HasProcessingBeenCancelled() {
+			*room.Locked = false
+			room.MusicLibrary = previousMusicLibrary
+			room.ProcessingPolicy = previousProcessingPolicy
+			room.ProcessingOptions = previousProcessingOptions
+			_ = updateRoomWithCtx(room, ctx)
+		}
 
-		return updateRoomWithCtx(room, ctx)
-	}, ctxWithTimeout)
+		span.Finish(tracer.WithError(processingInProgressError))
+		handleError(processingInProgressError, w, r, user)
+		return
+	}
 
 	if err != nil {
 		span.Finish(tracer.WithError(err))
-		logger.WithUser(user.GetUserId()).Errorf("Failed to launch processing %s %v", roomId, err)
+		logger.WithUser(user.GetUserId()).Errorf("Failed to queue processing %s %v", roomId, err)
+
+		// nothing will process the room, so we put it back as it was for the processing to be launched again
+		*room.Locked = previousLocked
+		room.MusicLibrary = previousMusicLibrary
+		room.ProcessingPolicy = previousProcessingPolicy
+		room.ProcessingOptions = previousProcessingOptions
+		_ = updateRoomWithCtx(room, ctx)
+
 		handleError(processingLaunchError, w, r, user)
 		return
 	}
 
-	// add the cancel function for the room in case we need to shutdown processing
-	app.AddCancel(roomId, cancel)
+	logger.Logger.Infof("Queued processing of room %s for users %s %v", roomId, room.GetUserIds(), span)
 
 	httputils.SendOk(w)
 }
@@ -214,6 +279,11 @@ func GetPlaylist(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if musicLibrary.HasProcessingBeenCancelled() {
+		handleError(processingCancelledError, w, r, user)
+		return
+	}
+
 	// check the processing is over and it did not fail
 	if !musicLibrary.HasProcessingFinished() {
 		handleError(processingInProgressError, w, r, user)
@@ -258,8 +328,18 @@ func RoomAddPlaylistHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// The tracks added are the ones shared by one of the user counts, or all of them if there is none
+// Only the best tracks by score are added when a top count is given
+// The best tracks that fit in the target duration are added when one is given
+// The tracks are in the order of their score unless the smooth order is chosen, with an optional energy curve
+// The explicit tracks are removed or swapped for their clean version when asked, or when the room is family safe
 type AddPlaylistRequestBody struct {
-	SharedUserCount []int `json:"shared_user_count"`
+	SharedUserCount []int  `json:"shared_user_count"`
+	TopCount        int    `json:"top_count"`
+	Order           string `json:"order"`
+	EnergyCurve     string `json:"energy_curve"`
+	ExcludeExplicit bool   `json:"exclude_explicit"`
+	app.PlaylistDurationOptions
 }
 
 func AddPlaylistForUser(w http.ResponseWriter, r *http.Request) {
@@ -293,8 +373,27 @@ func AddPlaylistForUser(w http.ResponseWriter, r *http.Request) {
 
 	logger.
 		WithUserAndRoom(user.GetUserId(), roomId).
-		Infof("User requested to create playlist %s for room with user count songs %v %v",
-			playlistId, addPlaylistRequestBody.SharedUserCount, span)
+		Infof("User requested to create playlist %s for room with user count songs %v and top count %d, excluding explicit tracks %t %v",
+			playlistId, addPlaylistRequestBody.SharedUserCount, addPlaylistRequestBody.TopCount,
+			addPlaylistRequestBody.ExcludeExplicit, span)
+
+	if addPlaylistRequestBody.TopCount < 0 {
+		span.Finish(tracer.WithError(invalidTopCountError))
+		handleError(invalidTopCountError, w, r, user)
+		return
+	}
+
+	err = app.ValidatePlaylistOrder(addPlaylistRequestBody.Order, addPlaylistRequestBody.EnergyCurve)
+
+	if err == nil {
+		err = addPlaylistRequestBody.PlaylistDurationOptions.Validate()
+	}
+
+	if err != nil {
+		span.Finish(tracer.WithError(err))
+		handleError(err, w, r, user)
+		return
+	}
 
 	musicLibrary := room.MusicLibrary
 
@@ -304,6 +403,12 @@ func AddPlaylistForUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if musicLibrary.HasProcessingBeenCancelled() {
+		span.Finish(tracer.WithError(processingCancelledError))
+		handleError(processingCancelledError, w, r, user)
+		return
+	}
+
 	// check the processing is over and it did not fail
 	if !musicLibrary.HasProcessingFinished() {
 		span.Finish(tracer.WithError(processingInProgressError))
@@ -332,16 +437,62 @@ func AddPlaylistForUser(w http.ResponseWriter, r *http.Request) {
 	// we create in spotify the playlist
 	newPlaylist := CreateNewPlaylist(room.Name, playlist.Name)
 
-	// we get the songs that are above the min shared count limit requested by the user
-	tracks := make([]*spotify.FullTrack, 0)
-
-	for sharedCount, sharedTracks := range playlist.TracksPerSharedCount {
-		if funk.ContainsInt(addPlaylistRequestBody.SharedUserCount, sharedCount) {
-			tracks = append(tracks, sharedTracks...)
+	excludeExplicit := addPlaylistRequestBody.ExcludeExplicit || room.ProcessingOptions.IsFamilySafe()
+	topCount := addPlaylistRequestBody.TopCount
+	durationOptions := addPlaylistRequestBody.PlaylistDurationOptions
+	var trackFilter app.TrackFilter
+	var explicitFilter *app.ExplicitFilter
+
+	// the explicit tracks are excluded while the best ones are selected, so there are still enough of them and only
+	// the ones selected are searched for a clean version
+	if excludeExplicit {
+		explicitFilter = app.NewExplicitFilter()
+		trackFilter = explicitFilter.FilterTrack
+		newPlaylist.ExplicitFilter = explicitFilter.Report
+
+		if topCount != 0 && (durationOptions.MaxTrackCount == 0 || topCount < durationOptions.MaxTrackCount) {
+			durationOptions.MaxTrackCount = topCount
 		}
+
+		topCount = 0
+	}
+
+	// we get the songs that are above the min shared count limit requested by the user, in the order of their score
+	tracks := playlist.GetTracksByScore(addPlaylistRequestBody.SharedUserCount, topCount)
+
+	tracks, err = durationOptions.SelectTracks(tracks, trackFilter)
+
+	if err != nil {
+		span.Finish(tracer.WithError(err))
+		handleError(err, w, r, user)
+		return
+	}
+
+	if excludeExplicit {
+		explicitFilter.ReportSelectedTracks(tracks)
+
+		logger.
+			WithUserAndRoom(user.GetUserId(), roomId).
+			Infof("Excluded explicit tracks of playlist %s, %d were removed and %d were swapped", playlistId,
+				newPlaylist.ExplicitFilter.RemovedCount, newPlaylist.ExplicitFilter.SwappedCount)
 	}
 
-	playlistUrl, err := musicclient.CreatePlaylist(user, newPlaylist.Name, tracks, ctx)
+	tracks, err = app.OrderTracks(tracks, addPlaylistRequestBody.Order, addPlaylistRequestBody.EnergyCurve)
+
+	if err != nil {
+		span.Finish(tracer.WithError(err))
+		logger.
+			WithUserAndRoom(user.GetUserId(), roomId).
+			WithError(err).
+			Errorf("Failed to order the tracks of playlist %s %v", playlistId, span)
+		handleError(failedToCreatePlaylistError, w, r, user)
+		return
+	}
+
+	playlistUrl, addedTracks, err := musicclient.CreatePlaylist(user, newPlaylist.Name, tracks, ctx)
+
+	// the tracks the provider of the user does not have are skipped
+	newPlaylist.Duration = app.GetTracksDuration(addedTracks)
 
 	if playlistUrl != nil {
 		// TODO: change field name
@@ -376,9 +527,12 @@ func AddPlaylistForUser(w http.ResponseWriter, r *http.Request) {
 type NewPlaylist struct {
 	Name       string `json:"name"`
 	SpotifyUrl string `json:"spotify_url"`
+	Duration   int    `json:"duration_ms"` // total length of the tracks added
+	// How many explicit tracks were removed or swapped, nil if they were not excluded
+	ExplicitFilter *app.ExplicitFilterReport `json:"explicit_filter"`
 }
 
 func CreateNewPlaylist(roomName string, playlistName string) *NewPlaylist {
 	spotifyPlaylistName := fmt.Sprintf("%s - %s %s", roomName, playlistName, clientcommon.NameCredits)
-	return &NewPlaylist{spotifyPlaylistName, ""}
+	return &NewPlaylist{spotifyPlaylistName, "", 0, nil}
 }
@@ -0,0 +1,230 @@
+package app
+
+import (
+	"errors"
+	"github.com/shared-spotify/logger"
+	"github.com/shared-spotify/musicclient/clientcommon"
+)
+
+// Playlists made from the audio features of the shared tracks, the audio features only exist for the tracks found on
+// spotify, so the tracks without them are left out of these playlists
+
+const GeneratorDance = "dance"
+const GeneratorEnergy = "energy"
+const GeneratorMood = "mood"
+const GeneratorTempo = "tempo"
+
+var ErrorInvalidAudioFeatureThresholds = errors.New("Invalid audio feature thresholds, features must be between " +
+	"0 and 1 and the slow tempo must be below the fast tempo")
+
+// The thresholds for the audio features go from 0 to 1, except the tempo which is in beats per minute
+// A threshold left to 0 uses the default one
+type AudioFeatureThresholds struct {
+	MinDanceability       float32 `json:"min_danceability"`
+	MinHighEnergy         float32 `json:"min_high_energy"`
+	MaxChillEnergy        float32 `json:"max_chill_energy"`
+	MinChillAcousticness  float32 `json:"min_chill_acousticness"`
+	MinHappyValence       float32 `json:"min_happy_valence"`
+	MaxMelancholicValence float32 `json:"max_melancholic_valence"`
+	MaxSlowTempo          float32 `json:"max_slow_tempo"`
+	MinFastTempo          float32 `json:"min_fast_tempo"`
+	MinTrackCount         int     `json:"min_track_count"` // min count to have a playlist to be included
+}
+
+var DefaultAudioFeatureThresholds = AudioFeatureThresholds{
+	MinDanceability:       0.7,
+	MinHighEnergy:         0.75,
+	MaxChillEnergy:        0.45,
+	MinChillAcousticness:  0.5,
+	MinHappyValence:       0.65,
+	MaxMelancholicValence: 0.35,
+	MaxSlowTempo:          95,
+	MinFastTempo:          125,
+	MinTrackCount:         5,
+}
+
+func (thresholds *AudioFeatureThresholds) Validate() error {
+	features := []float32{
+		thresholds.MinDanceability,
+		thresholds.MinHighEnergy,
+		thresholds.MaxChillEnergy,
+		thresholds.MinChillAcousticness,
+		thresholds.MinHappyValence,
+		thresholds.MaxMelancholicValence,
+	}
+
+	for _, feature := range features {
+		if feature < 0 || feature > 1 {
+			return ErrorInvalidAudioFeatureThresholds
+		}
+	}
+
+	if thresholds.MaxSlowTempo < 0 || thresholds.MinFastTempo < 0 || thresholds.MinTrackCount < 0 {
+		return ErrorInvalidAudioFeatureThresholds
+	}
+
+	withDefaults := thresholds.withDefaults()
+
+	if withDefaults.MaxSlowTempo >= withDefaults.MinFastTempo {
+		return ErrorInvalidAudioFeatureThresholds
+	}
+
+	return nil
+}
+
+func (thresholds *AudioFeatureThresholds) withDefaults() AudioFeatureThresholds {
+	withDefaults := DefaultAudioFeatureThresholds
+
+	if thresholds == nil {
+		return withDefaults
+	}
+
+	if thresholds.MinDanceability != 0 {
+		withDefaults.MinDanceability = thresholds.MinDanceability
+	}
+
+	if thresholds.MinHighEnergy != 0 {
+		withDefaults.MinHighEnergy = thresholds.MinHighEnergy
+	}
+
+	if thresholds.MaxChillEnergy != 0 {
+		withDefaults.MaxChillEnergy = thresholds.MaxChillEnergy
+	}
+
+	if thresholds.MinChillAcousticness != 0 {
+		withDefaults.MinChillAcousticness = thresholds.MinChillAcousticness
+	}
+
+	if thresholds.MinHappyValence != 0 {
+		withDefaults.MinHappyValence = thresholds.MinHappyValence
+	}
+
+	if thresholds.MaxMelancholicValence != 0 {
+		withDefaults.MaxMelancholicValence = thresholds.MaxMelancholicValence
+	}
+
+	if thresholds.MaxSlowTempo != 0 {
+		withDefaults.MaxSlowTempo = thresholds.MaxSlowTempo
+	}
+
+	if thresholds.MinFastTempo != 0 {
+		withDefaults.MinFastTempo = thresholds.MinFastTempo
+	}
+
+	if thresholds.MinTrackCount != 0 {
+		withDefaults.MinTrackCount = thresholds.MinTrackCount
+	}
+
+	return withDefaults
+}
+
+func (playlists *CommonPlaylists) GenerateDancePlaylist(generator PlaylistGenerator, sharedTrackPlaylist *Playlist) {
+	thresholds := playlists.Options.GetAudioFeatureThresholds()
+
+	danceTracksInCommon := playlists.getTracksWithAudioFeatures(sharedTrackPlaylist,
+		func(audioFeatures *clientcommon.AudioFeatures) bool {
+			return audioFeatures.Danceability >= thresholds.MinDanceability
+		})
+
+	playlists.createPlaylistForMinCount(playlistNameDance, generator.Type(), generator.Rank(), 1,
+		danceTracksInCommon, thresholds.MinTrackCount)
+}
+
+func (playlists *CommonPlaylists) GenerateEnergyPlaylists(generator PlaylistGenerator, sharedTrackPlaylist *Playlist) {
+	thresholds := playlists.Options.GetAudioFeatureThresholds()
+
+	highEnergyTracksInCommon := playlists.getTracksWithAudioFeatures(sharedTrackPlaylist,
+		func(audioFeatures *clientcommon.AudioFeatures) bool {
+			return audioFeatures.Energy >= thresholds.MinHighEnergy
+		})
+
+	chillTracksInCommon := playlists.getTracksWithAudioFeatures(sharedTrackPlaylist,
+		func(audioFeatures *clientcommon.AudioFeatures) bool {
+			return audioFeatures.Energy <= thresholds.MaxChillEnergy &&
+				audioFeatures.Acousticness >= thresholds.MinChillAcousticness
+		})
+
+	playlists.createPlaylistForMinCount(playlistNameHighEnergy, generator.Type(), generator.Rank(), 1,
+		highEnergyTracksInCommon, thresholds.MinTrackCount)
+	playlists.createPlaylistForMinCount(playlistNameChill, generator.Type(), generator.Rank(), 2,
+		chillTracksInCommon, thresholds.MinTrackCount)
+}
+
+func (playlists *CommonPlaylists) GenerateMoodPlaylists(generator PlaylistGenerator, sharedTrackPlaylist *Playlist) {
+	thresholds := playlists.Options.GetAudioFeatureThresholds()
+
+	happyTracksInCommon := playlists.getTracksWithAudioFeatures(sharedTrackPlaylist,
+		func(audioFeatures *clientcommon.AudioFeatures) bool {
+			return audioFeatures.Valence >= thresholds.MinHappyValence
+		})
+
+	melancholicTracksInCommon := playlists.getTracksWithAudioFeatures(sharedTrackPlaylist,
+		func(audioFeatures *clientcommon.AudioFeatures) bool {
+			return audioFeatures.Valence <= thresholds.MaxMelancholicValence
+		})
+
+	playlists.createPlaylistForMinCount(playlistNameHappy, generator.Type(), generator.Rank(), 1,
+		happyTracksInCommon, thresholds.MinTrackCount)
+	playlists.createPlaylistForMinCount(playlistNameMelancholic, generator.Type(), generator.Rank(), 2,
+		melancholicTracksInCommon, thresholds.MinTrackCount)
+}
+
+func (playlists *CommonPlaylists) GenerateTempoPlaylists(generator PlaylistGenerator, sharedTrackPlaylist *Playlist) {
+	thresholds := playlists.Options.GetAudioFeatureThresholds()
+
+	// spotify sends a tempo of 0 when it could not detect it
+	slowTracksInCommon := playlists.getTracksWithAudioFeatures(sharedTrackPlaylist,
+		func(audioFeatures *clientcommon.AudioFeatures) bool {
+			return audioFeatures.Tempo > 0 && audioFeatures.Tempo <= thresholds.MaxSlowTempo
+		})
+
+	midTracksInCommon := playlists.getTracksWithAudioFeatures(sharedTrackPlaylist,
+		func(audioFeatures *clientcommon.AudioFeatures) bool {
+			return audioFeatures.Tempo > thresholds.MaxSlowTempo && audioFeatures.Tempo < thresholds.MinFastTempo
+		})
+
+	fastTracksInCommon := playlists.getTracksWithAudioFeatures(sharedTrackPlaylist,
+		func(audioFeatures *clientcommon.AudioFeatures) bool {
+			return audioFeatures.Tempo >= thresholds.MinFastTempo
+		})
+
+	playlists.createPlaylistForMinCount(playlistNameSlowTempo, generator.Type(), generator.Rank(), 1,
+		slowTracksInCommon, thresholds.MinTrackCount)
+	playlists.createPlaylistForMinCount(playlistNameMidTempo, generator.Type(), generator.Rank(), 2,
+		midTracksInCommon, thresholds.MinTrackCount)
+	playlists.createPlaylistForMinCount(playlistNameFastTempo, generator.Type(), generator.Rank(), 3,
+		fastTracksInCommon, thresholds.MinTrackCount)
+}
+
+// Returns the shared tracks whose audio features match, per shared count
+func (playlists *CommonPlaylists) getTracksWithAudioFeatures(sharedTrackPlaylist *Playlist,
+	match func(audioFeatures *clientcommon.AudioFeatures) bool) map[int][]*clientcommon.Track {
+	tracksInCommon := make(map[int][]*clientcommon.Track)
+	missingAudioFeatures := 0
+
+	for sharedCount, tracks := range sharedTrackPlaylist.TracksPerSharedCount {
+		tracksInCommonForSharedCount := make([]*clientcommon.Track, 0)
+
+		for _, track := range tracks {
+			isrc, _ := clientcommon.GetTrackISRC(track)
+			audioFeatures, ok := playlists.AudioFeaturesPerTrack[isrc]
+
+			if !ok || audioFeatures == nil {
+				missingAudioFeatures += 1
+				continue
+			}
+
+			if match(audioFeatures) {
+				tracksInCommonForSharedCount = append(tracksInCommonForSharedCount, track)
+			}
+		}
+
+		tracksInCommon[sharedCount] = tracksInCommonForSharedCount
+	}
+
+	if missingAudioFeatures > 0 {
+		logger.Logger.Debugf("%d shared tracks have no audio features, they are left out", missingAudioFeatures)
+	}
+
+	return tracksInCommon
+}
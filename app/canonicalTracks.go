@@ -0,0 +1,189 @@
+package app
+
+import (
+	"github.com/shared-spotify/musicclient/clientcommon"
+	"regexp"
+	"strings"
+)
+
+// The same recording can have several isrcs, for remasters, singles released before the album or re-issues in other
+// countries, and each provider can have a different one. The tracks are grouped by recording so they are shared
+// even when the users did not save the same isrc. A group is identified by the isrc of the first track seen for it,
+// which is the canonical id used as the track id everywhere else in the playlists
+
+// two versions of a recording can have slightly different durations, for example because of the silence at the end
+const canonicalDurationToleranceMs = 3000
+
+// The parts of a title that only say which release of the recording it is, and not that it is another recording
+// The whole part must be made of these words, so live, acoustic or remix versions, which are other recordings, are kept
+// even when they are remastered too
+var releaseVariantRegexp = regexp.MustCompile(`(?i)^(?:remaster(?:ed)?(?: version)?|single version|album version|` +
+	`radio version|original version|mono|stereo|deluxe(?: edition)?|bonus(?: track)?|explicit|clean|\d{4}|` +
+	`[\s/,&.:;-])+$`)
+var titleSuffixSeparatorRegexp = regexp.MustCompile(`\s+-\s+`)
+var titleParenthesisRegexp = regexp.MustCompile(`\s*[(\[][^)\]]*[)\]]`)
+var nonAlphanumericRegexp = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+var artistSeparatorRegexp = regexp.MustCompile(`(?i)\s*(,|&|\bfeat\.?\s|\bft\.?\s|\bfeaturing\s).*$`)
+
+type canonicalTrack struct {
+	canonicalId string
+	duration    int
+}
+
+type canonicalTracks struct {
+	// canonical id for each isrc seen
+	canonicalIdPerIsrc map[string]string
+	// canonical id for each provider id seen, to use the tracks relinked by the providers
+	canonicalIdPerProviderId map[string]string
+	// groups having the same normalised title and primary artist, they are then told apart by duration
+	canonicalTracksPerKey map[string][]*canonicalTrack
+}
+
+func createCanonicalTracks() *canonicalTracks {
+	return &canonicalTracks{
+		make(map[string]string),
+		make(map[string]string),
+		make(map[string][]*canonicalTrack),
+	}
+}
+
+// Returns the canonical id of the track, the track becomes the first of a new group if it matches none
+func (tracks *canonicalTracks) getCanonicalId(track *clientcommon.Track) (string, bool) {
+	isrc, ok := clientcommon.GetTrackISRC(track)
+
+	if !ok {
+		return "", false
+	}
+
+	canonicalId, ok := tracks.findCanonicalId(track)
+
+	if !ok {
+		canonicalId = isrc
+		key := getRecordingKey(track)
+
+		if key != "" {
+			tracks.canonicalTracksPerKey[key] = append(tracks.canonicalTracksPerKey[key],
+				&canonicalTrack{canonicalId, track.Duration})
+		}
+	}
+
+	tracks.canonicalIdPerIsrc[isrc] = canonicalId
+
+	for loginType, id := range track.ProviderIds {
+		tracks.canonicalIdPerProviderId[loginType+":"+id] = canonicalId
+	}
+
+	for loginType, id := range track.LinkedFrom {
+		tracks.canonicalIdPerProviderId[loginType+":"+id] = canonicalId
+	}
+
+	return canonicalId, true
+}
+
+// Returns the canonical id of the group the track matches, without adding it to the groups
+func (tracks *canonicalTracks) findCanonicalId(track *clientcommon.Track) (string, bool) {
+	isrc, ok := clientcommon.GetTrackISRC(track)
+
+	if !ok {
+		return "", false
+	}
+
+	canonicalId, ok := tracks.canonicalIdPerIsrc[isrc]
+
+	if !ok {
+		canonicalId, ok = tracks.findCanonicalIdForLinkedTrack(track)
+	}
+
+	if !ok {
+		canonicalId, ok = tracks.findCanonicalIdForRecording(track)
+	}
+
+	return canonicalId, ok
+}
+
+// Returns the canonical id of the track for an isrc already seen
+func (tracks *canonicalTracks) getCanonicalIdForIsrc(isrc string) (string, bool) {
+	canonicalId, ok := tracks.canonicalIdPerIsrc[isrc]
+	return canonicalId, ok
+}
+
+func (tracks *canonicalTracks) findCanonicalIdForLinkedTrack(track *clientcommon.Track) (string, bool) {
+	for _, ids := range []clientcommon.ProviderIds{track.ProviderIds, track.LinkedFrom} {
+		for loginType, id := range ids {
+			if canonicalId, ok := tracks.canonicalIdPerProviderId[loginType+":"+id]; ok {
+				return canonicalId, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+func (tracks *canonicalTracks) findCanonicalIdForRecording(track *clientcommon.Track) (string, bool) {
+	key := getRecordingKey(track)
+
+	if key == "" {
+		return "", false
+	}
+
+	for _, canonicalTrack := range tracks.canonicalTracksPerKey[key] {
+		durationDifference := canonicalTrack.duration - track.Duration
+
+		if durationDifference < 0 {
+			durationDifference = -durationDifference
+		}
+
+		if durationDifference <= canonicalDurationToleranceMs {
+			return canonicalTrack.canonicalId, true
+		}
+	}
+
+	return "", false
+}
+
+// The key of a recording is made of its normalised title and primary artist, empty if one of them is unknown
+func getRecordingKey(track *clientcommon.Track) string {
+	if len(track.Artists) == 0 {
+		return ""
+	}
+
+	title := normaliseTitle(track.Name)
+	artist := normaliseArtist(track.Artists[0].Name)
+
+	if title == "" || artist == "" {
+		return ""
+	}
+
+	return artist + "|" + title
+}
+
+func normaliseTitle(title string) string {
+	// "Song - Remastered 2011" or "Song (Single Version)" are the same recording as "Song", the suffixes are removed
+	// from the last one so "Song - Part 1 - Remastered" keeps its first suffix
+	parts := titleSuffixSeparatorRegexp.Split(title, -1)
+
+	for len(parts) > 1 && releaseVariantRegexp.MatchString(parts[len(parts)-1]) {
+		parts = parts[:len(parts)-1]
+	}
+
+	title = strings.Join(parts, " - ")
+
+	title = titleParenthesisRegexp.ReplaceAllStringFunc(title, func(parenthesis string) string {
+		if releaseVariantRegexp.MatchString(strings.Trim(parenthesis, " ()[]")) {
+			return ""
+		}
+
+		return parenthesis
+	})
+
+	return normaliseText(title)
+}
+
+// Some providers give all the artists as a single one, like "Artist & Other Artist", so only the first is kept
+func normaliseArtist(artist string) string {
+	return normaliseText(artistSeparatorRegexp.ReplaceAllString(artist, ""))
+}
+
+func normaliseText(text string) string {
+	return strings.TrimSpace(nonAlphanumericRegexp.ReplaceAllString(strings.ToLower(text), " "))
+}
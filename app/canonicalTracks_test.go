@@ -0,0 +1,99 @@
+package app
+
+import (
+	"github.com/shared-spotify/musicclient/clientcommon"
+	"testing"
+)
+
+func TestNormaliseTitle(t *testing.T) {
+	tests := []struct {
+		title    string
+		expected string
+	}{
+		{"Song", "song"},
+		{"Song - Remastered 2011", "song"},
+		{"Song - 2011 Remaster", "song"},
+		{"Song (Single Version)", "song"},
+		{"Song [Deluxe Edition]", "song"},
+		{"Song (Remastered) - Mono", "song"},
+		// the live, acoustic and remix versions are other recordings
+		{"Song - Live", "song live"},
+		{"Song (Live)", "song live"},
+		{"Song - Live / Remastered 2011", "song live remastered 2011"},
+		{"Song - Acoustic Remix", "song acoustic remix"},
+		// only the suffixes made of release words are removed
+		{"Song - Part 1 - Remastered", "song part 1"},
+		{"Song - Part 1", "song part 1"},
+		{"Monochrome", "monochrome"},
+		{"Song (Stereo Love)", "song stereo love"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			if title := normaliseTitle(test.title); title != test.expected {
+				t.Errorf("Expected %q, got %q", test.expected, title)
+			}
+		})
+	}
+}
+
+func TestGetRecordingKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		track    *clientcommon.Track
+		expected string
+	}{
+		{"title and artist", newCanonicalTestTrack("Song - Remastered", "Artist", 0), "artist|song"},
+		{"several artists in one", newCanonicalTestTrack("Song", "Artist & Other Artist", 0), "artist|song"},
+		{"featuring", newCanonicalTestTrack("Song", "Artist feat. Other Artist", 0), "artist|song"},
+		{"no artist", &clientcommon.Track{Name: "Song"}, ""},
+		{"no title", newCanonicalTestTrack("(Remastered)", "Artist", 0), ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if key := getRecordingKey(test.track); key != test.expected {
+				t.Errorf("Expected %q, got %q", test.expected, key)
+			}
+		})
+	}
+}
+
+func TestGetCanonicalId(t *testing.T) {
+	tracks := createCanonicalTracks()
+
+	tests := []struct {
+		name     string
+		isrc     string
+		title    string
+		duration int
+		expected string
+	}{
+		{"first of its group", "ISRC1", "Song", 200000, "ISRC1"},
+		{"remaster of the same recording", "ISRC2", "Song - Remastered 2011", 201000, "ISRC1"},
+		{"duration too different", "ISRC3", "Song", 260000, "ISRC3"},
+		{"live version", "ISRC4", "Song - Live / Remastered 2011", 200000, "ISRC4"},
+		{"isrc already seen", "ISRC2", "Other title", 100000, "ISRC1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			track := newCanonicalTestTrack(test.title, "Artist", test.duration)
+			track.Isrc = test.isrc
+
+			canonicalId, ok := tracks.getCanonicalId(track)
+
+			if !ok || canonicalId != test.expected {
+				t.Errorf("Expected %s, got %s", test.expected, canonicalId)
+			}
+		})
+	}
+}
+
+func newCanonicalTestTrack(title string, artist string, duration int) *clientcommon.Track {
+	return &clientcommon.Track{
+		Name:     title,
+		Artists:  []*clientcommon.Artist{{Name: artist}},
+		Duration: duration,
+	}
+}
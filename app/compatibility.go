@@ -0,0 +1,244 @@
+package app
+
+import (
+	"github.com/shared-spotify/logger"
+	"github.com/shared-spotify/musicclient"
+	"github.com/shared-spotify/musicclient/clientcommon"
+	"sort"
+	"strings"
+)
+
+// The compatibility of the members of a room, computed for every pair of members from their whole libraries
+// The overlaps are jaccard indexes, the size of what both members have over the size of what any of them has
+// The genres are fetched for the artists of every library, the artists are matched by name as the providers
+// do not share ids, so an artist only known to a provider without genres gets the genres found elsewhere
+
+const maxTopSharedArtists = 5
+
+type CompatibilityMatrix struct {
+	Pairs []*UserCompatibility `json:"pairs"`
+}
+
+type UserCompatibility struct {
+	UserId           string   `json:"user_id"`
+	OtherUserId      string   `json:"other_user_id"`
+	SharedTrackCount int      `json:"shared_track_count"`
+	TrackOverlap     float64  `json:"track_overlap"`
+	ArtistOverlap    float64  `json:"artist_overlap"`
+	GenreOverlap     float64  `json:"genre_overlap"`
+	TopSharedArtists []string `json:"top_shared_artists"` // the artists with the most tracks in both libraries
+}
+
+// The library of a user reduced to what is needed to compare it
+type userLibraryProfile struct {
+	trackIds            map[string]bool
+	trackCountPerArtist map[string]int
+	artistNames         map[string]string // display name per artist key
+	genres              map[string]bool
+}
+
+func (playlists *CommonPlaylists) GenerateCompatibilityMatrix() (*CompatibilityMatrix, error) {
+	genresPerArtist, err := playlists.getGenresPerArtist()
+
+	if err != nil {
+		return nil, err
+	}
+
+	userIds := make([]string, 0)
+
+	for userId := range playlists.TracksPerUser {
+		userIds = append(userIds, userId)
+	}
+
+	// the pairs are always in the same order for the same users
+	sort.Strings(userIds)
+
+	profiles := make(map[string]*userLibraryProfile)
+
+	for _, userId := range userIds {
+		profiles[userId] = playlists.getUserLibraryProfile(playlists.TracksPerUser[userId], genresPerArtist)
+	}
+
+	pairs := make([]*UserCompatibility, 0)
+
+	for i, userId := range userIds {
+		for _, otherUserId := range userIds[i+1:] {
+			pairs = append(pairs, getUserCompatibility(userId, profiles[userId], otherUserId, profiles[otherUserId]))
+		}
+	}
+
+	return &CompatibilityMatrix{pairs}, nil
+}
+
+// The genres of the artists of all the libraries, per artist key
+func (playlists *CommonPlaylists) getGenresPerArtist() (map[string][]string, error) {
+	// a single track per artist is enough to fetch it
+	tracks := make([]*clientcommon.Track, 0)
+	artistSeen := make(map[string]bool)
+
+	for _, userTracks := range playlists.TracksPerUser {
+		for _, track := range userTracks {
+			for _, artist := range track.Artists {
+				spotifyArtistId, ok := artist.ProviderIds.Get(clientcommon.SpotifyLoginType)
+
+				if !ok || artistSeen[spotifyArtistId] {
+					continue
+				}
+
+				artistSeen[spotifyArtistId] = true
+				tracks = append(tracks, track)
+				break
+			}
+		}
+	}
+
+	logger.Logger.Infof("Fetching the genres of %d artists for the compatibility", len(artistSeen))
+
+	libraryArtistsPerTrack, err := musicclient.GetArtists(tracks)
+
+	if err != nil {
+		return nil, err
+	}
+
+	genresPerArtist := make(map[string][]string)
+
+	// the artists of the shared tracks are known once these are resolved, even for the other providers
+	for _, artistsPerTrack := range []map[string][]*clientcommon.Artist{playlists.ArtistsPerTrack, libraryArtistsPerTrack} {
+		for _, artists := range artistsPerTrack {
+			for _, artist := range artists {
+				if len(artist.Genres) > 0 {
+					genresPerArtist[getArtistKey(artist)] = artist.Genres
+				}
+			}
+		}
+	}
+
+	return genresPerArtist, nil
+}
+
+func (playlists *CommonPlaylists) getUserLibraryProfile(tracks []*clientcommon.Track,
+	genresPerArtist map[string][]string) *userLibraryProfile {
+	profile := &userLibraryProfile{
+		make(map[string]bool),
+		make(map[string]int),
+		make(map[string]string),
+		make(map[string]bool),
+	}
+
+	for _, track := range tracks {
+		isrc, ok := playlists.getTrackId(track)
+
+		// a track can be multiple times in the library of a user
+		if !ok || profile.trackIds[isrc] {
+			continue
+		}
+
+		profile.trackIds[isrc] = true
+
+		for _, artist := range track.Artists {
+			artistKey := getArtistKey(artist)
+			profile.trackCountPerArtist[artistKey] += 1
+			profile.artistNames[artistKey] = artist.Name
+
+			for _, genre := range genresPerArtist[artistKey] {
+				profile.genres[genre] = true
+			}
+		}
+	}
+
+	return profile
+}
+
+func getUserCompatibility(userId string, profile *userLibraryProfile, otherUserId string,
+	otherProfile *userLibraryProfile) *UserCompatibility {
+	sharedTrackCount := getIntersectionCount(profile.trackIds, otherProfile.trackIds)
+
+	artists := make(map[string]bool)
+	otherArtists := make(map[string]bool)
+
+	for artistKey := range profile.trackCountPerArtist {
+		artists[artistKey] = true
+	}
+
+	for artistKey := range otherProfile.trackCountPerArtist {
+		otherArtists[artistKey] = true
+	}
+
+	// an artist is as shared as the number of its tracks the member with the least of them has
+	sharedArtists := make([]string, 0)
+
+	for artistKey := range artists {
+		if otherArtists[artistKey] {
+			sharedArtists = append(sharedArtists, artistKey)
+		}
+	}
+
+	sharedTrackCountForArtist := func(artistKey string) int {
+		count := profile.trackCountPerArtist[artistKey]
+
+		if otherCount := otherProfile.trackCountPerArtist[artistKey]; otherCount < count {
+			return otherCount
+		}
+
+		return count
+	}
+
+	sort.Slice(sharedArtists, func(i, j int) bool {
+		countI := sharedTrackCountForArtist(sharedArtists[i])
+		countJ := sharedTrackCountForArtist(sharedArtists[j])
+
+		if countI != countJ {
+			return countI > countJ
+		}
+
+		return sharedArtists[i] < sharedArtists[j]
+	})
+
+	if len(sharedArtists) > maxTopSharedArtists {
+		sharedArtists = sharedArtists[:maxTopSharedArtists]
+	}
+
+	topSharedArtists := make([]string, 0)
+
+	for _, artistKey := range sharedArtists {
+		topSharedArtists = append(topSharedArtists, profile.artistNames[artistKey])
+	}
+
+	return &UserCompatibility{
+		userId,
+		otherUserId,
+		sharedTrackCount,
+		getJaccardIndex(profile.trackIds, otherProfile.trackIds),
+		getJaccardIndex(artists, otherArtists),
+		getJaccardIndex(profile.genres, otherProfile.genres),
+		topSharedArtists,
+	}
+}
+
+// The providers do not share ids for artists, so artists are compared by name
+func getArtistKey(artist *clientcommon.Artist) string {
+	return strings.ToLower(strings.TrimSpace(artist.Name))
+}
+
+func getIntersectionCount(set map[string]bool, otherSet map[string]bool) int {
+	count := 0
+
+	for value := range set {
+		if otherSet[value] {
+			count += 1
+		}
+	}
+
+	return count
+}
+
+func getJaccardIndex(set map[string]bool, otherSet map[string]bool) float64 {
+	intersectionCount := getIntersectionCount(set, otherSet)
+	unionCount := len(set) + len(otherSet) - intersectionCount
+
+	if unionCount == 0 {
+		return 0
+	}
+
+	return float64(intersectionCount) / float64(unionCount)
+}
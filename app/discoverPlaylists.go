@@ -0,0 +1,165 @@
+package app
+
+import (
+	"github.com/shared-spotify/logger"
+	"github.com/shared-spotify/musicclient"
+	"github.com/shared-spotify/musicclient/clientcommon"
+	"sort"
+)
+
+// A playlist of songs no user has saved, recommended by spotify from what the users share the most
+
+const GeneratorDiscover = "discover"
+
+// the recommended songs are in no library, so they are shared by no user
+const discoverSharedCount = 0
+const maxDiscoverSeeds = 5 // per kind of seed, spotify then takes the first ones of each kind in turn
+const maxDiscoverTracks = 50
+
+func (playlists *CommonPlaylists) GenerateDiscoverPlaylist(generator PlaylistGenerator, sharedTrackPlaylist *Playlist) {
+	trackIds, artistIds := getDiscoverTrackAndArtistSeeds(sharedTrackPlaylist)
+	genres := playlists.getDiscoverGenreSeeds()
+
+	recommendedTracks, err := musicclient.GetRecommendations(trackIds, artistIds, genres, maxDiscoverTracks)
+
+	// the other playlists are still useful without this one
+	if err != nil {
+		logger.Logger.Errorf("Failed to get recommendations, discover playlist is not created %v", err)
+		return
+	}
+
+	discoverTracks := make([]*clientcommon.Track, 0)
+	trackAlreadyInserted := make(map[string]bool)
+
+	for _, track := range recommendedTracks {
+		isrc, ok := clientcommon.GetTrackISRC(track)
+
+		// a track without isrc cannot be stored
+		if !ok || trackAlreadyInserted[isrc] {
+			continue
+		}
+
+		// the track, or another version of it, is already in the library of a user
+		if _, ok := playlists.canonicalTracks.findCanonicalId(track); ok {
+			logger.Logger.Debugf("Recommended track %s is already in a library, skipping it", track.Name)
+			continue
+		}
+
+		discoverTracks = append(discoverTracks, track)
+		trackAlreadyInserted[isrc] = true
+	}
+
+	logger.Logger.Infof("Found %d tracks to discover out of %d recommended", len(discoverTracks),
+		len(recommendedTracks))
+
+	discoverTracksInCommon := map[int][]*clientcommon.Track{discoverSharedCount: discoverTracks}
+
+	playlists.createPlaylistForMinCount(playlistNameDiscover, generator.Type(), generator.Rank(), 1,
+		discoverTracksInCommon, 1)
+}
+
+// The tracks shared by the most users, and the artists with the most shared tracks, as spotify ids
+func getDiscoverTrackAndArtistSeeds(sharedTrackPlaylist *Playlist) ([]string, []string) {
+	type sharedTrack struct {
+		track       *clientcommon.Track
+		sharedCount int
+	}
+
+	sharedTracks := make([]sharedTrack, 0)
+
+	for sharedCount, tracks := range sharedTrackPlaylist.TracksPerSharedCount {
+		for _, track := range tracks {
+			sharedTracks = append(sharedTracks, sharedTrack{track, sharedCount})
+		}
+	}
+
+	sort.Slice(sharedTracks, func(i, j int) bool {
+		if sharedTracks[i].sharedCount != sharedTracks[j].sharedCount {
+			return sharedTracks[i].sharedCount > sharedTracks[j].sharedCount
+		}
+
+		return sharedTracks[i].track.Popularity > sharedTracks[j].track.Popularity
+	})
+
+	trackIds := make([]string, 0)
+	artistIds := make([]string, 0)
+	sharedTrackCountPerArtist := make(map[string]int)
+
+	for _, sharedTrack := range sharedTracks {
+		spotifyId, ok := sharedTrack.track.GetProviderId(clientcommon.SpotifyLoginType)
+
+		// only the tracks found on spotify can be used
+		if !ok {
+			continue
+		}
+
+		if len(trackIds) < maxDiscoverSeeds {
+			trackIds = append(trackIds, spotifyId)
+		}
+
+		for _, artist := range sharedTrack.track.Artists {
+			artistId, ok := artist.ProviderIds.Get(clientcommon.SpotifyLoginType)
+
+			if !ok {
+				continue
+			}
+
+			if _, ok := sharedTrackCountPerArtist[artistId]; !ok {
+				artistIds = append(artistIds, artistId)
+			}
+
+			sharedTrackCountPerArtist[artistId] += 1
+		}
+	}
+
+	// the order of the tracks is kept for artists with the same count
+	sort.SliceStable(artistIds, func(i, j int) bool {
+		return sharedTrackCountPerArtist[artistIds[i]] > sharedTrackCountPerArtist[artistIds[j]]
+	})
+
+	if len(artistIds) > maxDiscoverSeeds {
+		artistIds = artistIds[:maxDiscoverSeeds]
+	}
+
+	return trackIds, artistIds
+}
+
+// The genres with the most shared tracks
+func (playlists *CommonPlaylists) getDiscoverGenreSeeds() []string {
+	trackCountPerGenre := make(map[string]int)
+
+	for _, artists := range playlists.ArtistsPerTrack {
+		trackGenres := make(map[string]bool)
+
+		for _, artist := range artists {
+			for _, genre := range artist.Genres {
+				trackGenres[genre] = true
+			}
+		}
+
+		for genre := range trackGenres {
+			trackCountPerGenre[genre] += 1
+		}
+	}
+
+	genres := make([]string, 0)
+
+	for genre := range trackCountPerGenre {
+		genres = append(genres, genre)
+	}
+
+	sort.Slice(genres, func(i, j int) bool {
+		if trackCountPerGenre[genres[i]] != trackCountPerGenre[genres[j]] {
+			return trackCountPerGenre[genres[i]] > trackCountPerGenre[genres[j]]
+		}
+
+		return genres[i] < genres[j]
+	})
+
+	// spotify only accepts some genres as seeds, so we give more of them to have some left once filtered
+	if len(genres) > maxDiscoverSeeds*4 {
+		genres = genres[:maxDiscoverSeeds*4]
+	}
+
+	return genres
+}
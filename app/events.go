@@ -0,0 +1,113 @@
+package app
+
+import (
+	"github.com/shared-spotify/logger"
+	"github.com/shared-spotify/musicclient/clientcommon"
+	"sync"
+	"time"
+)
+
+// Events happening in a room, they are sent to the members of the room as they happen
+
+const RoomEventMemberJoined = "member_joined"
+const RoomEventProcessingStarted = "processing_started"
+const RoomEventFetchProgress = "fetch_progress"
+const RoomEventUserFetched = "user_fetched"
+const RoomEventGenerationPhase = "generation_phase"
+const RoomEventProcessingFinished = "processing_finished"
+const RoomEventProcessingCancelled = "processing_cancelled"
+
+// Phases of the generation of the playlists, once the songs of all users have been fetched
+const GenerationPhaseSharedTracks = "shared_tracks"
+const GenerationPhaseResolveTracks = "resolve_tracks"
+const GenerationPhaseAudioFeatures = "audio_features"
+const GenerationPhaseArtists = "artists"
+const GenerationPhaseAlbums = "albums"
+const GenerationPhasePlaylists = "playlists"
+const GenerationPhaseCompatibility = "compatibility"
+
+type RoomEvent struct {
+	Sequence  int64                  `json:"sequence" bson:"sequence"` // set once the event is stored
+	RoomId    string                 `json:"room_id" bson:"room_id"`
+	Type      string                 `json:"type" bson:"type"`
+	UserId    string                 `json:"user_id,omitempty" bson:"user_id,omitempty"`
+	Phase     string                 `json:"phase,omitempty" bson:"phase,omitempty"`
+	Progress  *clientcommon.Progress `json:"progress,omitempty" bson:"progress,omitempty"`
+	Success   *bool                  `json:"success,omitempty" bson:"success,omitempty"`
+	CreatedAt time.Time              `json:"created_at" bson:"created_at"`
+}
+
+// Called for every event published in a room, the hooks are used to store the events so any process can send them
+type RoomEventHook func(event *RoomEvent)
+
+var roomEventHooksMutex sync.RWMutex
+var roomEventHooks = make([]RoomEventHook, 0)
+
+func RegisterRoomEventHook(hook RoomEventHook) {
+	roomEventHooksMutex.Lock()
+	defer roomEventHooksMutex.Unlock()
+
+	roomEventHooks = append(roomEventHooks, hook)
+}
+
+func PublishRoomEvent(event *RoomEvent) {
+	event.CreatedAt = time.Now()
+
+	logger.WithRoom(event.RoomId).Debugf("Publishing room event %s", event.Type)
+
+	roomEventHooksMutex.RLock()
+	defer roomEventHooksMutex.RUnlock()
+
+	for _, hook := range roomEventHooks {
+		hook(event)
+	}
+}
+
+func PublishMemberJoined(roomId string, user *clientcommon.User) {
+	PublishRoomEvent(&RoomEvent{RoomId: roomId, Type: RoomEventMemberJoined, UserId: user.GetId()})
+}
+
+func PublishProcessingStarted(roomId string) {
+	PublishRoomEvent(&RoomEvent{RoomId: roomId, Type: RoomEventProcessingStarted})
+}
+
+func PublishProcessingFinished(roomId string, success bool) {
+	PublishRoomEvent(&RoomEvent{RoomId: roomId, Type: RoomEventProcessingFinished, Success: &success})
+}
+
+func PublishProcessingCancelled(roomId string) {
+	PublishRoomEvent(&RoomEvent{RoomId: roomId, Type: RoomEventProcessingCancelled})
+}
+
+// Progress hook publishing the progress of the fetching of the songs of a user
+func fetchProgressHook(roomId string, user *clientcommon.User) clientcommon.ProgressHook {
+	return func(progress *clientcommon.Progress) {
+		PublishRoomEvent(&RoomEvent{
+			RoomId:   roomId,
+			Type:     RoomEventFetchProgress,
+			UserId:   user.GetId(),
+			Progress: progress,
+		})
+	}
+}
+
+// Hook publishing the phases and progress of the generation of the playlists
+func generationPhaseHook(roomId string) (func(phase string), clientcommon.ProgressHook) {
+	currentPhase := ""
+
+	onPhase := func(phase string) {
+		currentPhase = phase
+		PublishRoomEvent(&RoomEvent{RoomId: roomId, Type: RoomEventGenerationPhase, Phase: phase})
+	}
+
+	onProgress := func(progress *clientcommon.Progress) {
+		PublishRoomEvent(&RoomEvent{
+			RoomId:   roomId,
+			Type:     RoomEventGenerationPhase,
+			Phase:    currentPhase,
+			Progress: progress,
+		})
+	}
+
+	return onPhase, onProgress
+}
@@ -0,0 +1,105 @@
+package app
+
+import (
+	"github.com/shared-spotify/logger"
+	"github.com/shared-spotify/musicclient"
+	"github.com/shared-spotify/musicclient/clientcommon"
+)
+
+// The explicit tracks can be excluded from the exported playlists, for the whole room when it is family safe or for a
+// single export. An explicit track is swapped for the clean version of the same song when the catalog has one
+
+const cleanVersionSearchLimit = 10
+
+// each search is a call to the catalog, past this the explicit tracks of an export are removed without searching
+const maxCleanVersionSearches = 50
+
+// the search of the catalog, replaced in the tests
+var searchTracks = musicclient.SearchTracks
+
+type ExplicitFilterReport struct {
+	RemovedCount int `json:"removed_count"` // explicit tracks with no clean version
+	SwappedCount int `json:"swapped_count"` // explicit tracks replaced by their clean version
+}
+
+// The tracks are filtered one by one while they are selected, so only the tracks that could be added are searched
+type ExplicitFilter struct {
+	Report *ExplicitFilterReport
+	// the clean versions found only count as swapped once selected, they might not fit or already be in the playlist
+	cleanTracks map[*clientcommon.Track]bool
+	searchCount int
+}
+
+func NewExplicitFilter() *ExplicitFilter {
+	return &ExplicitFilter{&ExplicitFilterReport{}, make(map[*clientcommon.Track]bool), 0}
+}
+
+// Returns the track, or its clean version when it is explicit, and nil when it has none
+func (filter *ExplicitFilter) FilterTrack(track *clientcommon.Track) *clientcommon.Track {
+	if track.Explicit {
+		var cleanTrack *clientcommon.Track
+
+		if filter.searchCount < maxCleanVersionSearches {
+			filter.searchCount += 1
+			cleanTrack = findCleanVersion(track)
+		} else {
+			logger.Logger.Debugf("Max searches reached, explicit track %s is removed without searching", track.Name)
+		}
+
+		if cleanTrack == nil {
+			filter.Report.RemovedCount += 1
+			return nil
+		}
+
+		filter.cleanTracks[cleanTrack] = true
+		return cleanTrack
+	}
+
+	return track
+}
+
+// Counts the clean versions swapped in among the tracks selected
+func (filter *ExplicitFilter) ReportSelectedTracks(tracks []*clientcommon.Track) {
+	filter.Report.SwappedCount = 0
+
+	for _, track := range tracks {
+		if filter.cleanTracks[track] {
+			filter.Report.SwappedCount += 1
+		}
+	}
+}
+
+// The clean version is a non explicit track of the catalog with the same title and primary artist
+func findCleanVersion(track *clientcommon.Track) *clientcommon.Track {
+	recordingKey := getRecordingKey(track)
+
+	if recordingKey == "" {
+		return nil
+	}
+
+	candidates, err := searchTracks(normaliseTitle(track.Name), normaliseArtist(track.Artists[0].Name),
+		cleanVersionSearchLimit)
+
+	if err != nil {
+		// the track is removed, a search failing should not fail the export
+		logger.Logger.Warningf("Failed to search the clean version of track %s by %s %v", track.Name, track.Artists[0].Name,
+			err)
+		return nil
+	}
+
+	for _, candidate := range candidates {
+		if candidate.Explicit {
+			continue
+		}
+
+		if _, ok := clientcommon.GetTrackISRC(candidate); !ok {
+			continue
+		}
+
+		if getRecordingKey(candidate) == recordingKey {
+			return candidate
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,159 @@
+package app
+
+import (
+	"github.com/shared-spotify/musicclient/clientcommon"
+	"strings"
+	"testing"
+)
+
+// Replaces the search of the catalog by the clean versions given per title, for the duration of the test
+func setCleanVersions(t *testing.T, cleanVersions map[string]*clientcommon.Track) *int {
+	searchCount := 0
+	previousSearchTracks := searchTracks
+
+	searchTracks = func(name string, artist string, limit int) ([]*clientcommon.Track, error) {
+		searchCount += 1
+
+		if cleanVersion, ok := cleanVersions[name]; ok {
+			return []*clientcommon.Track{cleanVersion}, nil
+		}
+
+		return []*clientcommon.Track{}, nil
+	}
+
+	t.Cleanup(func() {
+		searchTracks = previousSearchTracks
+	})
+
+	return &searchCount
+}
+
+func newExplicitTestTrack(title string, isrc string, explicit bool, minutes int) *clientcommon.Track {
+	track := newCanonicalTestTrack(title, "Artist", minutes*minuteMs)
+	track.Isrc = isrc
+	track.Explicit = explicit
+
+	return track
+}
+
+func TestExplicitFilterFilterTrack(t *testing.T) {
+	cleanVersion := newExplicitTestTrack("Song", "CLEAN1", false, 3)
+
+	tests := []struct {
+		name     string
+		track    *clientcommon.Track
+		expected *clientcommon.Track
+		removed  int
+	}{
+		{"not explicit", cleanVersion, cleanVersion, 0},
+		{"explicit with a clean version", newExplicitTestTrack("Song", "ISRC1", true, 3), cleanVersion, 0},
+		{"explicit without clean version", newExplicitTestTrack("Other song", "ISRC2", true, 3), nil, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setCleanVersions(t, map[string]*clientcommon.Track{"song": cleanVersion})
+			filter := NewExplicitFilter()
+
+			if track := filter.FilterTrack(test.track); track != test.expected {
+				t.Errorf("Expected %v, got %v", test.expected, track)
+			}
+
+			if filter.Report.RemovedCount != test.removed {
+				t.Errorf("Expected %d removed, got %d", test.removed, filter.Report.RemovedCount)
+			}
+
+			// a track only counts as swapped once it is selected
+			if filter.Report.SwappedCount != 0 {
+				t.Errorf("Expected no track swapped before the selection, got %d", filter.Report.SwappedCount)
+			}
+		})
+	}
+}
+
+func TestExplicitFilterMaxSearches(t *testing.T) {
+	searchCount := setCleanVersions(t, map[string]*clientcommon.Track{})
+	filter := NewExplicitFilter()
+
+	for i := 0; i < maxCleanVersionSearches+5; i++ {
+		filter.FilterTrack(newExplicitTestTrack("Song", "ISRC1", true, 3))
+	}
+
+	if *searchCount != maxCleanVersionSearches {
+		t.Errorf("Expected %d searches, got %d", maxCleanVersionSearches, *searchCount)
+	}
+
+	if filter.Report.RemovedCount != maxCleanVersionSearches+5 {
+		t.Errorf("Expected all the tracks to be removed, got %d", filter.Report.RemovedCount)
+	}
+}
+
+func TestExplicitFilterReportSelectedTracks(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  PlaylistDurationOptions
+		tracks   []*clientcommon.Track
+		expected string
+		swapped  int
+	}{
+		{
+			"clean version selected",
+			PlaylistDurationOptions{},
+			[]*clientcommon.Track{
+				newExplicitTestTrack("Song", "ISRC1", true, 3),
+				newExplicitTestTrack("Other song", "ISRC2", false, 3),
+			},
+			"CLEAN1,ISRC2",
+			1,
+		},
+		{
+			"clean version already in the playlist",
+			PlaylistDurationOptions{},
+			[]*clientcommon.Track{
+				newExplicitTestTrack("Song", "CLEAN1", false, 3),
+				newExplicitTestTrack("Song", "ISRC1", true, 3),
+			},
+			"CLEAN1",
+			0,
+		},
+		{
+			"clean version too long to fit",
+			PlaylistDurationOptions{5 * minuteMs, 0, 0},
+			[]*clientcommon.Track{
+				newExplicitTestTrack("Song", "ISRC1", true, 3),
+				newExplicitTestTrack("Other song", "ISRC2", false, 3),
+			},
+			"ISRC2",
+			0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// the clean version is longer than the explicit one
+			setCleanVersions(t, map[string]*clientcommon.Track{"song": newExplicitTestTrack("Song", "CLEAN1", false, 6)})
+			filter := NewExplicitFilter()
+
+			selectedTracks, err := test.options.SelectTracks(test.tracks, filter.FilterTrack)
+
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+
+			filter.ReportSelectedTracks(selectedTracks)
+			isrcs := make([]string, 0)
+
+			for _, track := range selectedTracks {
+				isrcs = append(isrcs, track.Isrc)
+			}
+
+			if strings.Join(isrcs, ",") != test.expected {
+				t.Errorf("Expected tracks %s, got %s", test.expected, strings.Join(isrcs, ","))
+			}
+
+			if filter.Report.SwappedCount != test.swapped {
+				t.Errorf("Expected %d swapped, got %d", test.swapped, filter.Report.SwappedCount)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package app
+
+import (
+	"errors"
+	"github.com/shared-spotify/logger"
+)
+
+// The playlists of a room, apart from the shared one, are created by the generators, which run once the infos on the
+// shared tracks were gathered. Adding a new kind of playlist only needs a new generator to be registered
+
+const GeneratorPopularity = "popularity"
+const GeneratorMusicPeriod = "music_period"
+const GeneratorGenre = "genre"
+
+var ErrorUnknownPlaylistGenerator = errors.New("Unknown playlist generator")
+
+type PlaylistGenerator interface {
+	// The name used by rooms to choose the generators to run
+	Name() string
+	// The type and rank of all the playlists created, the generate function is given the generator to use them
+	Type() string
+	Rank() int
+	// Creates the playlists from the shared tracks, the infos gathered are in the computation of the playlists
+	Generate(playlists *CommonPlaylists, sharedTrackPlaylist *Playlist)
+}
+
+type playlistGenerator struct {
+	name     string
+	type_    string
+	rank     int
+	generate func(playlists *CommonPlaylists, generator PlaylistGenerator, sharedTrackPlaylist *Playlist)
+}
+
+func NewPlaylistGenerator(name string, type_ string, rank int,
+	generate func(playlists *CommonPlaylists, generator PlaylistGenerator,
+		sharedTrackPlaylist *Playlist)) PlaylistGenerator {
+	return &playlistGenerator{name, type_, rank, generate}
+}
+
+func (generator *playlistGenerator) Name() string {
+	return generator.name
+}
+
+func (generator *playlistGenerator) Type() string {
+	return generator.type_
+}
+
+func (generator *playlistGenerator) Rank() int {
+	return generator.rank
+}
+
+func (generator *playlistGenerator) Generate(playlists *CommonPlaylists, sharedTrackPlaylist *Playlist) {
+	generator.generate(playlists, generator, sharedTrackPlaylist)
+}
+
+// All the generators by name
+var playlistGenerators = make(map[string]PlaylistGenerator)
+
+// Keep the order of registration, the generators run in this order
+var playlistGeneratorNames = make([]string, 0)
+
+func init() {
+	RegisterPlaylistGenerator(NewPlaylistGenerator(GeneratorPopularity, playlistTypePopularity, playlistRankPopular,
+		(*CommonPlaylists).GeneratePopularityPlaylistType))
+	RegisterPlaylistGenerator(NewPlaylistGenerator(GeneratorDance, playlistTypeDance, playlistRankDance,
+		(*CommonPlaylists).GenerateDancePlaylist))
+	RegisterPlaylistGenerator(NewPlaylistGenerator(GeneratorMusicPeriod, playlistTypePeriod, playlistRankMusicPeriod,
+		(*CommonPlaylists).GenerateMusicPeriodPlaylistType))
+	RegisterPlaylistGenerator(NewPlaylistGenerator(GeneratorGenre, playlistTypeGenre, playlistRankGenre,
+		(*CommonPlaylists).GenerateGenrePlaylists))
+	RegisterPlaylistGenerator(NewPlaylistGenerator(GeneratorEnergy, playlistTypeEnergy, playlistRankEnergy,
+		(*CommonPlaylists).GenerateEnergyPlaylists))
+	RegisterPlaylistGenerator(NewPlaylistGenerator(GeneratorMood, playlistTypeMood, playlistRankMood,
+		(*CommonPlaylists).GenerateMoodPlaylists))
+	RegisterPlaylistGenerator(NewPlaylistGenerator(GeneratorTempo, playlistTypeTempo, playlistRankTempo,
+		(*CommonPlaylists).GenerateTempoPlaylists))
+	RegisterPlaylistGenerator(NewPlaylistGenerator(GeneratorArtistOverlap, playlistTypeArtistOverlap,
+		playlistRankArtistOverlap, (*CommonPlaylists).GenerateArtistOverlapPlaylist))
+	RegisterPlaylistGenerator(NewPlaylistGenerator(GeneratorAlbumOverlap, playlistTypeAlbumOverlap,
+		playlistRankAlbumOverlap, (*CommonPlaylists).GenerateAlbumOverlapPlaylist))
+	RegisterPlaylistGenerator(NewPlaylistGenerator(GeneratorDiscover, playlistTypeDiscover, playlistRankDiscover,
+		(*CommonPlaylists).GenerateDiscoverPlaylist))
+}
+
+func RegisterPlaylistGenerator(generator PlaylistGenerator) {
+	name := generator.Name()
+
+	if _, ok := playlistGenerators[name]; ok {
+		logger.Logger.Fatalf("Playlist generator %s registered twice", name)
+	}
+
+	playlistGenerators[name] = generator
+	playlistGeneratorNames = append(playlistGeneratorNames, name)
+}
+
+func GetPlaylistGenerator(name string) (PlaylistGenerator, bool) {
+	generator, ok := playlistGenerators[name]
+	return generator, ok
+}
+
+func GetPlaylistGenerators() []PlaylistGenerator {
+	generators := make([]PlaylistGenerator, 0, len(playlistGeneratorNames))
+
+	for _, name := range playlistGeneratorNames {
+		generators = append(generators, playlistGenerators[name])
+	}
+
+	return generators
+}
+
+// Returns the generators with the names given, in the order they run
+func getPlaylistGeneratorsWithNames(names []string) []PlaylistGenerator {
+	generators := make([]PlaylistGenerator, 0)
+
+	for _, generator := range GetPlaylistGenerators() {
+		for _, name := range names {
+			if generator.Name() == name {
+				generators = append(generators, generator)
+				break
+			}
+		}
+	}
+
+	return generators
+}
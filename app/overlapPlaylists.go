@@ -0,0 +1,179 @@
+package app
+
+import (
+	"errors"
+	"github.com/shared-spotify/logger"
+	"github.com/shared-spotify/musicclient"
+	"github.com/shared-spotify/musicclient/clientcommon"
+	"strings"
+)
+
+// Playlists made from the artists and albums the users have in common, even when they saved different songs of them
+// These use the whole library of each user and not only the shared tracks
+
+const GeneratorArtistOverlap = "artist_overlap"
+const GeneratorAlbumOverlap = "album_overlap"
+
+var ErrorInvalidOverlapThresholds = errors.New("Invalid overlap thresholds, the min shared users must be at " +
+	"least 2 and the min track count cannot be negative")
+
+// A threshold left to 0 uses the default one
+type OverlapThresholds struct {
+	MinSharedUsers int `json:"min_shared_users"` // min number of users having an artist or album for it to be included
+	MinTrackCount  int `json:"min_track_count"`  // min count to have a playlist to be included
+}
+
+var DefaultOverlapThresholds = OverlapThresholds{
+	MinSharedUsers: minNumberOfUserForCommonMusic,
+	MinTrackCount:  5,
+}
+
+func (thresholds *OverlapThresholds) Validate() error {
+	if thresholds.MinSharedUsers < 0 || thresholds.MinSharedUsers == 1 || thresholds.MinTrackCount < 0 {
+		return ErrorInvalidOverlapThresholds
+	}
+
+	return nil
+}
+
+func (thresholds *OverlapThresholds) withDefaults() OverlapThresholds {
+	withDefaults := DefaultOverlapThresholds
+
+	if thresholds == nil {
+		return withDefaults
+	}
+
+	if thresholds.MinSharedUsers != 0 {
+		withDefaults.MinSharedUsers = thresholds.MinSharedUsers
+	}
+
+	if thresholds.MinTrackCount != 0 {
+		withDefaults.MinTrackCount = thresholds.MinTrackCount
+	}
+
+	return withDefaults
+}
+
+func (playlists *CommonPlaylists) GenerateArtistOverlapPlaylist(generator PlaylistGenerator,
+	sharedTrackPlaylist *Playlist) {
+	playlists.generateOverlapPlaylist(playlistNameArtistOverlap, generator.Type(), generator.Rank(),
+		getTrackArtistKeys)
+}
+
+func (playlists *CommonPlaylists) GenerateAlbumOverlapPlaylist(generator PlaylistGenerator,
+	sharedTrackPlaylist *Playlist) {
+	playlists.generateOverlapPlaylist(playlistNameAlbumOverlap, generator.Type(), generator.Rank(),
+		getTrackAlbumKeys)
+}
+
+func (playlists *CommonPlaylists) generateOverlapPlaylist(name string, type_ string, rank int,
+	getKeys func(track *clientcommon.Track) []string) {
+	thresholds := playlists.Options.GetOverlapThresholds()
+
+	tracksInCommon, userIdsPerTrack := playlists.getTracksWithOverlap(getKeys, thresholds.MinSharedUsers)
+
+	if getTracksInCommonCount(tracksInCommon) < thresholds.MinTrackCount {
+		return
+	}
+
+	// only the shared tracks were resolved, the others need their spotify infos to be ranked and exported
+	tracks := make([]*clientcommon.Track, 0)
+
+	for _, tracksPart := range tracksInCommon {
+		tracks = append(tracks, tracksPart...)
+	}
+
+	err := musicclient.ResolveTracks(tracks, nil)
+
+	// the other playlists are still useful without this one
+	if err != nil {
+		logger.Logger.Errorf("Failed to resolve the tracks, playlist %s is not created %v", name, err)
+		return
+	}
+
+	playlists.createPlaylistWithOwnUserIds(name, type_, rank, 1, tracksInCommon, userIdsPerTrack)
+}
+
+// Returns the tracks of the users whose artist or album, given by getKeys, is in the library of at least
+// minSharedUsers users. A track is placed under the number of users sharing its most shared artist or album
+// The ids of the users who saved each track are returned too, most of the tracks are not shared so they are
+// not in the user ids of the shared tracks
+func (playlists *CommonPlaylists) getTracksWithOverlap(getKeys func(track *clientcommon.Track) []string,
+	minSharedUsers int) (map[int][]*clientcommon.Track, map[string][]string) {
+	usersPerKey := make(map[string]map[string]bool)
+
+	for userId, tracks := range playlists.TracksPerUser {
+		for _, track := range tracks {
+			for _, key := range getKeys(track) {
+				users, ok := usersPerKey[key]
+
+				if !ok {
+					users = make(map[string]bool)
+					usersPerKey[key] = users
+				}
+
+				users[userId] = true
+			}
+		}
+	}
+
+	sharedCountPerTrack := make(map[string]int)
+
+	for _, tracks := range playlists.TracksPerUser {
+		for _, track := range tracks {
+			isrc, ok := playlists.getTrackId(track)
+
+			if !ok {
+				continue
+			}
+
+			for _, key := range getKeys(track) {
+				sharedCount := len(usersPerKey[key])
+
+				if sharedCount >= minSharedUsers && sharedCount > sharedCountPerTrack[isrc] {
+					sharedCountPerTrack[isrc] = sharedCount
+				}
+			}
+		}
+	}
+
+	tracksInCommon := make(map[int][]*clientcommon.Track)
+	userIdsPerTrack := make(map[string][]string)
+
+	for isrc, sharedCount := range sharedCountPerTrack {
+		tracksInCommon[sharedCount] = append(tracksInCommon[sharedCount], playlists.SharedTracks[isrc])
+
+		// keep who saved the track, even if alone, so we can in the frontend keep record of who liked the song
+		userIds := make([]string, 0)
+		for _, user := range playlists.SharedTracksRank[isrc] {
+			userIds = append(userIds, user.GetId())
+		}
+		userIdsPerTrack[isrc] = userIds
+	}
+
+	logger.Logger.Infof("Found %d tracks with %d different artists or albums across users",
+		len(sharedCountPerTrack), len(usersPerKey))
+
+	return tracksInCommon, userIdsPerTrack
+}
+
+func getTrackArtistKeys(track *clientcommon.Track) []string {
+	keys := make([]string, 0)
+
+	for _, artist := range track.Artists {
+		keys = append(keys, getArtistKey(artist))
+	}
+
+	return keys
+}
+
+// Albums with the same name exist for different artists, so the album is identified with its first artist too
+func getTrackAlbumKeys(track *clientcommon.Track) []string {
+	if track.Album == nil || track.Album.Name == "" || len(track.Artists) == 0 {
+		return []string{}
+	}
+
+	albumName := strings.ToLower(strings.TrimSpace(track.Album.Name))
+
+	return []string{getArtistKey(track.Artists[0]) + "|" + albumName}
+}
@@ -0,0 +1,179 @@
+package app
+
+import (
+	"errors"
+	"github.com/shared-spotify/musicclient/clientcommon"
+	"sort"
+)
+
+// The exported playlists can be made to last a given duration, like for a road trip or a party. The best tracks by
+// score are chosen as long as they fit in the duration, and the tracks too long are skipped for shorter ones
+
+var ErrorInvalidDurationOptions = errors.New("Invalid duration options, they cannot be negative, the min track " +
+	"count cannot be above the max track count and it needs a target duration")
+var ErrorDurationTooShort = errors.New("The target duration is too short to have the min track count")
+
+// An option left to 0 is not used, the min track count can only be given with a target duration
+type PlaylistDurationOptions struct {
+	TargetDuration int `json:"target_duration_ms"`
+	MinTrackCount  int `json:"min_track_count"`
+	MaxTrackCount  int `json:"max_track_count"`
+}
+
+func (options *PlaylistDurationOptions) Validate() error {
+	if options.TargetDuration < 0 || options.MinTrackCount < 0 || options.MaxTrackCount < 0 {
+		return ErrorInvalidDurationOptions
+	}
+
+	if options.MaxTrackCount != 0 && options.MinTrackCount > options.MaxTrackCount {
+		return ErrorInvalidDurationOptions
+	}
+
+	// the min track count would be silently ignored
+	if options.TargetDuration == 0 && options.MinTrackCount != 0 {
+		return ErrorInvalidDurationOptions
+	}
+
+	return nil
+}
+
+// Returns the track to add in place of the one given, nil to skip it
+type TrackFilter func(track *clientcommon.Track) *clientcommon.Track
+
+// Returns the tracks chosen for the duration, the tracks are expected to be in the order of their score
+// The filter, when not nil, is only called for the tracks that could be chosen, and the selection stops once the
+// max track count is reached. A track given by the filter that is already chosen is skipped
+func (options *PlaylistDurationOptions) SelectTracks(tracks []*clientcommon.Track,
+	filter TrackFilter) ([]*clientcommon.Track, error) {
+	if filter == nil {
+		filter = func(track *clientcommon.Track) *clientcommon.Track {
+			return track
+		}
+	}
+
+	selectedTracks := make([]*clientcommon.Track, 0)
+	selectedIsrcs := make(map[string]bool)
+
+	// the filter can give the same track for several tracks, like the clean version of a song already chosen
+	isSelected := func(track *clientcommon.Track) bool {
+		isrc, ok := clientcommon.GetTrackISRC(track)
+		return ok && selectedIsrcs[isrc]
+	}
+
+	selectTrack := func(track *clientcommon.Track) {
+		if isrc, ok := clientcommon.GetTrackISRC(track); ok {
+			selectedIsrcs[isrc] = true
+		}
+
+		selectedTracks = append(selectedTracks, track)
+	}
+
+	if options.TargetDuration == 0 {
+		for _, track := range tracks {
+			if options.MaxTrackCount != 0 && len(selectedTracks) == options.MaxTrackCount {
+				break
+			}
+
+			if track = filter(track); track != nil && !isSelected(track) {
+				selectTrack(track)
+			}
+		}
+
+		return selectedTracks, nil
+	}
+
+	// the shortest tracks are used to know if the min track count can still be reached
+	durations := make([]int, 0)
+
+	for _, track := range tracks {
+		durations = append(durations, track.Duration)
+	}
+
+	sort.Ints(durations)
+
+	if len(durations) < options.MinTrackCount || sumDurations(durations[:options.MinTrackCount]) > options.TargetDuration {
+		return nil, ErrorDurationTooShort
+	}
+
+	selected := make([]bool, len(tracks))
+	duration := 0
+
+	for i, track := range tracks {
+		if options.MaxTrackCount != 0 && len(selectedTracks) == options.MaxTrackCount {
+			break
+		}
+
+		if duration+track.Duration > options.TargetDuration {
+			continue
+		}
+
+		// the track is skipped if the tracks still needed for the min track count would no longer fit
+		missingTrackCount := options.MinTrackCount - len(selectedTracks) - 1
+		minMissingDuration := getShortestDuration(tracks, selected, i, missingTrackCount)
+
+		if duration+track.Duration+minMissingDuration > options.TargetDuration {
+			continue
+		}
+
+		// the track given in place of this one can have another duration, so it needs to fit too
+		track = filter(track)
+
+		if track == nil || isSelected(track) || duration+track.Duration+minMissingDuration > options.TargetDuration {
+			continue
+		}
+
+		selectTrack(track)
+		selected[i] = true
+		duration += track.Duration
+	}
+
+	// the tracks removed by the filter were counted on to reach the min track count
+	if len(selectedTracks) < options.MinTrackCount {
+		return nil, ErrorDurationTooShort
+	}
+
+	return selectedTracks, nil
+}
+
+// Returns the duration of the shortest tracks not selected yet, without the track at the index excluded
+func getShortestDuration(tracks []*clientcommon.Track, selected []bool, excludedIndex int, trackCount int) int {
+	if trackCount <= 0 {
+		return 0
+	}
+
+	durations := make([]int, 0)
+
+	for i, track := range tracks {
+		if !selected[i] && i != excludedIndex {
+			durations = append(durations, track.Duration)
+		}
+	}
+
+	sort.Ints(durations)
+
+	if trackCount > len(durations) {
+		trackCount = len(durations)
+	}
+
+	return sumDurations(durations[:trackCount])
+}
+
+func GetTracksDuration(tracks []*clientcommon.Track) int {
+	duration := 0
+
+	for _, track := range tracks {
+		duration += track.Duration
+	}
+
+	return duration
+}
+
+func sumDurations(durations []int) int {
+	sum := 0
+
+	for _, duration := range durations {
+		sum += duration
+	}
+
+	return sum
+}
@@ -0,0 +1,153 @@
+package app
+
+import (
+	"github.com/shared-spotify/musicclient/clientcommon"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const minuteMs = 60000
+
+func TestPlaylistDurationOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name        string
+		options     PlaylistDurationOptions
+		expectError bool
+	}{
+		{"no options", PlaylistDurationOptions{}, false},
+		{"all options", PlaylistDurationOptions{60 * minuteMs, 5, 10}, false},
+		{"max track count only", PlaylistDurationOptions{0, 0, 10}, false},
+		{"negative duration", PlaylistDurationOptions{-1, 0, 0}, true},
+		{"negative count", PlaylistDurationOptions{60 * minuteMs, -1, 0}, true},
+		{"min above max", PlaylistDurationOptions{60 * minuteMs, 10, 5}, true},
+		{"min track count without duration", PlaylistDurationOptions{0, 5, 10}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.options.Validate()
+
+			if test.expectError && err != ErrorInvalidDurationOptions {
+				t.Errorf("Expected invalid duration options, got %v", err)
+			}
+
+			if !test.expectError && err != nil {
+				t.Errorf("Unexpected error %v", err)
+			}
+		})
+	}
+}
+
+func TestSelectTracks(t *testing.T) {
+	// the tracks are in the order of their score, named after their duration in minutes
+	tracks := newDurationTestTracks(4, 3, 5, 1, 2)
+
+	tests := []struct {
+		name        string
+		options     PlaylistDurationOptions
+		expected    string
+		expectError error
+	}{
+		{"no options", PlaylistDurationOptions{}, "4,3,5,1,2", nil},
+		{"max track count", PlaylistDurationOptions{0, 0, 2}, "4,3", nil},
+		{"all tracks fit", PlaylistDurationOptions{15 * minuteMs, 0, 0}, "4,3,5,1,2", nil},
+		{"too long tracks are skipped", PlaylistDurationOptions{8 * minuteMs, 0, 0}, "4,3,1", nil},
+		{"max track count with duration", PlaylistDurationOptions{8 * minuteMs, 0, 1}, "4", nil},
+		// the track of 3 minutes is skipped so 3 tracks fit in the duration
+		{"min track count", PlaylistDurationOptions{7 * minuteMs, 3, 0}, "4,1,2", nil},
+		{"min track count reached", PlaylistDurationOptions{10 * minuteMs, 4, 0}, "4,3,1,2", nil},
+		{"min track count keeps shorter tracks", PlaylistDurationOptions{9 * minuteMs, 3, 0}, "4,3,1", nil},
+		{"too short for the min track count", PlaylistDurationOptions{2 * minuteMs, 2, 0}, "", ErrorDurationTooShort},
+		{"not enough tracks", PlaylistDurationOptions{60 * minuteMs, 6, 0}, "", ErrorDurationTooShort},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			selectedTracks, err := test.options.SelectTracks(tracks, nil)
+
+			if err != test.expectError {
+				t.Fatalf("Expected error %v, got %v", test.expectError, err)
+			}
+
+			if err == nil && getDurationTestTrackNames(selectedTracks) != test.expected {
+				t.Errorf("Expected tracks %s, got %s", test.expected, getDurationTestTrackNames(selectedTracks))
+			}
+		})
+	}
+}
+
+func TestSelectTracksWithFilter(t *testing.T) {
+	tracks := newDurationTestTracks(4, 3, 5, 1, 2)
+	filteredTracks := make([]string, 0)
+
+	// the track of 3 minutes is removed and the one of 1 minute is swapped for one of 6 minutes
+	filter := func(track *clientcommon.Track) *clientcommon.Track {
+		filteredTracks = append(filteredTracks, track.Name)
+
+		switch track.Name {
+		case "3":
+			return nil
+		case "1":
+			return newDurationTestTracks(6)[0]
+		}
+
+		return track
+	}
+
+	selectedTracks, err := (&PlaylistDurationOptions{10 * minuteMs, 0, 2}).SelectTracks(tracks, filter)
+
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if names := getDurationTestTrackNames(selectedTracks); names != "4,5" {
+		t.Errorf("Expected tracks 4,5, got %s", names)
+	}
+
+	// the selection stops at the max track count, the tracks after are never filtered
+	if names := strings.Join(filteredTracks, ","); names != "4,3,5" {
+		t.Errorf("Expected tracks 4,3,5 to be filtered, got %s", names)
+	}
+
+	selectedTracks, err = (&PlaylistDurationOptions{10 * minuteMs, 0, 0}).SelectTracks(tracks, filter)
+
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	// the track swapped is too long to fit anymore
+	if names := getDurationTestTrackNames(selectedTracks); names != "4,5" {
+		t.Errorf("Expected tracks 4,5, got %s", names)
+	}
+
+	_, err = (&PlaylistDurationOptions{10 * minuteMs, 3, 0}).SelectTracks(tracks, filter)
+
+	if err != ErrorDurationTooShort {
+		t.Errorf("Expected the min track count to fail once the tracks are filtered, got %v", err)
+	}
+}
+
+func newDurationTestTracks(minutes ...int) []*clientcommon.Track {
+	tracks := make([]*clientcommon.Track, 0)
+
+	for _, minute := range minutes {
+		tracks = append(tracks, &clientcommon.Track{
+			Isrc:     "ISRC" + strconv.Itoa(minute),
+			Name:     strconv.Itoa(minute),
+			Duration: minute * minuteMs,
+		})
+	}
+
+	return tracks
+}
+
+func getDurationTestTrackNames(tracks []*clientcommon.Track) string {
+	names := make([]string, 0)
+
+	for _, track := range tracks {
+		names = append(names, track.Name)
+	}
+
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,227 @@
+package app
+
+import (
+	"errors"
+	"github.com/shared-spotify/logger"
+	"github.com/shared-spotify/musicclient"
+	"github.com/shared-spotify/musicclient/clientcommon"
+	"math"
+)
+
+// The order of the tracks of an exported playlist. By default they are in the order of their score, the smooth order
+// chains them so each track mixes well with the previous one: a key close on the camelot wheel, a close tempo and an
+// energy following the chosen curve
+
+const PlaylistOrderScore = "score"
+const PlaylistOrderSmooth = "smooth"
+
+const EnergyCurveSteady = "steady"      // the energy changes as little as possible
+const EnergyCurveWarmUp = "warm_up"     // the energy rises from the calmest to the most energetic tracks
+const EnergyCurvePeak = "peak"          // the energy rises until the middle of the playlist, then falls
+const EnergyCurveCoolDown = "cool_down" // the energy falls from the most energetic to the calmest tracks
+
+var ErrorUnknownPlaylistOrder = errors.New("Unknown playlist order, it must be score or smooth")
+var ErrorUnknownEnergyCurve = errors.New("Unknown energy curve, it must be steady, warm_up, peak or cool_down")
+
+// the weights of the differences between two tracks when choosing the next one
+const harmonicDistanceWeight = 1.0 // per step on the camelot wheel
+const tempoDistanceWeight = 10.0   // per relative difference of tempo
+const energyDistanceWeight = 4.0   // for the whole energy range
+
+const unknownKeyHarmonicDistance = 2
+const camelotWheelSize = 12
+
+func ValidatePlaylistOrder(order string, energyCurve string) error {
+	if order != "" && order != PlaylistOrderScore && order != PlaylistOrderSmooth {
+		return ErrorUnknownPlaylistOrder
+	}
+
+	if energyCurve != "" && energyCurve != EnergyCurveSteady && energyCurve != EnergyCurveWarmUp &&
+		energyCurve != EnergyCurvePeak && energyCurve != EnergyCurveCoolDown {
+		return ErrorUnknownEnergyCurve
+	}
+
+	return nil
+}
+
+// Returns the tracks in the order requested, the tracks are expected to be in the order of their score
+func OrderTracks(tracks []*clientcommon.Track, order string, energyCurve string) ([]*clientcommon.Track, error) {
+	if order != PlaylistOrderSmooth {
+		return tracks, nil
+	}
+
+	audioFeaturesPerTrack, err := musicclient.GetAudioFeatures(tracks)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return orderTracksSmoothly(tracks, audioFeaturesPerTrack, energyCurve), nil
+}
+
+// The tracks are chained greedily, the next track is always the closest one to the last track chosen
+// The tracks without audio features cannot be chained, they are added at the end in the order of their score
+func orderTracksSmoothly(tracks []*clientcommon.Track, audioFeaturesPerTrack map[string]*clientcommon.AudioFeatures,
+	energyCurve string) []*clientcommon.Track {
+	remainingTracks := make([]*clientcommon.Track, 0)
+	tracksWithoutFeatures := make([]*clientcommon.Track, 0)
+
+	minEnergy := math.MaxFloat64
+	maxEnergy := 0.0
+
+	for _, track := range tracks {
+		audioFeatures := getTrackAudioFeatures(track, audioFeaturesPerTrack)
+
+		if audioFeatures == nil {
+			tracksWithoutFeatures = append(tracksWithoutFeatures, track)
+			continue
+		}
+
+		remainingTracks = append(remainingTracks, track)
+		minEnergy = math.Min(minEnergy, float64(audioFeatures.Energy))
+		maxEnergy = math.Max(maxEnergy, float64(audioFeatures.Energy))
+	}
+
+	logger.Logger.Infof("Ordering %d tracks smoothly with energy curve %s, %d tracks have no audio features",
+		len(remainingTracks), energyCurve, len(tracksWithoutFeatures))
+
+	energyRange := maxEnergy - minEnergy
+	orderedTracks := make([]*clientcommon.Track, 0)
+	var previousFeatures *clientcommon.AudioFeatures
+
+	for position := 0; len(remainingTracks) > 0; position++ {
+		targetEnergy, hasTarget := getTargetEnergy(energyCurve, position, len(tracks)-len(tracksWithoutFeatures),
+			minEnergy, maxEnergy)
+
+		bestIndex := 0
+		bestDistance := math.MaxFloat64
+
+		for i, track := range remainingTracks {
+			audioFeatures := getTrackAudioFeatures(track, audioFeaturesPerTrack)
+			distance := 0.0
+
+			if hasTarget && energyRange > 0 {
+				distance += energyDistanceWeight * math.Abs(float64(audioFeatures.Energy)-targetEnergy) / energyRange
+			}
+
+			if previousFeatures != nil {
+				distance += getTransitionDistance(previousFeatures, audioFeatures, hasTarget, energyRange)
+			}
+
+			// the tracks are in the order of their score, so the best one is kept when the distances are equal
+			if distance < bestDistance {
+				bestIndex = i
+				bestDistance = distance
+			}
+		}
+
+		bestTrack := remainingTracks[bestIndex]
+		orderedTracks = append(orderedTracks, bestTrack)
+		previousFeatures = getTrackAudioFeatures(bestTrack, audioFeaturesPerTrack)
+		remainingTracks = append(remainingTracks[:bestIndex], remainingTracks[bestIndex+1:]...)
+	}
+
+	return append(orderedTracks, tracksWithoutFeatures...)
+}
+
+func getTrackAudioFeatures(track *clientcommon.Track,
+	audioFeaturesPerTrack map[string]*clientcommon.AudioFeatures) *clientcommon.AudioFeatures {
+	isrc, _ := clientcommon.GetTrackISRC(track)
+	return audioFeaturesPerTrack[isrc]
+}
+
+// Returns the energy the track at this position should have, there is no target for the steady curve
+func getTargetEnergy(energyCurve string, position int, trackCount int, minEnergy float64,
+	maxEnergy float64) (float64, bool) {
+	progress := 0.0
+
+	if trackCount > 1 {
+		progress = float64(position) / float64(trackCount-1)
+	}
+
+	switch energyCurve {
+	case EnergyCurveWarmUp:
+		return minEnergy + (maxEnergy-minEnergy)*progress, true
+	case EnergyCurveCoolDown:
+		return maxEnergy - (maxEnergy-minEnergy)*progress, true
+	case EnergyCurvePeak:
+		return minEnergy + (maxEnergy-minEnergy)*(1-math.Abs(2*progress-1)), true
+	default:
+		return 0, false
+	}
+}
+
+// The energy of the next track only follows the previous one when there is no target energy
+func getTransitionDistance(previousFeatures *clientcommon.AudioFeatures, audioFeatures *clientcommon.AudioFeatures,
+	hasTargetEnergy bool, energyRange float64) float64 {
+	distance := harmonicDistanceWeight * float64(getHarmonicDistance(previousFeatures, audioFeatures))
+	distance += tempoDistanceWeight * getTempoDistance(float64(previousFeatures.Tempo), float64(audioFeatures.Tempo))
+
+	if !hasTargetEnergy && energyRange > 0 {
+		distance += energyDistanceWeight * math.Abs(float64(audioFeatures.Energy-previousFeatures.Energy)) / energyRange
+	}
+
+	return distance
+}
+
+// The number of steps between the keys on the camelot wheel, changing between major and minor is one step
+// The keys next to each other on the wheel, or the relative major and minor, mix well together
+func getHarmonicDistance(audioFeatures *clientcommon.AudioFeatures, otherAudioFeatures *clientcommon.AudioFeatures) int {
+	number, major, ok := getCamelotKey(audioFeatures)
+	otherNumber, otherMajor, otherOk := getCamelotKey(otherAudioFeatures)
+
+	if !ok || !otherOk {
+		return unknownKeyHarmonicDistance
+	}
+
+	numberDistance := number - otherNumber
+
+	if numberDistance < 0 {
+		numberDistance = -numberDistance
+	}
+
+	if camelotWheelSize-numberDistance < numberDistance {
+		numberDistance = camelotWheelSize - numberDistance
+	}
+
+	if major != otherMajor {
+		numberDistance += 1
+	}
+
+	return numberDistance
+}
+
+// Returns the number of the key on the camelot wheel, from 1 to 12, and if it is a major key (B) or minor key (A)
+// The key is the pitch class given by spotify, C is 0 and -1 means it is unknown, and the mode is 1 for major
+func getCamelotKey(audioFeatures *clientcommon.AudioFeatures) (int, bool, bool) {
+	if audioFeatures.Key < 0 || audioFeatures.Key > 11 {
+		return 0, false, false
+	}
+
+	major := audioFeatures.Mode == 1
+	key := audioFeatures.Key
+
+	// a minor key has the number of its relative major key, which is 3 semitones above
+	if !major {
+		key = (key + 3) % 12
+	}
+
+	// each step on the wheel is a fifth (7 semitones) and C major is 8B
+	return (key*7+7)%camelotWheelSize + 1, major, true
+}
+
+// The relative difference of tempo, a track at half or double the tempo keeps the same beat so it is close
+func getTempoDistance(tempo float64, otherTempo float64) float64 {
+	if tempo <= 0 || otherTempo <= 0 {
+		return 0
+	}
+
+	distance := math.MaxFloat64
+
+	for _, multiplier := range []float64{0.5, 1, 2} {
+		multipliedTempo := otherTempo * multiplier
+		distance = math.Min(distance, math.Abs(tempo-multipliedTempo)/math.Max(tempo, multipliedTempo))
+	}
+
+	return distance
+}
@@ -0,0 +1,220 @@
+package app
+
+import (
+	"github.com/shared-spotify/musicclient/clientcommon"
+	"math"
+	"strings"
+	"testing"
+)
+
+// The pitch classes given by spotify, C is 0
+const (
+	keyC      = 0
+	keyD      = 2
+	keyE      = 4
+	keyF      = 5
+	keyFSharp = 6
+	keyG      = 7
+	keyA      = 9
+	keyB      = 11
+)
+
+const modeMinor = 0
+const modeMajor = 1
+
+func TestValidatePlaylistOrder(t *testing.T) {
+	tests := []struct {
+		order       string
+		energyCurve string
+		expected    error
+	}{
+		{"", "", nil},
+		{PlaylistOrderScore, "", nil},
+		{PlaylistOrderSmooth, EnergyCurvePeak, nil},
+		{"random", "", ErrorUnknownPlaylistOrder},
+		{PlaylistOrderSmooth, "random", ErrorUnknownEnergyCurve},
+	}
+
+	for _, test := range tests {
+		t.Run(test.order+"/"+test.energyCurve, func(t *testing.T) {
+			if err := ValidatePlaylistOrder(test.order, test.energyCurve); err != test.expected {
+				t.Errorf("Expected %v, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestGetCamelotKey(t *testing.T) {
+	tests := []struct {
+		name           string
+		key            int
+		mode           int
+		expectedNumber int
+		expectedMajor  bool
+		expectedOk     bool
+	}{
+		{"C major", keyC, modeMajor, 8, true, true},
+		{"A minor", keyA, modeMinor, 8, false, true},
+		{"G major", keyG, modeMajor, 9, true, true},
+		{"D major", keyD, modeMajor, 10, true, true},
+		{"E minor", keyE, modeMinor, 9, false, true},
+		{"F major", keyF, modeMajor, 7, true, true},
+		{"B major", keyB, modeMajor, 1, true, true},
+		{"E major", keyE, modeMajor, 12, true, true},
+		{"unknown key", -1, modeMajor, 0, false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			number, major, ok := getCamelotKey(&clientcommon.AudioFeatures{Key: test.key, Mode: test.mode})
+
+			if number != test.expectedNumber || major != test.expectedMajor || ok != test.expectedOk {
+				t.Errorf("Expected %d %t %t, got %d %t %t", test.expectedNumber, test.expectedMajor, test.expectedOk,
+					number, major, ok)
+			}
+		})
+	}
+}
+
+func TestGetHarmonicDistance(t *testing.T) {
+	tests := []struct {
+		name      string
+		key       int
+		mode      int
+		otherKey  int
+		otherMode int
+		expected  int
+	}{
+		{"same key", keyC, modeMajor, keyC, modeMajor, 0},
+		{"next on the wheel", keyC, modeMajor, keyG, modeMajor, 1},
+		{"relative minor", keyC, modeMajor, keyA, modeMinor, 1},
+		{"next and other mode", keyC, modeMajor, keyE, modeMinor, 2},
+		{"opposite on the wheel", keyC, modeMajor, keyFSharp, modeMajor, 6},
+		{"around the wheel", keyB, modeMajor, keyE, modeMajor, 1},
+		{"unknown key", -1, modeMajor, keyC, modeMajor, unknownKeyHarmonicDistance},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			distance := getHarmonicDistance(&clientcommon.AudioFeatures{Key: test.key, Mode: test.mode},
+				&clientcommon.AudioFeatures{Key: test.otherKey, Mode: test.otherMode})
+
+			if distance != test.expected {
+				t.Errorf("Expected %d, got %d", test.expected, distance)
+			}
+		})
+	}
+}
+
+func TestGetTempoDistance(t *testing.T) {
+	tests := []struct {
+		name       string
+		tempo      float64
+		otherTempo float64
+		expected   float64
+	}{
+		{"same tempo", 120, 120, 0},
+		{"half tempo", 120, 60, 0},
+		{"double tempo", 120, 240, 0},
+		{"close tempo", 100, 110, 10.0 / 110},
+		{"unknown tempo", 0, 120, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if distance := getTempoDistance(test.tempo, test.otherTempo); math.Abs(distance-test.expected) > 1e-9 {
+				t.Errorf("Expected %f, got %f", test.expected, distance)
+			}
+		})
+	}
+}
+
+func TestGetTargetEnergy(t *testing.T) {
+	tests := []struct {
+		energyCurve string
+		position    int
+		expected    float64
+		expectedOk  bool
+	}{
+		{EnergyCurveWarmUp, 0, 0.2, true},
+		{EnergyCurveWarmUp, 4, 1, true},
+		{EnergyCurveCoolDown, 0, 1, true},
+		{EnergyCurveCoolDown, 2, 0.6, true},
+		{EnergyCurvePeak, 2, 1, true},
+		{EnergyCurvePeak, 4, 0.2, true},
+		{EnergyCurveSteady, 2, 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.energyCurve, func(t *testing.T) {
+			energy, ok := getTargetEnergy(test.energyCurve, test.position, 5, 0.2, 1)
+
+			if ok != test.expectedOk || math.Abs(energy-test.expected) > 1e-9 {
+				t.Errorf("Expected %f %t at position %d, got %f %t", test.expected, test.expectedOk, test.position,
+					energy, ok)
+			}
+		})
+	}
+}
+
+func TestOrderTracksSmoothly(t *testing.T) {
+	tests := []struct {
+		name          string
+		energyCurve   string
+		audioFeatures map[string]*clientcommon.AudioFeatures
+		expected      string
+	}{
+		{
+			"closest key after the best track",
+			EnergyCurveSteady,
+			map[string]*clientcommon.AudioFeatures{
+				"first":  {Key: keyC, Mode: modeMajor, Tempo: 120, Energy: 0.5},
+				"second": {Key: keyFSharp, Mode: modeMajor, Tempo: 120, Energy: 0.5},
+				"third":  {Key: keyG, Mode: modeMajor, Tempo: 120, Energy: 0.5},
+			},
+			"first,third,second,fourth",
+		},
+		{
+			"warm up",
+			EnergyCurveWarmUp,
+			map[string]*clientcommon.AudioFeatures{
+				"first":  {Key: keyC, Mode: modeMajor, Tempo: 120, Energy: 0.9},
+				"second": {Key: keyC, Mode: modeMajor, Tempo: 120, Energy: 0.1},
+				"third":  {Key: keyC, Mode: modeMajor, Tempo: 120, Energy: 0.5},
+			},
+			"second,third,first,fourth",
+		},
+		{
+			"cool down",
+			EnergyCurveCoolDown,
+			map[string]*clientcommon.AudioFeatures{
+				"first":  {Key: keyC, Mode: modeMajor, Tempo: 120, Energy: 0.5},
+				"second": {Key: keyC, Mode: modeMajor, Tempo: 120, Energy: 0.1},
+				"third":  {Key: keyC, Mode: modeMajor, Tempo: 120, Energy: 0.9},
+			},
+			"third,first,second,fourth",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// the fourth track has no audio features, so it is always last
+			tracks := make([]*clientcommon.Track, 0)
+
+			for _, name := range []string{"first", "second", "third", "fourth"} {
+				tracks = append(tracks, &clientcommon.Track{Isrc: name, Name: name})
+			}
+
+			orderedTracks := orderTracksSmoothly(tracks, test.audioFeatures, test.energyCurve)
+			names := make([]string, 0)
+
+			for _, track := range orderedTracks {
+				names = append(names, track.Name)
+			}
+
+			if strings.Join(names, ",") != test.expected {
+				t.Errorf("Expected %s, got %s", test.expected, strings.Join(names, ","))
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package app
+
+import "errors"
+
+var ErrorInvalidPlaylistThresholds = errors.New("Invalid playlist thresholds, popularities must be between 0 and " +
+	"100 with the unpopular one below the popular one, and counts cannot be negative")
+
+// The thresholds of the popularity, music period and genre playlists
+// A threshold left to 0 uses the default one
+type PlaylistThresholds struct {
+	MinPopularity             int `json:"min_popularity"`   // out of 100
+	MaxUnpopularity           int `json:"max_unpopularity"` // out of 100
+	PeriodMinTrackCount       int `json:"period_min_track_count"`
+	RecentPeriodMinTrackCount int `json:"recent_period_min_track_count"`
+	GenreMinTrackCount        int `json:"genre_min_track_count"`
+	MaxGenrePlaylists         int `json:"max_genre_playlists"`
+}
+
+var DefaultPlaylistThresholds = PlaylistThresholds{
+	MinPopularity:             popularityThreshold,
+	MaxUnpopularity:           unpopularThreshold,
+	PeriodMinTrackCount:       periodTrackCountThreshold,
+	RecentPeriodMinTrackCount: periodRecentTrackCountThreshold,
+	GenreMinTrackCount:        genreTrackCountThreshold,
+	MaxGenrePlaylists:         maxGenrePlaylists,
+}
+
+func (thresholds *PlaylistThresholds) Validate() error {
+	if thresholds.MinPopularity < 0 || thresholds.MinPopularity > 100 ||
+		thresholds.MaxUnpopularity < 0 || thresholds.MaxUnpopularity > 100 {
+		return ErrorInvalidPlaylistThresholds
+	}
+
+	if thresholds.PeriodMinTrackCount < 0 || thresholds.RecentPeriodMinTrackCount < 0 ||
+		thresholds.GenreMinTrackCount < 0 || thresholds.MaxGenrePlaylists < 0 {
+		return ErrorInvalidPlaylistThresholds
+	}
+
+	withDefaults := thresholds.withDefaults()
+
+	if withDefaults.MaxUnpopularity >= withDefaults.MinPopularity {
+		return ErrorInvalidPlaylistThresholds
+	}
+
+	return nil
+}
+
+func (thresholds *PlaylistThresholds) withDefaults() PlaylistThresholds {
+	withDefaults := DefaultPlaylistThresholds
+
+	if thresholds == nil {
+		return withDefaults
+	}
+
+	if thresholds.MinPopularity != 0 {
+		withDefaults.MinPopularity = thresholds.MinPopularity
+	}
+
+	if thresholds.MaxUnpopularity != 0 {
+		withDefaults.MaxUnpopularity = thresholds.MaxUnpopularity
+	}
+
+	if thresholds.PeriodMinTrackCount != 0 {
+		withDefaults.PeriodMinTrackCount = thresholds.PeriodMinTrackCount
+	}
+
+	if thresholds.RecentPeriodMinTrackCount != 0 {
+		withDefaults.RecentPeriodMinTrackCount = thresholds.RecentPeriodMinTrackCount
+	}
+
+	if thresholds.GenreMinTrackCount != 0 {
+		withDefaults.GenreMinTrackCount = thresholds.GenreMinTrackCount
+	}
+
+	if thresholds.MaxGenrePlaylists != 0 {
+		withDefaults.MaxGenrePlaylists = thresholds.MaxGenrePlaylists
+	}
+
+	return withDefaults
+}
@@ -7,13 +7,23 @@ import (
 	"github.com/shared-spotify/musicclient"
 	"github.com/shared-spotify/musicclient/clientcommon"
 	"github.com/shared-spotify/utils"
-	"github.com/zmb3/spotify"
+	"github.com/thoas/go-funk"
 	"sort"
 	"strings"
 )
 
 const playlistNameShared = "All songs in common"
 const playlistNameDance = "Dance songs"
+const playlistNameHighEnergy = "High energy songs"
+const playlistNameChill = "Chill and acoustic songs"
+const playlistNameHappy = "Happy songs"
+const playlistNameMelancholic = "Melancholic songs"
+const playlistNameSlowTempo = "Slow tempo"
+const playlistNameMidTempo = "Mid tempo"
+const playlistNameFastTempo = "Fast tempo"
+const playlistNameArtistOverlap = "Songs from shared artists"
+const playlistNameAlbumOverlap = "Songs from shared albums"
+const playlistNameDiscover = "Discover together"
 const playlistNamePopular = "Popular songs"
 const playlistNameUnpopular = "Uncommon songs"
 const playlistNameGenre = "%s songs"
@@ -30,12 +40,24 @@ const playlistTypePopularity = "popularity"
 const playlistTypeDance = "dance"
 const playlistTypeGenre = "genre"
 const playlistTypePeriod = "music period"
+const playlistTypeEnergy = "energy"
+const playlistTypeMood = "mood"
+const playlistTypeTempo = "tempo"
+const playlistTypeArtistOverlap = "artist overlap"
+const playlistTypeAlbumOverlap = "album overlap"
+const playlistTypeDiscover = "discover"
 
 const playlistRankShared = 1
 const playlistRankPopular = 2
 const playlistRankDance = 3
 const playlistRankMusicPeriod = 4
 const playlistRankGenre = 5
+const playlistRankEnergy = 6
+const playlistRankMood = 7
+const playlistRankTempo = 8
+const playlistRankArtistOverlap = 9
+const playlistRankAlbumOverlap = 10
+const playlistRankDiscover = 11
 
 const minNumberOfUserForCommonMusic = 2
 
@@ -50,6 +72,8 @@ const unpopularThreshold = 20  // out of 100
 type CommonPlaylists struct {
 	// all playlists in a map with key playlist generated id
 	Playlists map[string]*Playlist `json:"-"`
+	// compatibility of each pair of users, computed with the playlists
+	Compatibility *CompatibilityMatrix `json:"-"`
 
 	// These are fields used for computation of the playlists, they are not useful once Playlists is populated
 	*CommonPlaylistComputation `bson:"-"`
@@ -59,19 +83,27 @@ type CommonPlaylistComputation struct {
 	// all users in a map with key user id
 	Users map[string]*clientcommon.User `json:"-"`
 	// all tracks for a user in a map with key track id
-	TracksPerUser map[string][]*spotify.FullTrack `json:"-"`
+	TracksPerUser map[string][]*clientcommon.Track `json:"-"`
+	// how each track is in the library of a user in a map with key user id, then track id
+	LibraryTracksPerUser map[string]map[string]*userLibraryTrack `json:"-"`
 	// all users sharing track in a map with key track id
 	SharedTracksRank map[string][]*clientcommon.User `json:"-"`
-	// all user ids sharing track above the min threshold minNumberOfUserForCommonMusic in a map with key track id
+	// all user ids sharing track above the min shared users threshold in a map with key track id
 	SharedTracksRankAboveMinThreshold map[string][]string `json:"-"`
+	// score of the tracks in the playlists in a map with key track id
+	SharedTracksScore map[string]float64 `json:"-"`
 	// all tracks of all users in a map with key track id
-	SharedTracks map[string]*spotify.FullTrack `json:"-"`
+	SharedTracks map[string]*clientcommon.Track `json:"-"`
 	// audio records in a map with key track id
-	AudioFeaturesPerTrack map[string]*spotify.AudioFeatures `json:"-"`
+	AudioFeaturesPerTrack map[string]*clientcommon.AudioFeatures `json:"-"`
 	// artist list in a map with key track id
-	ArtistsPerTrack map[string][]*spotify.FullArtist `json:"-"`
+	ArtistsPerTrack map[string][]*clientcommon.Artist `json:"-"`
 	// album in a map with key track id
-	AlbumPerTrack map[string]*spotify.FullAlbum `json:"-"`
+	AlbumPerTrack map[string]*clientcommon.Album `json:"-"`
+	// options of the room, with the thresholds used by the generators
+	Options *ProcessingOptions `json:"-"`
+	// groups of the tracks of the same recording, the track ids in the maps above are the canonical ids of the groups
+	canonicalTracks *canonicalTracks
 }
 
 type PlaylistsMetadata map[string]*PlaylistMetadata
@@ -87,13 +119,14 @@ type PlaylistMetadata struct {
 
 type Playlist struct {
 	PlaylistMetadata       `bson:"inline"`
-	TracksPerSharedCount   map[int][]*spotify.FullTrack  `json:"tracks_per_shared_count"`
+	TracksPerSharedCount   map[int][]*clientcommon.Track `json:"tracks_per_shared_count"` // sorted by score
 	UserIdsPerSharedTracks map[string][]string           `json:"user_ids_per_shared_tracks"`
+	ScorePerTrack          map[string]float64            `json:"score_per_track"`
 	Users                  map[string]*clientcommon.User `json:"users"`
 }
 
-func (playlist *Playlist) GetAllTracks() []*spotify.FullTrack {
-	tracks := make([]*spotify.FullTrack, 0)
+func (playlist *Playlist) GetAllTracks() []*clientcommon.Track {
+	tracks := make([]*clientcommon.Track, 0)
 
 	for _, tracksPart := range playlist.TracksPerSharedCount {
 		tracks = append(tracks, tracksPart...)
@@ -102,6 +135,41 @@ func (playlist *Playlist) GetAllTracks() []*spotify.FullTrack {
 	return tracks
 }
 
+// Returns the tracks shared by one of the user counts in the order of their score, all the tracks if there is no user
+// count. Only the topCount best tracks are returned if it is not 0
+func (playlist *Playlist) GetTracksByScore(sharedUserCounts []int, topCount int) []*clientcommon.Track {
+	sharedCounts := make([]int, 0)
+
+	for sharedCount := range playlist.TracksPerSharedCount {
+		if len(sharedUserCounts) == 0 || funk.ContainsInt(sharedUserCounts, sharedCount) {
+			sharedCounts = append(sharedCounts, sharedCount)
+		}
+	}
+
+	// the tracks shared by the most users come first, whatever the weights of their sources
+	sort.Sort(sort.Reverse(sort.IntSlice(sharedCounts)))
+
+	tracks := make([]*clientcommon.Track, 0)
+
+	for _, sharedCount := range sharedCounts {
+		sharedCountTracks := playlist.TracksPerSharedCount[sharedCount]
+
+		// the playlists processed before the scores existed keep the order they had
+		if playlist.ScorePerTrack != nil {
+			sharedCountTracks = append([]*clientcommon.Track{}, sharedCountTracks...)
+			sortTracksByScore(sharedCountTracks, playlist.ScorePerTrack)
+		}
+
+		tracks = append(tracks, sharedCountTracks...)
+	}
+
+	if topCount > 0 && len(tracks) > topCount {
+		tracks = tracks[:topCount]
+	}
+
+	return tracks
+}
+
 func (playlists *CommonPlaylists) GetPlaylistsMetadata() PlaylistsMetadata {
 	playlistsMetadata := make(PlaylistsMetadata)
 
@@ -115,21 +183,37 @@ func (playlists *CommonPlaylists) GetPlaylistsMetadata() PlaylistsMetadata {
 func CreateCommonPlaylists() *CommonPlaylists {
 	computation := CommonPlaylistComputation{
 		make(map[string]*clientcommon.User),
-		make(map[string][]*spotify.FullTrack),
+		make(map[string][]*clientcommon.Track),
+		make(map[string]map[string]*userLibraryTrack),
 		make(map[string][]*clientcommon.User),
 		make(map[string][]string),
-		make(map[string]*spotify.FullTrack),
+		make(map[string]float64),
+		make(map[string]*clientcommon.Track),
+		nil,
 		nil,
 		nil,
 		nil,
+		createCanonicalTracks(),
 	}
 
 	return &CommonPlaylists{
 		make(map[string]*Playlist, 0),
+		nil,
 		&computation,
 	}
 }
 
+// Returns the id of the track used in the playlists, which is the canonical id of its recording
+func (playlists *CommonPlaylists) getTrackId(track *clientcommon.Track) (string, bool) {
+	isrc, ok := clientcommon.GetTrackISRC(track)
+
+	if !ok {
+		return "", false
+	}
+
+	return playlists.canonicalTracks.getCanonicalIdForIsrc(isrc)
+}
+
 func (playlists *CommonPlaylists) getAUser() *clientcommon.User {
 	for _, user := range playlists.Users {
 		return user
@@ -138,7 +222,7 @@ func (playlists *CommonPlaylists) getAUser() *clientcommon.User {
 	return nil
 }
 
-func (playlists *CommonPlaylists) addTracks(user *clientcommon.User, tracks []*spotify.FullTrack) {
+func (playlists *CommonPlaylists) addTracks(user *clientcommon.User, tracks []*clientcommon.Track) {
 	// Remember the user
 	playlists.Users[user.GetId()] = user
 
@@ -147,15 +231,28 @@ func (playlists *CommonPlaylists) addTracks(user *clientcommon.User, tracks []*s
 
 	// a list of tracks from a user can contain multiple times the same track, so we de-duplicate per user
 	trackAlreadyInserted := make(map[string]bool)
+	libraryTracks := make(map[string]*userLibraryTrack)
+	playlists.LibraryTracksPerUser[user.GetId()] = libraryTracks
 
 	for _, track := range tracks {
-		trackISCR, ok := clientcommon.GetTrackISRC(track)
+		// the versions of the same recording with different isrcs are counted as the same track
+		trackISCR, ok := playlists.canonicalTracks.getCanonicalId(track)
 
 		if !ok {
 			logger.WithUser(user.GetUserId()).Warning("ISRC does not exist, track=", track)
 			continue
 		}
 
+		// the same track can be several times in the library, each of them is kept to score it
+		libraryTrack, ok := libraryTracks[trackISCR]
+
+		if !ok {
+			libraryTrack = &userLibraryTrack{}
+			libraryTracks[trackISCR] = libraryTrack
+		}
+
+		libraryTrack.add(track)
+
 		_, ok = trackAlreadyInserted[trackISCR]
 
 		if ok {
@@ -171,19 +268,33 @@ func (playlists *CommonPlaylists) addTracks(user *clientcommon.User, tracks []*s
 		} else {
 			users = append(users, user)
 			logger.Logger.Debugf("Song %s present multiple times %d, id is %s, user is %s, track=%v",
-				track.Name, len(users), track.ID, user.GetUserId(), track)
+				track.Name, len(users), trackISCR, user.GetUserId(), track)
 		}
 
 		playlists.SharedTracksRank[trackISCR] = users
-		playlists.SharedTracks[trackISCR] = track
 		trackAlreadyInserted[trackISCR] = true
+
+		// the same track can come from different providers, so we keep the info found on all of them
+		if sharedTrack, ok := playlists.SharedTracks[trackISCR]; ok {
+			sharedTrack.Merge(track)
+		} else {
+			playlists.SharedTracks[trackISCR] = track
+		}
 	}
 
 	// insert the ISRC to spotify ID mapping to keep a record and be quicker next time
 	isrcMapping := make([]mongoclient.IsrcMapping, 0)
 	for _, track := range tracks {
-		isrc, _ := clientcommon.GetTrackISRC(track)
-		isrcMapping = append(isrcMapping, mongoclient.IsrcMapping{Isrc: isrc, SpotifyId: track.ID.String()})
+		isrc, ok := clientcommon.GetTrackISRC(track)
+		spotifyId, spotifyOk := track.GetProviderId(clientcommon.SpotifyLoginType)
+
+		if ok && spotifyOk {
+			isrcMapping = append(isrcMapping, mongoclient.IsrcMapping{Isrc: isrc, SpotifyId: spotifyId})
+		}
+	}
+
+	if len(isrcMapping) == 0 {
+		return
 	}
 
 	err := mongoclient.InsertIsrcMapping(isrcMapping)
@@ -193,14 +304,31 @@ func (playlists *CommonPlaylists) addTracks(user *clientcommon.User, tracks []*s
 	}
 }
 
-func (playlists *CommonPlaylists) GeneratePlaylists() error {
+// onPhase is called when a new phase of the generation starts, and progress as a phase makes progress
+func (playlists *CommonPlaylists) GeneratePlaylists(options *ProcessingOptions, onPhase func(phase string),
+	progress clientcommon.ProgressHook) error {
+	playlists.Options = options
+
 	// Generate the shared track playlist
+	onPhase(GenerationPhaseSharedTracks)
 	sharedTrackPlaylist := playlists.GenerateCommonPlaylistType()
 
 	// get all the shared track so it can be used to get infos on those tracks
 	allSharedTracks := sharedTrackPlaylist.GetAllTracks()
 
+	// find the shared tracks on the provider giving us the additional infos
+	onPhase(GenerationPhaseResolveTracks)
+	err := musicclient.ResolveTracks(allSharedTracks, progress)
+
+	if err != nil {
+		return err
+	}
+
+	// the popularity of the tracks is known once they are resolved, so they are ranked again
+	playlists.rankTracks(sharedTrackPlaylist)
+
 	// get audio features among common songs
+	onPhase(GenerationPhaseAudioFeatures)
 	audioFeatures, err := musicclient.GetAudioFeatures(allSharedTracks)
 
 	if err != nil {
@@ -211,6 +339,7 @@ func (playlists *CommonPlaylists) GeneratePlaylists() error {
 	playlists.AudioFeaturesPerTrack = audioFeatures
 
 	// get artists among common songs
+	onPhase(GenerationPhaseArtists)
 	artists, err := musicclient.GetArtists(allSharedTracks)
 
 	if err != nil {
@@ -221,6 +350,7 @@ func (playlists *CommonPlaylists) GeneratePlaylists() error {
 	playlists.ArtistsPerTrack = artists
 
 	// get the albums among common songs
+	onPhase(GenerationPhaseAlbums)
 	albums, err := musicclient.GetAlbums(allSharedTracks)
 
 	if err != nil {
@@ -233,18 +363,22 @@ func (playlists *CommonPlaylists) GeneratePlaylists() error {
 	/*
 	  We generate new playlists here, with the additional infos gathered
 	*/
+	onPhase(GenerationPhasePlaylists)
 
-	// Generate the popular songs playlist
-	playlists.GeneratePopularityPlaylistType(sharedTrackPlaylist)
+	for _, generator := range options.GetPlaylistGenerators() {
+		logger.Logger.Debugf("Generating playlists with generator %s", generator.Name())
+		generator.Generate(playlists, sharedTrackPlaylist)
+	}
 
-	// TODO: activate back dance playlists once it work
-	//playlists.GenerateDancePlaylist(sharedTrackPlaylist)
+	// compare the users, this needs the whole library of each user so it is done before the memory is released
+	onPhase(GenerationPhaseCompatibility)
+	compatibility, err := playlists.GenerateCompatibilityMatrix()
 
-	// Generate the music period playlists
-	playlists.GenerateMusicPeriodPlaylistType(sharedTrackPlaylist)
+	if err != nil {
+		return err
+	}
 
-	// Generate the genre playlists
-	playlists.GenerateGenrePlaylists(sharedTrackPlaylist)
+	playlists.Compatibility = compatibility
 
 	/*
 	  We release the memory used for the computation as it won't be used anymore
@@ -257,20 +391,22 @@ func (playlists *CommonPlaylists) GeneratePlaylists() error {
 func (playlists *CommonPlaylists) GenerateCommonPlaylistType() *Playlist {
 	totalUsers := len(playlists.TracksPerUser)
 
+	minSharedUsers := playlists.Options.GetMinSharedUsers()
+
 	logger.Logger.Infof("Finding most common tracks for %d users across %d different tracks",
 		totalUsers, len(playlists.SharedTracksRank))
 
-	tracksInCommon := make(map[int][]*spotify.FullTrack)
+	tracksInCommon := make(map[int][]*clientcommon.Track)
 
 	// Create the track list for each user count possibility
-	for i := minNumberOfUserForCommonMusic; i <= totalUsers; i++ {
-		tracksInCommon[i] = make([]*spotify.FullTrack, 0)
+	for i := minSharedUsers; i <= totalUsers; i++ {
+		tracksInCommon[i] = make([]*clientcommon.Track, 0)
 	}
 
 	for trackId, users := range playlists.SharedTracksRank {
 		userCount := len(users)
 
-		if userCount >= minNumberOfUserForCommonMusic {
+		if userCount >= minSharedUsers {
 			// playlist containing as key the number of user that share this music, and in value the number of tracks
 			trackListForUserCount := tracksInCommon[userCount]
 
@@ -298,20 +434,22 @@ func (playlists *CommonPlaylists) GenerateCommonPlaylistType() *Playlist {
 	return commonPlaylistType
 }
 
-func (playlists *CommonPlaylists) GeneratePopularityPlaylistType(sharedTrackPlaylist *Playlist) {
-	popularTracksInCommon := make(map[int][]*spotify.FullTrack)
-	unpopularTracksInCommon := make(map[int][]*spotify.FullTrack)
+func (playlists *CommonPlaylists) GeneratePopularityPlaylistType(generator PlaylistGenerator,
+	sharedTrackPlaylist *Playlist) {
+	thresholds := playlists.Options.GetPlaylistThresholds()
+	popularTracksInCommon := make(map[int][]*clientcommon.Track)
+	unpopularTracksInCommon := make(map[int][]*clientcommon.Track)
 
 	for sharedCount, tracks := range sharedTrackPlaylist.TracksPerSharedCount {
-		popularTracksInCommonForSharedCount := make([]*spotify.FullTrack, 0)
-		unpopularTracksInCommonForSharedCount := make([]*spotify.FullTrack, 0)
+		popularTracksInCommonForSharedCount := make([]*clientcommon.Track, 0)
+		unpopularTracksInCommonForSharedCount := make([]*clientcommon.Track, 0)
 
 		for _, track := range tracks {
-			if track.Popularity >= popularityThreshold {
+			if track.Popularity >= thresholds.MinPopularity {
 				logger.Logger.Debugf("Found popular track for %d person: %s by %v", sharedCount, track.Name, track.Artists)
 				popularTracksInCommonForSharedCount = append(popularTracksInCommonForSharedCount, track)
 
-			} else if track.Popularity != 0 && track.Popularity <= unpopularThreshold {
+			} else if track.Popularity != 0 && track.Popularity <= thresholds.MaxUnpopularity {
 				logger.Logger.Debugf("Found unpopular track for %d person: %s by %v", sharedCount, track.Name, track.Artists)
 				unpopularTracksInCommonForSharedCount = append(unpopularTracksInCommonForSharedCount, track)
 			}
@@ -322,26 +460,29 @@ func (playlists *CommonPlaylists) GeneratePopularityPlaylistType(sharedTrackPlay
 	}
 
 	// Popular playlist
-	playlists.createPlaylist(playlistNamePopular, playlistTypePopularity, playlistRankPopular, 1, popularTracksInCommon)
-	playlists.createPlaylist(playlistNameUnpopular, playlistTypePopularity, playlistRankPopular, 2, unpopularTracksInCommon)
+	playlists.createPlaylist(playlistNamePopular, generator.Type(), generator.Rank(), 1, popularTracksInCommon)
+	playlists.createPlaylist(playlistNameUnpopular, generator.Type(), generator.Rank(), 2, unpopularTracksInCommon)
 }
 
 // This could be refactored but for now, let's say it's ok
-func (playlists *CommonPlaylists) GenerateMusicPeriodPlaylistType(sharedTrackPlaylist *Playlist) {
-	period1970TracksInCommon := make(map[int][]*spotify.FullTrack)
-	period1980TracksInCommon := make(map[int][]*spotify.FullTrack)
-	period1990TracksInCommon := make(map[int][]*spotify.FullTrack)
-	period2000TracksInCommon := make(map[int][]*spotify.FullTrack)
-	period2010TracksInCommon := make(map[int][]*spotify.FullTrack)
-	periodRecentTracksInCommon := make(map[int][]*spotify.FullTrack)
+func (playlists *CommonPlaylists) GenerateMusicPeriodPlaylistType(generator PlaylistGenerator,
+	sharedTrackPlaylist *Playlist) {
+	thresholds := playlists.Options.GetPlaylistThresholds()
+
+	period1970TracksInCommon := make(map[int][]*clientcommon.Track)
+	period1980TracksInCommon := make(map[int][]*clientcommon.Track)
+	period1990TracksInCommon := make(map[int][]*clientcommon.Track)
+	period2000TracksInCommon := make(map[int][]*clientcommon.Track)
+	period2010TracksInCommon := make(map[int][]*clientcommon.Track)
+	periodRecentTracksInCommon := make(map[int][]*clientcommon.Track)
 
 	for sharedCount, tracks := range sharedTrackPlaylist.TracksPerSharedCount {
-		period1970TracksInCommonForSharedTrack := make([]*spotify.FullTrack, 0)
-		period1980TracksInCommonForSharedTrack := make([]*spotify.FullTrack, 0)
-		period1990TracksInCommonForSharedTrack := make([]*spotify.FullTrack, 0)
-		period2000TracksInCommonForSharedTrack := make([]*spotify.FullTrack, 0)
-		period2010TracksInCommonForSharedTrack := make([]*spotify.FullTrack, 0)
-		periodRecentTracksInCommonForSharedTrack := make([]*spotify.FullTrack, 0)
+		period1970TracksInCommonForSharedTrack := make([]*clientcommon.Track, 0)
+		period1980TracksInCommonForSharedTrack := make([]*clientcommon.Track, 0)
+		period1990TracksInCommonForSharedTrack := make([]*clientcommon.Track, 0)
+		period2000TracksInCommonForSharedTrack := make([]*clientcommon.Track, 0)
+		period2010TracksInCommonForSharedTrack := make([]*clientcommon.Track, 0)
+		periodRecentTracksInCommonForSharedTrack := make([]*clientcommon.Track, 0)
 
 		for _, track := range tracks {
 			// get the song release data
@@ -388,42 +529,22 @@ func (playlists *CommonPlaylists) GenerateMusicPeriodPlaylistType(sharedTrackPla
 	}
 
 	// Generate the playlist per period era
-	playlists.createPlaylistForMinCount(playlistNameOld, playlistTypePeriod, playlistRankMusicPeriod, 6,
-		period1970TracksInCommon, periodTrackCountThreshold)
-	playlists.createPlaylistForMinCount(playlistName1980, playlistTypePeriod, playlistRankMusicPeriod, 5,
-		period1980TracksInCommon, periodTrackCountThreshold)
-	playlists.createPlaylistForMinCount(playlistName1990, playlistTypePeriod, playlistRankMusicPeriod, 4,
-		period1990TracksInCommon, periodTrackCountThreshold)
-	playlists.createPlaylistForMinCount(playlistName2000, playlistTypePeriod, playlistRankMusicPeriod, 3,
-		period2000TracksInCommon, periodTrackCountThreshold)
-	playlists.createPlaylistForMinCount(playlistName2010, playlistTypePeriod, playlistRankMusicPeriod, 2,
-		period2010TracksInCommon, periodTrackCountThreshold)
-	playlists.createPlaylistForMinCount(playlistNameRecentRelease, playlistTypePeriod, playlistRankMusicPeriod, 1,
-		periodRecentTracksInCommon, periodRecentTrackCountThreshold)
+	playlists.createPlaylistForMinCount(playlistNameOld, generator.Type(), generator.Rank(), 6,
+		period1970TracksInCommon, thresholds.PeriodMinTrackCount)
+	playlists.createPlaylistForMinCount(playlistName1980, generator.Type(), generator.Rank(), 5,
+		period1980TracksInCommon, thresholds.PeriodMinTrackCount)
+	playlists.createPlaylistForMinCount(playlistName1990, generator.Type(), generator.Rank(), 4,
+		period1990TracksInCommon, thresholds.PeriodMinTrackCount)
+	playlists.createPlaylistForMinCount(playlistName2000, generator.Type(), generator.Rank(), 3,
+		period2000TracksInCommon, thresholds.PeriodMinTrackCount)
+	playlists.createPlaylistForMinCount(playlistName2010, generator.Type(), generator.Rank(), 2,
+		period2010TracksInCommon, thresholds.PeriodMinTrackCount)
+	playlists.createPlaylistForMinCount(playlistNameRecentRelease, generator.Type(), generator.Rank(), 1,
+		periodRecentTracksInCommon, thresholds.RecentPeriodMinTrackCount)
 }
 
-func (playlists *CommonPlaylists) GenerateDancePlaylist(sharedTrackPlaylist *Playlist) {
-	danceTracksInCommon := make(map[int][]*spotify.FullTrack)
-
-	for sharedCount, tracks := range sharedTrackPlaylist.TracksPerSharedCount {
-		danceTracksInCommonForSharedCount := make([]*spotify.FullTrack, 0)
-
-		for _, track := range tracks {
-			isrc, _ := clientcommon.GetTrackISRC(track)
-			audioFeatures := playlists.AudioFeaturesPerTrack[isrc]
-
-			if audioFeatures.Danceability >= 0.7 {
-				danceTracksInCommonForSharedCount = append(danceTracksInCommonForSharedCount, track)
-			}
-		}
-
-		danceTracksInCommon[sharedCount] = danceTracksInCommonForSharedCount
-	}
-
-	playlists.createPlaylist(playlistNameDance, playlistTypeDance, playlistRankDance, 1, danceTracksInCommon)
-}
-
-func (playlists *CommonPlaylists) GenerateGenrePlaylists(sharedTrackPlaylist *Playlist) {
+func (playlists *CommonPlaylists) GenerateGenrePlaylists(generator PlaylistGenerator, sharedTrackPlaylist *Playlist) {
+	thresholds := playlists.Options.GetPlaylistThresholds()
 	genres := make(map[string]int)
 
 	for _, artists := range playlists.ArtistsPerTrack {
@@ -454,22 +575,23 @@ func (playlists *CommonPlaylists) GenerateGenrePlaylists(sharedTrackPlaylist *Pl
 	logger.Logger.Debug("Genres in order of popularity are: ", allGenres)
 
 	// if there are less genres then we want to select, stop
-	genreToSelectCount := maxGenrePlaylists
-	if len(allGenres) < maxGenrePlaylists {
+	genreToSelectCount := thresholds.MaxGenrePlaylists
+	if len(allGenres) < thresholds.MaxGenrePlaylists {
 		genreToSelectCount = len(allGenres)
 	}
 
 	for _, genre := range allGenres[:genreToSelectCount] {
-		playlists.GenerateGenrePlaylist(sharedTrackPlaylist, genre)
+		playlists.GenerateGenrePlaylist(generator, sharedTrackPlaylist, genre)
 	}
 }
 
-func (playlists *CommonPlaylists) GenerateGenrePlaylist(sharedTrackPlaylist *Playlist, playlistGenre string) {
+func (playlists *CommonPlaylists) GenerateGenrePlaylist(generator PlaylistGenerator, sharedTrackPlaylist *Playlist,
+	playlistGenre string) {
 	genreTrackCount := 0
-	genreTracksInCommon := make(map[int][]*spotify.FullTrack)
+	genreTracksInCommon := make(map[int][]*clientcommon.Track)
 
 	for sharedCount, tracks := range sharedTrackPlaylist.TracksPerSharedCount {
-		genreTracksInCommonForSharedCount := make([]*spotify.FullTrack, 0)
+		genreTracksInCommonForSharedCount := make([]*clientcommon.Track, 0)
 
 		for _, track := range tracks {
 			isrc, _ := clientcommon.GetTrackISRC(track)
@@ -498,12 +620,12 @@ func (playlists *CommonPlaylists) GenerateGenrePlaylist(sharedTrackPlaylist *Pla
 	}
 
 	playlistType := fmt.Sprintf(playlistNameGenre, strings.Title(strings.ToLower(playlistGenre)))
-	playlists.createPlaylistForMinCount(playlistType, playlistTypeGenre, playlistRankGenre, 1,
-		genreTracksInCommon, genreTrackCountThreshold)
+	playlists.createPlaylistForMinCount(playlistType, generator.Type(), generator.Rank(), 1,
+		genreTracksInCommon, playlists.Options.GetPlaylistThresholds().GenreMinTrackCount)
 }
 
 // Helper to get the max number of tracks in common
-func getTracksInCommonCount(trackList map[int][]*spotify.FullTrack) int {
+func getTracksInCommonCount(trackList map[int][]*clientcommon.Track) int {
 	tracksInCommonCount := 0
 
 	for _, tracks := range trackList {
@@ -514,7 +636,7 @@ func getTracksInCommonCount(trackList map[int][]*spotify.FullTrack) int {
 }
 
 func (playlists *CommonPlaylists) createPlaylistForMinCount(name string, type_ string, rank int, rankForType int,
-	tracksPerSharedCount map[int][]*spotify.FullTrack, minCount int) {
+	tracksPerSharedCount map[int][]*clientcommon.Track, minCount int) {
 
 	count := 0
 
@@ -528,7 +650,22 @@ func (playlists *CommonPlaylists) createPlaylistForMinCount(name string, type_ s
 }
 
 func (playlists *CommonPlaylists) createPlaylist(
-	name string, type_ string, rank int, rankForType int, tracksPerSharedCount map[int][]*spotify.FullTrack) *Playlist {
+	name string, type_ string, rank int, rankForType int, tracksPerSharedCount map[int][]*clientcommon.Track) *Playlist {
+	return playlists.addPlaylist(name, type_, rank, rankForType, tracksPerSharedCount,
+		playlists.SharedTracksRankAboveMinThreshold, playlists.SharedTracksScore)
+}
+
+// The maps of the shared tracks are stored with every playlist, so a playlist of tracks that are not shared keeps
+// who saved its tracks and their score in its own maps
+func (playlists *CommonPlaylists) createPlaylistWithOwnUserIds(name string, type_ string, rank int, rankForType int,
+	tracksPerSharedCount map[int][]*clientcommon.Track, userIdsPerTrack map[string][]string) *Playlist {
+	return playlists.addPlaylist(name, type_, rank, rankForType, tracksPerSharedCount, userIdsPerTrack,
+		make(map[string]float64))
+}
+
+func (playlists *CommonPlaylists) addPlaylist(name string, type_ string, rank int, rankForType int,
+	tracksPerSharedCount map[int][]*clientcommon.Track, userIdsPerTrack map[string][]string,
+	scorePerTrack map[string]float64) *Playlist {
 
 	playlistId := utils.GenerateStrongHash()
 	playlist := &Playlist{
@@ -541,10 +678,14 @@ func (playlists *CommonPlaylists) createPlaylist(
 			getTracksInCommonCount(tracksPerSharedCount),
 		},
 		tracksPerSharedCount,
-		playlists.SharedTracksRankAboveMinThreshold,
+		userIdsPerTrack,
+		scorePerTrack,
 		playlists.Users,
 	}
 	playlists.Playlists[playlistId] = playlist
 
+	// the tracks are always in the order of their score
+	playlists.rankTracks(playlist)
+
 	return playlist
 }
@@ -0,0 +1,143 @@
+package app
+
+import (
+	"errors"
+	"github.com/shared-spotify/musicclient/clientcommon"
+)
+
+// Options chosen when launching the processing of a room, they are kept on the room so it is processed again the
+// same way
+
+var ErrorInvalidMinSharedUsers = errors.New("Invalid min shared users, it must be between 2 and the number of users " +
+	"in the room")
+var ErrorUnknownLibrarySource = errors.New("Unknown library source")
+
+type ProcessingOptions struct {
+	// The min number of users having a track for it to be shared, minNumberOfUserForCommonMusic if 0
+	MinSharedUsers int `json:"min_shared_users"`
+	// The parts of the libraries of the users to include, the liked songs and owned playlists if empty
+	Sources clientcommon.LibrarySources `json:"sources"`
+	// The weight of the tracks of each source when ranking the shared tracks, DefaultSourceWeights for the missing ones
+	SourceWeights SourceWeights `json:"source_weights"`
+	// The names of the playlist generators to run, all of them run if empty
+	Generators             []string                `json:"generators"`
+	PlaylistThresholds     *PlaylistThresholds     `json:"playlist_thresholds"`
+	AudioFeatureThresholds *AudioFeatureThresholds `json:"audio_feature_thresholds"`
+	OverlapThresholds      *OverlapThresholds      `json:"overlap_thresholds"`
+	// The explicit tracks are excluded from all the playlists exported from the room
+	FamilySafe bool `json:"family_safe"`
+}
+
+func (options *ProcessingOptions) Validate(totalUsers int) error {
+	if options.MinSharedUsers != 0 &&
+		(options.MinSharedUsers < minNumberOfUserForCommonMusic || options.MinSharedUsers > totalUsers) {
+		return ErrorInvalidMinSharedUsers
+	}
+
+	for _, source := range options.Sources {
+		if !clientcommon.IsLibrarySource(source) {
+			return ErrorUnknownLibrarySource
+		}
+	}
+
+	err := options.SourceWeights.Validate()
+
+	if err != nil {
+		return err
+	}
+
+	for _, name := range options.Generators {
+		if _, ok := GetPlaylistGenerator(name); !ok {
+			return ErrorUnknownPlaylistGenerator
+		}
+	}
+
+	if options.PlaylistThresholds != nil {
+		err = options.PlaylistThresholds.Validate()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if options.AudioFeatureThresholds != nil {
+		err = options.AudioFeatureThresholds.Validate()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if options.OverlapThresholds != nil {
+		return options.OverlapThresholds.Validate()
+	}
+
+	return nil
+}
+
+func (options *ProcessingOptions) GetMinSharedUsers() int {
+	if options == nil || options.MinSharedUsers == 0 {
+		return minNumberOfUserForCommonMusic
+	}
+
+	return options.MinSharedUsers
+}
+
+func (options *ProcessingOptions) GetLibrarySources() clientcommon.LibrarySources {
+	if options == nil {
+		return clientcommon.DefaultLibrarySources
+	}
+
+	return options.Sources.OrDefault()
+}
+
+func (options *ProcessingOptions) GetSourceWeights() SourceWeights {
+	if options == nil {
+		return DefaultSourceWeights
+	}
+
+	return options.SourceWeights.withDefaults()
+}
+
+func (options *ProcessingOptions) GetPlaylistThresholds() PlaylistThresholds {
+	if options == nil {
+		return DefaultPlaylistThresholds
+	}
+
+	return options.PlaylistThresholds.withDefaults()
+}
+
+func (options *ProcessingOptions) GetAudioFeatureThresholds() AudioFeatureThresholds {
+	if options == nil {
+		return DefaultAudioFeatureThresholds
+	}
+
+	return options.AudioFeatureThresholds.withDefaults()
+}
+
+func (options *ProcessingOptions) GetOverlapThresholds() OverlapThresholds {
+	if options == nil {
+		return DefaultOverlapThresholds
+	}
+
+	thresholds := options.OverlapThresholds.withDefaults()
+
+	// the artists and albums are shared by as many users as the tracks unless chosen otherwise
+	if options.OverlapThresholds == nil || options.OverlapThresholds.MinSharedUsers == 0 {
+		thresholds.MinSharedUsers = options.GetMinSharedUsers()
+	}
+
+	return thresholds
+}
+
+func (options *ProcessingOptions) GetPlaylistGenerators() []PlaylistGenerator {
+	if options == nil || len(options.Generators) == 0 {
+		return GetPlaylistGenerators()
+	}
+
+	return getPlaylistGeneratorsWithNames(options.Generators)
+}
+
+func (options *ProcessingOptions) IsFamilySafe() bool {
+	return options != nil && options.FamilySafe
+}
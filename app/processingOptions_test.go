@@ -0,0 +1,27 @@
+package app
+
+import "testing"
+
+func TestProcessingOptionsValidateMinSharedUsers(t *testing.T) {
+	tests := []struct {
+		name           string
+		minSharedUsers int
+		expected       error
+	}{
+		{"default", 0, nil},
+		{"min", minNumberOfUserForCommonMusic, nil},
+		{"all users", 3, nil},
+		{"below min", 1, ErrorInvalidMinSharedUsers},
+		{"more than the users", 4, ErrorInvalidMinSharedUsers},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options := ProcessingOptions{MinSharedUsers: test.minSharedUsers}
+
+			if err := options.Validate(3); err != test.expected {
+				t.Errorf("Expected %v, got %v", test.expected, err)
+			}
+		})
+	}
+}
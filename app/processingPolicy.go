@@ -0,0 +1,53 @@
+package app
+
+import (
+	"errors"
+	"time"
+)
+
+// The processing policy of a room decides what happens when the songs of some users of the room cannot be fetched
+//   fail_fast: the processing of the room fails as soon as one user fails
+//   quorum: the processing continues without the users that failed, as long as min users succeeded
+
+const ProcessingPolicyFailFast = "fail_fast"
+const ProcessingPolicyQuorum = "quorum"
+
+var ErrorInvalidProcessingPolicy = errors.New("Invalid processing policy, mode must be fail_fast or quorum, " +
+	"and the min users of a quorum must be between 2 and the number of users in the room")
+
+type ProcessingPolicy struct {
+	Mode     string `json:"mode"`
+	MinUsers int    `json:"min_users"` // only used by quorum
+}
+
+// A user left out of the processing of a room, it can retry later to be added to the playlists of the room
+type ExcludedUser struct {
+	UserId     string    `json:"user_id"`
+	Reason     string    `json:"reason"`
+	ExcludedAt time.Time `json:"excluded_at"`
+}
+
+func (policy *ProcessingPolicy) Validate(totalUsers int) error {
+	switch policy.Mode {
+
+	case ProcessingPolicyFailFast:
+		return nil
+	case ProcessingPolicyQuorum:
+		if policy.MinUsers < minNumberOfUserForCommonMusic || policy.MinUsers > totalUsers {
+			return ErrorInvalidProcessingPolicy
+		}
+
+		return nil
+	default:
+		return ErrorInvalidProcessingPolicy
+	}
+}
+
+// no policy means fail fast, which is how rooms were always processed
+func (policy *ProcessingPolicy) IsQuorum() bool {
+	return policy != nil && policy.Mode == ProcessingPolicyQuorum
+}
+
+func (policy *ProcessingPolicy) HasQuorum(succeededUsers int) bool {
+	return succeededUsers >= policy.MinUsers && succeededUsers >= minNumberOfUserForCommonMusic
+}
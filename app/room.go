@@ -6,17 +6,21 @@ import (
 	"github.com/shared-spotify/musicclient"
 	"github.com/shared-spotify/musicclient/clientcommon"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"sync"
 	"time"
 )
 
 type Room struct {
-	Id           string               `json:"id" bson:"_id"`
-	Name         string               `json:"name"`
-	Owner        *clientcommon.User   `json:"owner"`
-	Users        []*clientcommon.User `json:"users"`
-	CreationTime time.Time            `json:"creation_time"`
-	Locked       *bool                `json:"locked"`
-	MusicLibrary *SharedMusicLibrary  `json:"shared_music_library"`
+	Id                 string                                     `json:"id" bson:"_id"`
+	Name               string                                     `json:"name"`
+	Owner              *clientcommon.User                         `json:"owner"`
+	Users              []*clientcommon.User                       `json:"users"`
+	CreationTime       time.Time                                  `json:"creation_time"`
+	Locked             *bool                                      `json:"locked"`
+	MusicLibrary       *SharedMusicLibrary                        `json:"shared_music_library"`
+	ProcessingPolicy   *ProcessingPolicy                          `json:"processing_policy"`
+	ProcessingOptions  *ProcessingOptions                         `json:"processing_options"`
+	PlaylistSelections map[string]*clientcommon.PlaylistSelection `json:"playlist_selections"` // per user id
 }
 
 type RoomWithOwnerInfo struct {
@@ -34,6 +38,9 @@ func CreateRoom(roomId string, roomName string, owner *clientcommon.User) *Room
 		time.Now(),
 		&locked,
 		nil,
+		nil,
+		nil,
+		nil,
 	}
 
 	// Add the owner to the room
@@ -51,6 +58,18 @@ func (room *Room) AddUser(user *clientcommon.User) {
 	room.Users = append(room.Users, user)
 }
 
+func (room *Room) RemoveUser(user *clientcommon.User) {
+	users := make([]*clientcommon.User, 0)
+
+	for _, roomUser := range room.Users {
+		if !roomUser.IsEqual(user) {
+			users = append(users, roomUser)
+		}
+	}
+
+	room.Users = users
+}
+
 func (room *Room) IsUserInRoom(user *clientcommon.User) bool {
 	for _, roomUser := range room.Users {
 		if roomUser.IsEqual(user) {
@@ -73,6 +92,19 @@ func (room *Room) IsOwner(user *clientcommon.User) bool {
 	return room.Owner.IsEqual(user)
 }
 
+// Replaces the user in the room, and the owner if it is the same user, used to update the client and token of a user
+func (room *Room) ReplaceUser(user *clientcommon.User) {
+	for i, roomUser := range room.Users {
+		if roomUser.IsEqual(user) {
+			room.Users[i] = user
+		}
+	}
+
+	if room.IsOwner(user) {
+		room.Owner = user
+	}
+}
+
 func (room *Room) HasRoomBeenProcessed() bool {
 	return room.MusicLibrary != nil && room.MusicLibrary.HasProcessingFinished()
 }
@@ -81,10 +113,19 @@ func (room *Room) HasRoomBeenProcessedSuccessfully() bool {
 	return room.MusicLibrary != nil && room.MusicLibrary.HasProcessingSucceeded()
 }
 
+func (room *Room) HasProcessingBeenCancelled() bool {
+	return room.MusicLibrary != nil && room.MusicLibrary.HasProcessingBeenCancelled()
+}
+
 func (room *Room) HasProcessingTimedOut() bool {
 	return room.MusicLibrary != nil && room.MusicLibrary.HasTimedOut()
 }
 
+func (room *Room) IsProcessingInProgress() bool {
+	return room.MusicLibrary != nil && !room.MusicLibrary.HasProcessingFinished() &&
+		!room.MusicLibrary.HasProcessingBeenCancelled() && !room.MusicLibrary.HasTimedOut()
+}
+
 func (room *Room) GetPlaylists() map[string]*Playlist {
 	return room.MusicLibrary.CommonPlaylists.Playlists
 }
@@ -93,28 +134,89 @@ func (room *Room) SetPlaylists(playlists map[string]*Playlist) {
 	room.MusicLibrary.CommonPlaylists = &CommonPlaylists{Playlists: playlists}
 }
 
+func (room *Room) GetCompatibility() *CompatibilityMatrix {
+	return room.MusicLibrary.CommonPlaylists.Compatibility
+}
+
+func (room *Room) SetCompatibility(compatibility *CompatibilityMatrix) {
+	room.MusicLibrary.CommonPlaylists.Compatibility = compatibility
+}
+
+// Returns the playlists the user chose for the room, nil if he did not choose any
+func (room *Room) GetPlaylistSelection(user *clientcommon.User) *clientcommon.PlaylistSelection {
+	if room.PlaylistSelections == nil {
+		return nil
+	}
+
+	return room.PlaylistSelections[user.GetId()]
+}
+
+func (room *Room) SetPlaylistSelection(user *clientcommon.User, selection *clientcommon.PlaylistSelection) {
+	if room.PlaylistSelections == nil {
+		room.PlaylistSelections = make(map[string]*clientcommon.PlaylistSelection)
+	}
+
+	room.PlaylistSelections[user.GetId()] = selection
+}
+
 func (room *Room) ResetMusicLibrary() {
+	// an incremental processing is marked as failed instead, so it is launched again the same way
+	if room.MusicLibrary != nil && room.MusicLibrary.IsIncremental() {
+		success := false
+		room.MusicLibrary.SetProcessingSuccess(&success)
+		return
+	}
+
 	room.MusicLibrary = nil
 }
 
+// Creates the library to launch the processing of the room, a room already processed only fetches the songs of
+// the users not in its result
+func (room *Room) CreateMusicLibraryForProcessing() *SharedMusicLibrary {
+	if room.HasRoomBeenProcessedSuccessfully() {
+		return room.MusicLibrary.CreateIncrementalLibrary(room.Users, nil)
+	}
+
+	// an incremental processing that failed or was cancelled is launched again the same way
+	if room.MusicLibrary != nil && room.MusicLibrary.IsIncremental() {
+		return room.MusicLibrary.Restart(len(room.Users))
+	}
+
+	return CreateSharedMusicLibrary(len(room.Users))
+}
+
+// Returns true if the library of the user is reused the next time the room is processed, so its sources and
+// playlists cannot change
+func (room *Room) IsUserLibraryReused(user *clientcommon.User) bool {
+	return room.MusicLibrary != nil && room.CreateMusicLibraryForProcessing().isUserReused(user)
+}
+
 func (room *Room) RecreateClients(ctx context.Context) error {
 	span, ctx := tracer.StartSpanFromContext(ctx, "clients.recreate")
 	defer span.Finish()
 
-	owner, err := recreateUserWithClient(room.Owner)
+	// the users whose songs are not fetched do not need a client, their token might not even be stored anymore
+	if room.needsClient(room.Owner) {
+		owner, err := recreateUserWithClient(room.Owner)
 
-	if err != nil {
-		span.Finish(tracer.WithError(err))
-		logger.Logger.Errorf("Failed to recreate client for owner %v %v", err, span)
-		return err
-	}
+		if err != nil {
+			span.Finish(tracer.WithError(err))
+			logger.Logger.Errorf("Failed to recreate client for owner %v %v", err, span)
+			return err
+		}
 
-	room.Owner = owner
+		room.Owner = owner
+	}
 
 	usersWithClients := make([]*clientcommon.User, 0)
 	users := room.Users
 
 	for _, user := range users {
+		if !room.needsClient(user) {
+			usersWithClients = append(usersWithClients, user)
+			continue
+		}
+
 		newUser, err := recreateUserWithClient(user)
 
 		if err != nil {
@@ -131,9 +233,13 @@ func (room *Room) RecreateClients(ctx context.Context) error {
 	return nil
 }
 
+func (room *Room) needsClient(user *clientcommon.User) bool {
+	return room.MusicLibrary == nil || room.MusicLibrary.NeedsFetching(user)
+}
+
 func recreateUserWithClient(user *clientcommon.User) (*clientcommon.User, error) {
 	loginType := user.LoginType
-	token := user.Token
+	token := user.GetToken()
 
 	return musicclient.CreateUserFromToken(token, loginType, nil)
 }
@@ -150,7 +256,12 @@ func (room *Room) IsExpired(ctx context.Context) bool {
 	}
 
 	for _, user := range room.Users {
-		_, err := musicclient.CreateUserFromToken(user.Token, user.LoginType, nil)
+		// the users from a previous result do not keep their token
+		if !room.needsClient(user) {
+			continue
+		}
+
+		_, err := musicclient.CreateUserFromToken(user.GetToken(), user.LoginType, nil)
 
 		if err != nil {
 			span.SetTag("expired", true)
@@ -167,22 +278,56 @@ func (room *Room) IsExpired(ctx context.Context) bool {
   Room processing
  */
 
-var cancels = make(map[string]context.CancelFunc)
+// Registry of the cancel functions for the rooms processed in this process, it is used concurrently by the
+// requests, the workers and the processing callbacks
+type cancelRegistry struct {
+	mutex   sync.Mutex
+	cancels map[string]context.CancelFunc
+}
+
+var cancels = &cancelRegistry{cancels: make(map[string]context.CancelFunc)}
 
 func AddCancel(roomId string, cancel context.CancelFunc) {
-	cancels[roomId] = cancel
+	cancels.mutex.Lock()
+	defer cancels.mutex.Unlock()
+
+	cancels.cancels[roomId] = cancel
 }
 
 func RemoveCancel(roomId string) {
-	delete(cancels, roomId)
+	cancels.mutex.Lock()
+	defer cancels.mutex.Unlock()
+
+	delete(cancels.cancels, roomId)
+}
+
+// Cancels the processing of the room, returns false if the room is not processed in this process
+func Cancel(roomId string) bool {
+	cancels.mutex.Lock()
+	cancel, ok := cancels.cancels[roomId]
+	delete(cancels.cancels, roomId)
+	cancels.mutex.Unlock()
+
+	if !ok {
+		return false
+	}
+
+	logger.WithRoom(roomId).Warning("Cancelling processing for room")
+	cancel()
+
+	return true
 }
 
 func CancelAll() {
-	for roomId, cancel := range cancels {
+	cancels.mutex.Lock()
+	roomCancels := cancels.cancels
+
+	// reinitialise the map to be sure we never call cancel twice
+	cancels.cancels = make(map[string]context.CancelFunc)
+	cancels.mutex.Unlock()
+
+	for roomId, cancel := range roomCancels {
 		logger.WithRoom(roomId).Warning("Cancelling processing for room")
 		cancel()
 	}
-
-	// reinitialise the map to be sure we never call cancel twice
-	cancels = make(map[string]context.CancelFunc)
-}
\ No newline at end of file
+}
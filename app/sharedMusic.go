@@ -4,9 +4,10 @@ import (
 	"context"
 	"errors"
 	"github.com/shared-spotify/logger"
+	"github.com/shared-spotify/mongoclient"
 	"github.com/shared-spotify/musicclient"
 	"github.com/shared-spotify/musicclient/clientcommon"
-	"github.com/zmb3/spotify"
+	"github.com/thoas/go-funk"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 	"runtime/debug"
 	"time"
@@ -16,6 +17,11 @@ const TimeoutRoomProcessing = 18 * time.Minute      // wait 18min before we kill
 const TimeoutRoomForReProcessing = 20 * time.Minute // 20min before we can re trigger a processing
 
 var ErrorPlaylistTypeNotFound = errors.New("playlist type id not found")
+var ErrorQuorumNotReached = errors.New("not enough users succeeded to reach the quorum of the room")
+var ErrorReusedLibraryChanged = errors.New("the library of the user was fetched with other sources or playlists " +
+	"than the ones of the room, the user needs to join the room again")
+var ErrorReusedLibraryOptionsChanged = errors.New("the sources and playlists of the users in the result of the room " +
+	"cannot change when it is processed again, their libraries are reused")
 
 type SharedMusicLibrary struct {
 	TotalUsers           int                      `json:"total_users"`
@@ -26,12 +32,17 @@ type SharedMusicLibrary struct {
 }
 
 type ProcessingStatus struct {
-	TotalToProcess   int       `json:"total_to_process"`
-	AlreadyProcessed int       `json:"already_processed"`
-	Started          bool      `json:"started"`
-	StartedAt        time.Time `json:"started_at"`
-	CheckpointTime   time.Time `json:"checkpoint_time"`  // time for the last time we got an update
-	Success          *bool     `json:"success"`
+	TotalToProcess   int             `json:"total_to_process"`
+	AlreadyProcessed int             `json:"already_processed"`
+	Started          bool            `json:"started"`
+	StartedAt        time.Time       `json:"started_at"`
+	CheckpointTime   time.Time       `json:"checkpoint_time"`   // time for the last time we got an update
+	Success          *bool           `json:"success"`
+	Cancelled        bool            `json:"cancelled"`         // the owner stopped the processing, it can be launched again
+	ExcludedUsers    []*ExcludedUser `json:"excluded_users"`    // users left out with a quorum policy
+	IncludedUserIds  []string        `json:"included_user_ids"` // users whose songs are in the result
+	ReusedUserIds    []string        `json:"reused_user_ids"`   // users whose library snapshot is used, not fetched
+	SkippedUserIds   []string        `json:"skipped_user_ids"`  // excluded users from a previous result not retried
 }
 
 func (musicLibrary *SharedMusicLibrary) SetProcessingSuccess(success *bool) {
@@ -50,11 +61,51 @@ func (musicLibrary *SharedMusicLibrary) HasProcessingFinished() bool {
 	return musicLibrary.ProcessingStatus.Success != nil
 }
 
+func (musicLibrary *SharedMusicLibrary) HasProcessingBeenCancelled() bool {
+	return musicLibrary.ProcessingStatus.Cancelled
+}
+
+func (musicLibrary *SharedMusicLibrary) SetProcessingCancelled() {
+	musicLibrary.ProcessingStatus.Cancelled = true
+}
+
 func (musicLibrary *SharedMusicLibrary) HasTimedOut() bool {
-	return !musicLibrary.HasProcessingFinished() &&
+	return !musicLibrary.HasProcessingFinished() && !musicLibrary.HasProcessingBeenCancelled() &&
 		time.Now().Sub(musicLibrary.ProcessingStatus.CheckpointTime) > TimeoutRoomForReProcessing
 }
 
+func (musicLibrary *SharedMusicLibrary) IsUserExcluded(user *clientcommon.User) bool {
+	return musicLibrary.GetExcludedUser(user) != nil
+}
+
+func (musicLibrary *SharedMusicLibrary) GetExcludedUser(user *clientcommon.User) *ExcludedUser {
+	for _, excludedUser := range musicLibrary.ProcessingStatus.ExcludedUsers {
+		if excludedUser.UserId == user.GetId() {
+			return excludedUser
+		}
+	}
+
+	return nil
+}
+
+func (musicLibrary *SharedMusicLibrary) excludeUser(user *clientcommon.User, err error) {
+	musicLibrary.ProcessingStatus.ExcludedUsers = append(musicLibrary.ProcessingStatus.ExcludedUsers,
+		&ExcludedUser{user.GetId(), err.Error(), time.Now()})
+}
+
+func (musicLibrary *SharedMusicLibrary) isUserReused(user *clientcommon.User) bool {
+	return funk.ContainsString(musicLibrary.ProcessingStatus.ReusedUserIds, user.GetId())
+}
+
+func (musicLibrary *SharedMusicLibrary) isUserSkipped(user *clientcommon.User) bool {
+	return funk.ContainsString(musicLibrary.ProcessingStatus.SkippedUserIds, user.GetId())
+}
+
+// Returns true if the songs of the user are fetched from its music provider during the processing
+func (musicLibrary *SharedMusicLibrary) NeedsFetching(user *clientcommon.User) bool {
+	return !musicLibrary.isUserReused(user) && !musicLibrary.isUserSkipped(user)
+}
+
 func (musicLibrary *SharedMusicLibrary) GetProcessingTime() float64 {
 	return musicLibrary.ProcessingStatus.CheckpointTime.Sub(musicLibrary.ProcessingStatus.StartedAt).Seconds()
 }
@@ -71,7 +122,7 @@ func (musicLibrary *SharedMusicLibrary) GetPlaylist(id string) (*Playlist, error
 
 type MusicFetchingResult struct {
 	User   *clientcommon.User
-	Tracks []*spotify.FullTrack
+	Tracks []*clientcommon.Track
 	Error  error
 }
 
@@ -90,13 +141,83 @@ func CreateSharedMusicLibrary(totalUsers int) *SharedMusicLibrary {
 			false,
 			time.Now(),
 			time.Now(),
-			nil},
+			nil,
+			false,
+			make([]*ExcludedUser, 0),
+			make([]string, 0),
+			make([]string, 0),
+			make([]string, 0)},
 		make(chan MusicFetchingResult, totalUsers), // Channel needs to be only as big as the number of users
 		make(chan MusicProcessingResult, 1), // only 1 message in this channel
 		nil,
 	}
 }
 
+// Creates a library to process again a room that was already processed, the songs of the users given are taken from
+// their library snapshot, and the excluded users that are skipped stay excluded with their previous reason
+func createSharedMusicLibraryFromPrevious(totalUsers int, reusedUserIds []string, skippedUsers []*ExcludedUser) *SharedMusicLibrary {
+	musicLibrary := CreateSharedMusicLibrary(totalUsers)
+	musicLibrary.ProcessingStatus.ReusedUserIds = reusedUserIds
+
+	for _, skippedUser := range skippedUsers {
+		musicLibrary.ProcessingStatus.ExcludedUsers = append(musicLibrary.ProcessingStatus.ExcludedUsers, skippedUser)
+		musicLibrary.ProcessingStatus.SkippedUserIds = append(musicLibrary.ProcessingStatus.SkippedUserIds,
+			skippedUser.UserId)
+	}
+
+	return musicLibrary
+}
+
+// Creates a library to process the room from scratch, keeping what was decided before the processing started
+func (musicLibrary *SharedMusicLibrary) Restart(totalUsers int) *SharedMusicLibrary {
+	skippedUsers := make([]*ExcludedUser, 0)
+
+	for _, excludedUser := range musicLibrary.ProcessingStatus.ExcludedUsers {
+		if funk.ContainsString(musicLibrary.ProcessingStatus.SkippedUserIds, excludedUser.UserId) {
+			skippedUsers = append(skippedUsers, excludedUser)
+		}
+	}
+
+	return createSharedMusicLibraryFromPrevious(totalUsers, musicLibrary.ProcessingStatus.ReusedUserIds,
+		skippedUsers)
+}
+
+// Creates a library to process again the room of a successful result, the users in the result are reused, so only
+// the songs of the users that joined since, and of the user retried if any, are fetched
+func (musicLibrary *SharedMusicLibrary) CreateIncrementalLibrary(users []*clientcommon.User,
+	retriedUser *clientcommon.User) *SharedMusicLibrary {
+	reusedUserIds := make([]string, 0)
+	skippedUsers := make([]*ExcludedUser, 0)
+
+	for _, user := range users {
+		if retriedUser != nil && user.IsEqual(retriedUser) {
+			continue
+		}
+
+		// the tokens of the excluded users are not kept in the result, so they can only be retried by themselves
+		if excludedUser := musicLibrary.GetExcludedUser(user); excludedUser != nil {
+			skippedUsers = append(skippedUsers, excludedUser)
+			continue
+		}
+
+		if funk.ContainsString(musicLibrary.ProcessingStatus.IncludedUserIds, user.GetId()) {
+			reusedUserIds = append(reusedUserIds, user.GetId())
+		}
+	}
+
+	return createSharedMusicLibraryFromPrevious(len(users), reusedUserIds, skippedUsers)
+}
+
+// Returns true if the songs of some users come from the snapshot of their library instead of being fetched
+func (musicLibrary *SharedMusicLibrary) HasReusedUsers() bool {
+	return len(musicLibrary.ProcessingStatus.ReusedUserIds) > 0
+}
+
+// Returns true if the library reuses the result of a previous processing
+func (musicLibrary *SharedMusicLibrary) IsIncremental() bool {
+	return len(musicLibrary.ProcessingStatus.ReusedUserIds) > 0 || len(musicLibrary.ProcessingStatus.SkippedUserIds) > 0
+}
+
 /*
   These are the Go routine functions to process the shared music library
 */
@@ -121,6 +242,13 @@ func (musicLibrary *SharedMusicLibrary) Process(room *Room, notifyProcessingOver
 	musicLibrary.CommonPlaylists = CreateCommonPlaylists()
 
 	for _, user := range room.Users {
+		// the users excluded from a previous result are not processed again
+		if musicLibrary.isUserSkipped(user) {
+			logger.WithUser(user.GetUserId()).Infof("Skipping processing for excluded user %v", span)
+			musicLibrary.ProcessingStatus.AlreadyProcessed += 1
+			continue
+		}
+
 		// launch one routine per user to fetch all the songs
 		logger.WithUser(user.GetUserId()).Infof("Launching processing for user %v", span)
 		go musicLibrary.fetchSongsForUser(room, user, ctx)
@@ -153,9 +281,7 @@ func (musicLibrary *SharedMusicLibrary) fetchSongsForUser(room *Room, user *clie
 		}
 	}()
 
-	logger.WithUser(user.GetUserId()).Infof("Fetching songs for user %v", span)
-
-	tracks, err := musicclient.GetAllSongs(user)
+	tracks, err := musicLibrary.getSongsForUser(room, user, ctx)
 
 	if err != nil {
 		logger.WithUserAndRoom(user.GetUserId(), room.Id).
@@ -167,6 +293,9 @@ func (musicLibrary *SharedMusicLibrary) fetchSongsForUser(room *Room, user *clie
 			Infof("Fetching songs for user finished successfully with %d tracks found %v", len(tracks), span)
 	}
 
+	success := err == nil
+	PublishRoomEvent(&RoomEvent{RoomId: room.Id, Type: RoomEventUserFetched, UserId: user.GetId(), Success: &success})
+
 	// We send in the channel the result after processing the music for this user
 	musicLibrary.MusicFetchingChannel <- MusicFetchingResult{user, tracks, err}
 }
@@ -201,6 +330,17 @@ func (musicLibrary *SharedMusicLibrary) addSongsToLibraryAndFindMostCommonSongs(
 	// Fetch all the music for each user, setting the success result on success/failure
 	musicLibrary.getUserMusic(room, &success, saveMusicLibrary, ctx)
 
+	// with a quorum, the processing only continues if enough users were not excluded
+	succeededUsers := len(musicLibrary.CommonPlaylists.Users)
+
+	if success && room.ProcessingPolicy.IsQuorum() && !room.ProcessingPolicy.HasQuorum(succeededUsers) {
+		logger.WithRoom(room.Id).
+			WithError(ErrorQuorumNotReached).
+			Errorf("Only %d users succeeded, the quorum is %d users %v", succeededUsers,
+				room.ProcessingPolicy.MinUsers, span)
+		success = false
+	}
+
 	logger.Logger.Infof("All music fetching results received - success=%t %v", success, span)
 
 	if success {
@@ -233,7 +373,15 @@ func (musicLibrary *SharedMusicLibrary) getUserMusic(room *Room, success *bool,
 
 			logger.WithUser(user.GetUserId()).Info("Received music fetching result for user")
 
-			if musicProcessingResult.Error != nil {
+			if musicProcessingResult.Error != nil && room.ProcessingPolicy.IsQuorum() {
+				logger.WithUserAndRoom(user.GetUserId(), room.Id).
+					WithError(musicProcessingResult.Error).
+					Warning("Music fetching failed for user, excluding user from processing")
+
+				// the user is left out, the quorum is checked once we received the results for all the users
+				musicLibrary.excludeUser(user, musicProcessingResult.Error)
+
+			} else if musicProcessingResult.Error != nil {
 				logger.WithUserAndRoom(user.GetUserId(), room.Id).
 					WithError(musicProcessingResult.Error).
 					Error("Music fetching failed for user")
@@ -247,6 +395,8 @@ func (musicLibrary *SharedMusicLibrary) getUserMusic(room *Room, success *bool,
 
 				// we add the tracks as all went fine
 				musicLibrary.CommonPlaylists.addTracks(musicProcessingResult.User, musicProcessingResult.Tracks)
+				musicLibrary.ProcessingStatus.IncludedUserIds = append(musicLibrary.ProcessingStatus.IncludedUserIds,
+					user.GetId())
 			}
 
 			// Mark one user's music as processed
@@ -264,6 +414,74 @@ func (musicLibrary *SharedMusicLibrary) getUserMusic(room *Room, success *bool,
 	}
 }
 
+// The songs of the user come from its library snapshot when it is reused or still fresh with the same sources and
+// playlists, otherwise they are fetched from the music provider of the user and a new snapshot is saved
+func (musicLibrary *SharedMusicLibrary) getSongsForUser(room *Room, user *clientcommon.User,
+	ctx context.Context) ([]*clientcommon.Track, error) {
+	span, _ := tracer.SpanFromContext(ctx)
+	libraryOptions := clientcommon.CreateLibraryOptions(room.ProcessingOptions.GetLibrarySources(),
+		room.GetPlaylistSelection(user))
+
+	if musicLibrary.isUserReused(user) {
+		return getSongsForReusedUser(room, user, libraryOptions, ctx)
+	}
+
+	snapshot, err := mongoclient.GetLibrarySnapshot(user.GetId(), ctx)
+
+	if err == nil && snapshot.IsFresh() && snapshot.HasOptions(libraryOptions) {
+		logger.WithUser(user.GetUserId()).Infof("Getting songs for user from library snapshot synced at %s %v",
+			snapshot.FetchedAt, span)
+		tracks, err := mongoclient.GetLibrarySnapshotTracks(snapshot)
+
+		if err == nil {
+			// the room keeps the library it got, so the user gets it back if reused, like after fetching it
+			_ = mongoclient.SaveRoomLibrarySnapshot(snapshot, room.Id, ctx)
+			return tracks, nil
+		}
+	}
+
+	logger.WithUser(user.GetUserId()).Infof("Fetching songs for user %v", span)
+	tracks, err := musicclient.GetAllSongs(user, libraryOptions, fetchProgressHook(room.Id, user))
+
+	if err != nil {
+		return nil, err
+	}
+
+	// the snapshot is only used to avoid fetching the songs again, so we continue if we fail to save it
+	_ = mongoclient.SaveLibrarySnapshot(user, room.Id, libraryOptions, tracks, ctx)
+
+	return tracks, nil
+}
+
+// A reused user cannot be fetched again, so the library it had in the room is used. The rooms processed before they
+// kept the library of their users use the latest one of the user, as long as it was fetched the same way
+func getSongsForReusedUser(room *Room, user *clientcommon.User, libraryOptions *clientcommon.LibraryOptions,
+	ctx context.Context) ([]*clientcommon.Track, error) {
+	span, _ := tracer.SpanFromContext(ctx)
+
+	snapshot, err := mongoclient.GetRoomLibrarySnapshot(user.GetId(), room.Id, ctx)
+
+	if err == mongoclient.ErrLibrarySnapshotNotFound {
+		logger.WithUserAndRoom(user.GetUserId(), room.Id).
+			Warningf("No library snapshot kept for user in room, using the latest one %v", span)
+		snapshot, err = mongoclient.GetLibrarySnapshot(user.GetId(), ctx)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !snapshot.HasOptions(libraryOptions) {
+		logger.WithUserAndRoom(user.GetUserId(), room.Id).
+			Errorf("Library snapshot of reused user was fetched with sources %v and not %v %v", snapshot.Sources,
+				libraryOptions.Sources, span)
+		return nil, ErrorReusedLibraryChanged
+	}
+
+	logger.WithUser(user.GetUserId()).Infof("Getting songs for reused user from library snapshot %v", span)
+	return mongoclient.GetLibrarySnapshotTracks(snapshot)
+}
+
 func (musicLibrary *SharedMusicLibrary) processUserMusic(room *Room, success *bool, ctx context.Context) {
 	go musicLibrary.generatePlaylists(room)
 
@@ -294,7 +512,8 @@ func (musicLibrary *SharedMusicLibrary) generatePlaylists(room *Room) {
 	}()
 
 	// if everything went well, we now generate the playlists for the users in the room
-	err := musicLibrary.CommonPlaylists.GeneratePlaylists()
+	onPhase, progress := generationPhaseHook(room.Id)
+	err := musicLibrary.CommonPlaylists.GeneratePlaylists(room.ProcessingOptions, onPhase, progress)
 
 	if err != nil {
 		logger.
@@ -0,0 +1,134 @@
+package app
+
+import (
+	"github.com/shared-spotify/musicclient/clientcommon"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newSharedMusicTestUsers(ids ...string) []*clientcommon.User {
+	users := make([]*clientcommon.User, 0)
+
+	for _, id := range ids {
+		users = append(users, &clientcommon.User{UserInfos: &clientcommon.UserInfos{Id: id, Name: id}})
+	}
+
+	return users
+}
+
+// A successful result with the users included, and the ones excluded
+func newProcessedTestLibrary(includedUserIds []string, excludedUserIds []string) *SharedMusicLibrary {
+	success := true
+	musicLibrary := CreateSharedMusicLibrary(len(includedUserIds) + len(excludedUserIds))
+	musicLibrary.SetProcessingSuccess(&success)
+	musicLibrary.ProcessingStatus.IncludedUserIds = includedUserIds
+
+	for _, userId := range excludedUserIds {
+		musicLibrary.ProcessingStatus.ExcludedUsers = append(musicLibrary.ProcessingStatus.ExcludedUsers,
+			&ExcludedUser{userId, "failed", time.Now()})
+	}
+
+	return musicLibrary
+}
+
+func TestCreateIncrementalLibrary(t *testing.T) {
+	// the user 1 and 2 are in the result, 3 was excluded and 4 joined since
+	users := newSharedMusicTestUsers("1", "2", "3", "4")
+	previousLibrary := newProcessedTestLibrary([]string{"1", "2"}, []string{"3"})
+
+	tests := []struct {
+		name            string
+		retriedUser     *clientcommon.User
+		expectedReused  string
+		expectedSkipped string
+		expectedFetched string
+	}{
+		{"new member", nil, "1,2", "3", "4"},
+		{"excluded user retried", users[2], "1,2", "", "3,4"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			musicLibrary := previousLibrary.CreateIncrementalLibrary(users, test.retriedUser)
+
+			status := musicLibrary.ProcessingStatus
+
+			if reused := strings.Join(status.ReusedUserIds, ","); reused != test.expectedReused {
+				t.Errorf("Expected reused users %s, got %s", test.expectedReused, reused)
+			}
+
+			if skipped := strings.Join(status.SkippedUserIds, ","); skipped != test.expectedSkipped {
+				t.Errorf("Expected skipped users %s, got %s", test.expectedSkipped, skipped)
+			}
+
+			fetchedUserIds := make([]string, 0)
+
+			for _, user := range users {
+				if musicLibrary.NeedsFetching(user) {
+					fetchedUserIds = append(fetchedUserIds, user.GetId())
+				}
+			}
+
+			if fetched := strings.Join(fetchedUserIds, ","); fetched != test.expectedFetched {
+				t.Errorf("Expected fetched users %s, got %s", test.expectedFetched, fetched)
+			}
+
+			if !musicLibrary.IsIncremental() || !musicLibrary.HasReusedUsers() || musicLibrary.HasProcessingFinished() {
+				t.Error("Expected an incremental processing reusing users to be launched")
+			}
+		})
+	}
+}
+
+func TestRestartIncrementalLibrary(t *testing.T) {
+	users := newSharedMusicTestUsers("1", "2", "3", "4")
+	musicLibrary := newProcessedTestLibrary([]string{"1", "2"}, []string{"3"}).CreateIncrementalLibrary(users, nil)
+
+	// the processing fails, the user 4 is excluded on the way
+	success := false
+	musicLibrary.excludeUser(users[3], ErrorQuorumNotReached)
+	musicLibrary.SetProcessingSuccess(&success)
+
+	restartedLibrary := musicLibrary.Restart(len(users))
+
+	if reused := strings.Join(restartedLibrary.ProcessingStatus.ReusedUserIds, ","); reused != "1,2" {
+		t.Errorf("Expected the users 1,2 to still be reused, got %s", reused)
+	}
+
+	// only the user skipped before the processing started stays excluded
+	if !restartedLibrary.IsUserExcluded(users[2]) || restartedLibrary.IsUserExcluded(users[3]) {
+		t.Errorf("Expected only the user 3 to be excluded, got %v", restartedLibrary.ProcessingStatus.ExcludedUsers)
+	}
+
+	if restartedLibrary.HasProcessingFinished() {
+		t.Error("Expected the restarted processing not to be finished")
+	}
+}
+
+func TestIsIncremental(t *testing.T) {
+	tests := []struct {
+		name           string
+		reusedUserIds  []string
+		skippedUserIds []string
+		expected       bool
+		expectedReused bool
+	}{
+		{"from scratch", nil, nil, false, false},
+		{"reused users", []string{"1"}, nil, true, true},
+		{"skipped users only", nil, []string{"1"}, true, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			musicLibrary := CreateSharedMusicLibrary(2)
+			musicLibrary.ProcessingStatus.ReusedUserIds = test.reusedUserIds
+			musicLibrary.ProcessingStatus.SkippedUserIds = test.skippedUserIds
+
+			if musicLibrary.IsIncremental() != test.expected || musicLibrary.HasReusedUsers() != test.expectedReused {
+				t.Errorf("Expected incremental %t and reused users %t, got %t and %t", test.expected,
+					test.expectedReused, musicLibrary.IsIncremental(), musicLibrary.HasReusedUsers())
+			}
+		})
+	}
+}
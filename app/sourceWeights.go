@@ -0,0 +1,76 @@
+package app
+
+import (
+	"errors"
+	"github.com/shared-spotify/musicclient/clientcommon"
+)
+
+var ErrorInvalidSourceWeights = errors.New("Invalid source weights, the sources must be known and the weights " +
+	"cannot be negative")
+
+// The weight of a track for a user depends on the library source it comes from, so a song the user listens to a lot
+// counts for more than one buried in an old playlist. The weight of a shared track is the sum of its weights for the
+// users sharing it, and is used to rank the shared tracks
+// A weight left to 0 uses the default one
+type SourceWeights map[string]float64
+
+// the weight of the tracks without source, like the ones of the library snapshots saved before the sources were kept
+const defaultSourceWeight = 1.0
+
+var DefaultSourceWeights = SourceWeights{
+	clientcommon.LibrarySourceLikedSongs:             1.5,
+	clientcommon.LibrarySourceOwnedPlaylists:         1,
+	clientcommon.LibrarySourceFollowedPlaylists:      0.5,
+	clientcommon.LibrarySourceCollaborativePlaylists: 1,
+	clientcommon.LibrarySourceTopTracks:              3,
+	clientcommon.LibrarySourceRecentlyPlayed:         2,
+}
+
+func (weights SourceWeights) Validate() error {
+	for source, weight := range weights {
+		if !clientcommon.IsLibrarySource(source) || weight < 0 {
+			return ErrorInvalidSourceWeights
+		}
+	}
+
+	return nil
+}
+
+func (weights SourceWeights) withDefaults() SourceWeights {
+	withDefaults := make(SourceWeights)
+
+	for source, weight := range DefaultSourceWeights {
+		withDefaults[source] = weight
+	}
+
+	for source, weight := range weights {
+		if weight != 0 {
+			withDefaults[source] = weight
+		}
+	}
+
+	return withDefaults
+}
+
+// A track can come from several sources of the library of a user, the best one gives its weight
+func (weights SourceWeights) getWeight(sources clientcommon.LibrarySources) float64 {
+	if len(sources) == 0 {
+		return defaultSourceWeight
+	}
+
+	bestWeight := 0.0
+
+	for _, source := range sources {
+		weight, ok := weights[source]
+
+		if !ok {
+			weight = defaultSourceWeight
+		}
+
+		if weight > bestWeight {
+			bestWeight = weight
+		}
+	}
+
+	return bestWeight
+}
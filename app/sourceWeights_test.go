@@ -0,0 +1,57 @@
+package app
+
+import (
+	"github.com/shared-spotify/musicclient/clientcommon"
+	"testing"
+)
+
+func TestSourceWeightsValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		weights  SourceWeights
+		expected error
+	}{
+		{"no weights", nil, nil},
+		{"known sources", SourceWeights{clientcommon.LibrarySourceTopTracks: 5, clientcommon.LibrarySourceLikedSongs: 0},
+			nil},
+		{"unknown source", SourceWeights{"unknown": 1}, ErrorInvalidSourceWeights},
+		{"negative weight", SourceWeights{clientcommon.LibrarySourceTopTracks: -1}, ErrorInvalidSourceWeights},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.weights.Validate(); err != test.expected {
+				t.Errorf("Expected %v, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestSourceWeightsGetWeight(t *testing.T) {
+	weights := SourceWeights{clientcommon.LibrarySourceTopTracks: 5, clientcommon.LibrarySourceLikedSongs: 0}.
+		withDefaults()
+
+	tests := []struct {
+		name     string
+		sources  clientcommon.LibrarySources
+		expected float64
+	}{
+		{"no source", nil, defaultSourceWeight},
+		{"weight chosen", clientcommon.LibrarySources{clientcommon.LibrarySourceTopTracks}, 5},
+		{"weight left to 0 uses the default", clientcommon.LibrarySources{clientcommon.LibrarySourceLikedSongs},
+			DefaultSourceWeights[clientcommon.LibrarySourceLikedSongs]},
+		{"default weight", clientcommon.LibrarySources{clientcommon.LibrarySourceFollowedPlaylists},
+			DefaultSourceWeights[clientcommon.LibrarySourceFollowedPlaylists]},
+		{"best source", clientcommon.LibrarySources{clientcommon.LibrarySourceFollowedPlaylists,
+			clientcommon.LibrarySourceTopTracks}, 5},
+		{"unknown source", clientcommon.LibrarySources{"unknown"}, defaultSourceWeight},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if weight := weights.getWeight(test.sources); weight != test.expected {
+				t.Errorf("Expected %f, got %f", test.expected, weight)
+			}
+		})
+	}
+}
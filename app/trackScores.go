@@ -0,0 +1,113 @@
+package app
+
+import (
+	"github.com/shared-spotify/musicclient/clientcommon"
+	"math"
+	"sort"
+	"time"
+)
+
+// The score of a track ranks it among the tracks shared by the same number of users, the tracks shared by more users
+// are always ranked first. It grows with:
+// - the number of users having it
+// - the sources each user has it in, weighted by the source weights, and the number of times he has it
+// - its popularity
+// - how recently the users saved it
+
+const scoreSharedUserWeight = 10.0 // for each user having the track
+const scoreOccurrenceWeight = 0.5  // for each other time a user has the track, like liked and in a playlist
+const maxScoredOccurrences = 5
+const scorePopularityWeight = 2.0 // for a popularity of 100
+const scoreRecencyWeight = 3.0    // for a track saved just now, it halves every half life
+const scoreRecencyHalfLife = 180 * 24 * time.Hour
+
+// How a track is in the library of a user
+type userLibraryTrack struct {
+	sources     clientcommon.LibrarySources
+	occurrences int
+	addedAt     time.Time // the last time the user saved the track, zero if the providers do not give it
+}
+
+func (libraryTrack *userLibraryTrack) add(track *clientcommon.Track) {
+	libraryTrack.occurrences += 1
+
+	if track.LibrarySource != "" && !libraryTrack.sources.Includes(track.LibrarySource) {
+		libraryTrack.sources = append(libraryTrack.sources, track.LibrarySource)
+	}
+
+	if track.AddedAt.After(libraryTrack.addedAt) {
+		libraryTrack.addedAt = track.AddedAt
+	}
+}
+
+func (libraryTrack *userLibraryTrack) getScore(weights SourceWeights, now time.Time) float64 {
+	score := weights.getWeight(libraryTrack.sources)
+
+	otherOccurrences := libraryTrack.occurrences - 1
+
+	if otherOccurrences > maxScoredOccurrences {
+		otherOccurrences = maxScoredOccurrences
+	}
+
+	score += scoreOccurrenceWeight * float64(otherOccurrences)
+
+	if !libraryTrack.addedAt.IsZero() {
+		age := now.Sub(libraryTrack.addedAt)
+
+		if age < 0 {
+			age = 0
+		}
+
+		score += scoreRecencyWeight * math.Pow(0.5, age.Hours()/scoreRecencyHalfLife.Hours())
+	}
+
+	return score
+}
+
+func (playlists *CommonPlaylists) getTrackScore(trackId string, track *clientcommon.Track, weights SourceWeights,
+	now time.Time) float64 {
+	score := scorePopularityWeight * float64(track.Popularity) / 100
+
+	for _, user := range playlists.SharedTracksRank[trackId] {
+		score += scoreSharedUserWeight
+
+		libraryTrack, ok := playlists.LibraryTracksPerUser[user.GetId()][trackId]
+
+		if ok {
+			score += libraryTrack.getScore(weights, now)
+		} else {
+			score += defaultSourceWeight
+		}
+	}
+
+	return score
+}
+
+// Computes the score of the tracks of the playlist, and sorts the tracks of each shared count by score
+func (playlists *CommonPlaylists) rankTracks(playlist *Playlist) {
+	weights := playlists.Options.GetSourceWeights()
+	now := time.Now()
+
+	for _, tracks := range playlist.TracksPerSharedCount {
+		for _, track := range tracks {
+			trackId, _ := clientcommon.GetTrackISRC(track)
+			playlist.ScorePerTrack[trackId] = playlists.getTrackScore(trackId, track, weights, now)
+		}
+
+		sortTracksByScore(tracks, playlist.ScorePerTrack)
+	}
+}
+
+// The tracks with the same score are sorted by id so the order is always the same
+func sortTracksByScore(tracks []*clientcommon.Track, scorePerTrack map[string]float64) {
+	sort.Slice(tracks, func(i, j int) bool {
+		trackIdI, _ := clientcommon.GetTrackISRC(tracks[i])
+		trackIdJ, _ := clientcommon.GetTrackISRC(tracks[j])
+
+		if scorePerTrack[trackIdI] != scorePerTrack[trackIdJ] {
+			return scorePerTrack[trackIdI] > scorePerTrack[trackIdJ]
+		}
+
+		return trackIdI < trackIdJ
+	})
+}
@@ -0,0 +1,115 @@
+package app
+
+import (
+	"github.com/shared-spotify/musicclient/clientcommon"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUserLibraryTrackGetScore(t *testing.T) {
+	now := time.Now()
+	weights := DefaultSourceWeights
+
+	tests := []struct {
+		name         string
+		libraryTrack userLibraryTrack
+		expected     float64
+	}{
+		{"no source", userLibraryTrack{nil, 1, time.Time{}}, defaultSourceWeight},
+		{"liked", userLibraryTrack{clientcommon.LibrarySources{clientcommon.LibrarySourceLikedSongs}, 1, time.Time{}},
+			1.5},
+		{
+			"best source",
+			userLibraryTrack{clientcommon.LibrarySources{clientcommon.LibrarySourceFollowedPlaylists,
+				clientcommon.LibrarySourceTopTracks}, 2, time.Time{}},
+			3 + scoreOccurrenceWeight,
+		},
+		{"occurrences are capped", userLibraryTrack{nil, 20, time.Time{}},
+			defaultSourceWeight + scoreOccurrenceWeight*maxScoredOccurrences},
+		{"saved just now", userLibraryTrack{nil, 1, now}, defaultSourceWeight + scoreRecencyWeight},
+		{"saved a half life ago", userLibraryTrack{nil, 1, now.Add(-scoreRecencyHalfLife)},
+			defaultSourceWeight + scoreRecencyWeight/2},
+		{"saved in the future", userLibraryTrack{nil, 1, now.Add(time.Hour)}, defaultSourceWeight + scoreRecencyWeight},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if score := test.libraryTrack.getScore(weights, now); math.Abs(score-test.expected) > 1e-9 {
+				t.Errorf("Expected %f, got %f", test.expected, score)
+			}
+		})
+	}
+}
+
+func TestGetTracksByScore(t *testing.T) {
+	// the track shared by 2 users has a better score than the ones shared by 3, like with a big source weight
+	playlist := &Playlist{
+		TracksPerSharedCount: map[int][]*clientcommon.Track{
+			3: {{Isrc: "ISRC1"}, {Isrc: "ISRC2"}},
+			2: {{Isrc: "ISRC3"}, {Isrc: "ISRC4"}},
+		},
+		ScorePerTrack: map[string]float64{"ISRC1": 30, "ISRC2": 35, "ISRC3": 25, "ISRC4": 100},
+	}
+
+	tests := []struct {
+		name             string
+		sharedUserCounts []int
+		topCount         int
+		expected         string
+	}{
+		{"all tracks", nil, 0, "ISRC2,ISRC1,ISRC4,ISRC3"},
+		{"top count", nil, 3, "ISRC2,ISRC1,ISRC4"},
+		{"shared user count", []int{2}, 0, "ISRC4,ISRC3"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tracks := playlist.GetTracksByScore(test.sharedUserCounts, test.topCount)
+
+			if isrcs := getScoreTestTrackIsrcs(tracks); isrcs != test.expected {
+				t.Errorf("Expected %s, got %s", test.expected, isrcs)
+			}
+		})
+	}
+
+	// the tracks of the playlist keep their order
+	if isrcs := getScoreTestTrackIsrcs(playlist.TracksPerSharedCount[3]); isrcs != "ISRC1,ISRC2" {
+		t.Errorf("Expected the tracks of the playlist to be unchanged, got %s", isrcs)
+	}
+}
+
+func TestGetTracksByScoreWithoutScores(t *testing.T) {
+	playlist := &Playlist{
+		TracksPerSharedCount: map[int][]*clientcommon.Track{
+			2: {{Isrc: "ISRC3"}, {Isrc: "ISRC1"}},
+			3: {{Isrc: "ISRC2"}},
+		},
+	}
+
+	if isrcs := getScoreTestTrackIsrcs(playlist.GetTracksByScore(nil, 0)); isrcs != "ISRC2,ISRC3,ISRC1" {
+		t.Errorf("Expected ISRC2,ISRC3,ISRC1, got %s", isrcs)
+	}
+}
+
+func TestSortTracksByScore(t *testing.T) {
+	tracks := []*clientcommon.Track{{Isrc: "ISRC3"}, {Isrc: "ISRC2"}, {Isrc: "ISRC1"}}
+
+	// the tracks with the same score are sorted by id
+	sortTracksByScore(tracks, map[string]float64{"ISRC1": 1, "ISRC2": 2, "ISRC3": 1})
+
+	if isrcs := getScoreTestTrackIsrcs(tracks); isrcs != "ISRC2,ISRC1,ISRC3" {
+		t.Errorf("Expected ISRC2,ISRC1,ISRC3, got %s", isrcs)
+	}
+}
+
+func getScoreTestTrackIsrcs(tracks []*clientcommon.Track) string {
+	isrcs := make([]string, 0)
+
+	for _, track := range tracks {
+		isrcs = append(isrcs, track.Isrc)
+	}
+
+	return strings.Join(isrcs, ",")
+}
@@ -27,12 +27,18 @@ const RoomCount = "rooms.new.count"
 const RoomProcessedCount = "rooms.processed.count"
 const RoomProcessedFailed = "rooms.processed.failed"
 const RoomExpired = "rooms.expired"
+const RoomProcessingCancelled = "rooms.processing.cancelled"
+const RoomProcessingRetried = "rooms.processing.retried"
+const RoomUnlocked = "rooms.unlocked"
 const RoomProcessedTime = "rooms.processed.time"
 const TrackForRoom = "rooms.tracks.common.count"
 const RoomUsers = "rooms.users.count"
 const RoomPlaylistAllRequest = "rooms.playlist.all.request"
 const RoomPlaylistRequest = "rooms.playlist.request"
 const RoomPlaylistAdd = "rooms.playlist.add"
+const RoomCompatibilityRequest = "rooms.compatibility.request"
+const RoomLibraryPlaylistsRequest = "rooms.library.playlists.request"
+const RoomPlaylistSelectionUpdate = "rooms.library.playlists.update"
 
 var RoomIdTag = Tag{"room_id"}
 var RoomNameTag = Tag{"room_name"}
@@ -43,6 +49,7 @@ const ApiRequests = "api.requests"
 
 const SpotifyProvider = "spotify"
 const AppleMusicProvider = "applemusic"
+const DeezerProvider = "deezer"
 
 var Provider = Tag{"provider"}
 var RequestType = Tag{"request_type"}
@@ -52,6 +59,8 @@ var Success = Tag{"success"}
 const RequestTypeAuth = "auth"
 const RequestTypeUserInfo = "user_info"
 const RequestTypeSavedSongs = "saved_songs"
+const RequestTypeTopTracks = "top_tracks"
+const RequestTypeRecentlyPlayed = "recently_played"
 const RequestTypePlaylistSongs = "playlist_songs"
 const RequestTypePlaylists = "playlists"
 const RequestTypeSongs = "songs"
@@ -59,5 +68,7 @@ const RequestTypeArtists = "artists"
 const RequestTypeAlbums = "albums"
 const RequestTypeAudioFeatures = "audio_features"
 const RequestTypeSearch = "search"
+const RequestTypeGenreSeeds = "genre_seeds"
+const RequestTypeRecommendations = "recommendations"
 const RequestTypePlaylistCreated = "playlist_created"
 const RequestTypePlaylistSongsAdded = "playlist_songs_added"
@@ -44,6 +44,14 @@ export default function Login() {
     window.location.assign(getUrl('/login?' + encodeParams(params)))
   }
 
+  const signInDeezer = () => {
+    const params = {
+      redirect_uri: redirectUri
+    }
+
+    window.location.assign(getUrl('/login/deezer?' + encodeParams(params)))
+  }
+
   const sendAppleTokens = () => {
     const params = {
       user_id: login.userId,
@@ -151,7 +159,7 @@ export default function Login() {
     )
   }
 
-  // we show spotify and apple music buttons
+  // we show spotify, apple music and deezer buttons
   let buttons = (
     <div className="d-flex flex-column">
       <Button variant="success" size="lg" className={styles.login_button + " mt-5"} onClick={signInSpotify}>
@@ -167,6 +175,12 @@ export default function Login() {
           <span className={styles.connect_apple_text}>Connect with Apple Music</span>
         </div>
       </Button>
+
+      <Button variant="light" size="lg" className={styles.login_button + " mt-2"} onClick={signInDeezer}>
+        <div>
+          <span>Connect with Deezer</span>
+        </div>
+      </Button>
     </div>
   )
 
@@ -212,7 +212,7 @@ export default function Playlist() {
                   return true;
                 }
 
-                let trackISRC = track.external_ids["isrc"]
+                let trackISRC = track.isrc
                 let userIds = playlist.user_ids_per_shared_tracks[trackISRC]
 
                 return intersection(userIds, playlist.filters).length === playlist.filters.length
@@ -221,13 +221,13 @@ export default function Playlist() {
                 return getArtistsFromTrack(track1).localeCompare(getArtistsFromTrack(track2))
               })
               .map(track => {
-                let trackISRC = track.external_ids["isrc"]
+                let trackISRC = track.isrc
                 let userIds = playlist.user_ids_per_shared_tracks[trackISRC]
                 let users = userIds.map(id => playlist.users[id])
 
                 return (
                   <PlaylistListElem
-                    key={track.id}
+                    key={track.isrc}
                     track={track}
                     songPlaying={playlist.song_playing}
                     usersForTrack={users}
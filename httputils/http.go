@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"github.com/shared-spotify/logger"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"io"
 	"net/http"
 )
 
@@ -21,6 +22,23 @@ func DeserialiseBody(r *http.Request, v interface{}) error {
 	return nil
 }
 
+// Same as DeserialiseBody, but an empty body is accepted and leaves v untouched
+func DeserialiseOptionalBody(r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(v)
+
+	if err == io.EOF {
+		return nil
+	}
+
+	if err != nil {
+		logger.Logger.Error("Failed to deserialise body", err)
+		return err
+	}
+
+	return nil
+}
+
 func SendJson(w http.ResponseWriter, v interface{}) {
 	SendJsonWithCtx(w, v, nil)
 }
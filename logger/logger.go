@@ -23,6 +23,11 @@ func init() {
 	mw := io.MultiWriter(os.Stdout, logFile)
 	logrus.SetOutput(mw)
 
+	// the tests run without the env loaded
+	if level == "" {
+		level = logrus.InfoLevel.String()
+	}
+
 	logLevel, err := logrus.ParseLevel(level)
 
 	if err != nil {
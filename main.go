@@ -2,17 +2,19 @@ package main
 
 import (
 	"context"
+	"flag"
 	"github.com/gorilla/handlers"
 	"github.com/rs/cors"
 	"github.com/shared-spotify/api"
+	"github.com/shared-spotify/app"
 	"github.com/shared-spotify/datadog"
 	"github.com/shared-spotify/env"
 	"github.com/shared-spotify/logger"
 	"github.com/shared-spotify/mongoclient"
+	mongoclientapp "github.com/shared-spotify/mongoclient/app"
 	"github.com/shared-spotify/musicclient"
-	"github.com/shared-spotify/musicclient/applemusic"
 	"github.com/shared-spotify/musicclient/clientcommon"
-	"github.com/shared-spotify/musicclient/spotify"
+	"github.com/shared-spotify/worker"
 	muxtrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/gorilla/mux"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 	"gopkg.in/DataDog/dd-trace-go.v1/profiler"
@@ -26,6 +28,16 @@ import (
 var Port = os.Getenv("PORT")
 var ReleaseVersion = os.Getenv("HEROKU_RELEASE_VERSION")
 
+// The mode decides what this process runs, so api and processing can be scaled independently
+//   web: only the http server, rooms to process are added to the job queue
+//   worker: only the workers processing the rooms from the job queue
+//   all: both of them
+const ModeWeb = "web"
+const ModeWorker = "worker"
+const ModeAll = "all"
+
+var mode = flag.String("mode", getDefaultMode(), "what to run: web, worker or all (env MODE)")
+
 const Service = "shared-spotify-backend"
 
 var srv *http.Server
@@ -33,6 +45,22 @@ var srv *http.Server
 // Allows us to wait for all connection to be closed
 var idleConnsClosed = make(chan struct{})
 
+func getDefaultMode() string {
+	if envMode := os.Getenv("MODE"); envMode != "" {
+		return envMode
+	}
+
+	return ModeAll
+}
+
+func runsWeb() bool {
+	return *mode == ModeWeb || *mode == ModeAll
+}
+
+func runsWorkers() bool {
+	return *mode == ModeWorker || *mode == ModeAll
+}
+
 func startServer() {
 	logger.Logger.Warning("Starting server")
 
@@ -41,18 +69,25 @@ func startServer() {
 
 	r.HandleFunc("/health", api.Health)
 
-	r.HandleFunc("/login", spotify.Authenticate)
 	r.HandleFunc("/logout", musicclient.Logout)
 
-	r.HandleFunc("/callback", spotify.CallbackHandler)
-	r.HandleFunc("/callback/apple", applemusic.CallbackHandler)
-	r.HandleFunc("/callback/apple/user", applemusic.UserHandler)
+	// Add the login routes of all music providers
+	for _, provider := range musicclient.GetProviders() {
+		r.HandleFunc(provider.LoginPath(), provider.Login)
+		r.HandleFunc(provider.CallbackPath(), provider.Callback)
+	}
 
 	r.HandleFunc("/user", musicclient.GetUser)
 
 	r.HandleFunc("/rooms", api.RoomsHandler)
 	r.HandleFunc("/rooms/{roomId:[a-zA-Z0-9]+}", api.RoomHandler)
 	r.HandleFunc("/rooms/{roomId:[a-zA-Z0-9]+}/users", api.RoomUsersHandler)
+	r.HandleFunc("/rooms/{roomId:[a-zA-Z0-9]+}/lock", api.RoomLockHandler)
+	r.HandleFunc("/rooms/{roomId:[a-zA-Z0-9]+}/processing", api.RoomProcessingHandler)
+	r.HandleFunc("/rooms/{roomId:[a-zA-Z0-9]+}/processing/retry", api.RoomProcessingRetryHandler)
+	r.HandleFunc("/rooms/{roomId:[a-zA-Z0-9]+}/events", api.RoomEventsHandler)
+	r.HandleFunc("/rooms/{roomId:[a-zA-Z0-9]+}/compatibility", api.RoomCompatibilityHandler)
+	r.HandleFunc("/rooms/{roomId:[a-zA-Z0-9]+}/library/playlists", api.RoomLibraryPlaylistsHandler)
 	r.HandleFunc("/rooms/{roomId:[a-zA-Z0-9]+}/playlists", api.RoomPlaylistsHandler)
 	r.HandleFunc("/rooms/{roomId:[a-zA-Z0-9]+}/playlists/{playlistId:[a-zA-Z0-9]+}", api.RoomPlaylistHandler)
 	r.HandleFunc("/rooms/{roomId:[a-zA-Z0-9]+}/playlists/{playlistId:[a-zA-Z0-9]+}/add", api.RoomAddPlaylistHandler)
@@ -99,6 +134,10 @@ func RegisterGracefulShutdown() {
 
 		logger.Logger.Warningf("Shutting down gracefully...")
 
+		// give back the jobs being processed to the queue
+		logger.Logger.Warningf("Shutting down workers...")
+		worker.Stop()
+
 		// close all api resources
 		logger.Logger.Warningf("Shutting down api...")
 		api.Shutdown()
@@ -109,9 +148,11 @@ func RegisterGracefulShutdown() {
 		profiler.Stop()
 
 		// Shutdown the server
-		logger.Logger.Warningf("Shutting down server...")
-		if err := srv.Shutdown(context.Background()); err != nil {
-			logger.Logger.Errorf("Got an error when shutting down server: %v", err)
+		if srv != nil {
+			logger.Logger.Warningf("Shutting down server...")
+			if err := srv.Shutdown(context.Background()); err != nil {
+				logger.Logger.Errorf("Got an error when shutting down server: %v", err)
+			}
 		}
 		close(idleConnsClosed)
 
@@ -119,10 +160,36 @@ func RegisterGracefulShutdown() {
 	}()
 }
 
+func startWorkers() {
+	worker.RegisterHandler(api.ProcessRoomJobType, api.ProcessRoom)
+	worker.RegisterDeadHandler(api.ProcessRoomJobType, api.ProcessRoomDead)
+	worker.Start()
+}
+
 func connectToMongo() {
 	mongoclient.Initialise()
 }
 
+func registerTokenRefreshHooks() {
+	// save the refreshed tokens in the rooms, so the rooms can still be processed later on
+	clientcommon.RegisterTokenRefreshHook(func(user *clientcommon.User, oldToken string) {
+		_ = mongoclientapp.UpdateUserTokenInUnprocessedRooms(user, context.Background())
+	})
+}
+
+func registerRoomEventHooks() {
+	err := mongoclientapp.CreateRoomEventIndexes(context.Background())
+
+	if err != nil {
+		logger.Logger.Error("Failed to create room event indexes, old events will not expire ", err)
+	}
+
+	// store the events, so they can be sent to the users by any web process
+	app.RegisterRoomEventHook(func(event *app.RoomEvent) {
+		_ = mongoclientapp.InsertRoomEvent(event, context.Background())
+	})
+}
+
 func startTracing() {
 	// Activate datadog tracer
 	rules := []tracer.SamplingRule{tracer.RateRule(1)}
@@ -163,12 +230,32 @@ func startMetricClient() {
 }
 
 func main() {
+	flag.Parse()
+
+	if !runsWeb() && !runsWorkers() {
+		logger.Logger.Fatalf("Unknown mode %s, it should be one of %s, %s or %s", *mode, ModeWeb, ModeWorker, ModeAll)
+	}
+
+	logger.Logger.Warningf("Starting in mode %s", *mode)
+
 	if env.IsProd() {
 		startTracing()
 		startMetricClient()
 	}
 	connectToMongo()
+	registerTokenRefreshHooks()
+	registerRoomEventHooks()
 
 	RegisterGracefulShutdown()
-	startServer()
+
+	if runsWorkers() {
+		startWorkers()
+	}
+
+	if runsWeb() {
+		startServer()
+	} else {
+		// wait for the workers to be shutdown
+		<-idleConnsClosed
+	}
 }
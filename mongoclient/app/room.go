@@ -9,7 +9,6 @@ import (
 	"github.com/shared-spotify/logger"
 	"github.com/shared-spotify/mongoclient"
 	"github.com/shared-spotify/musicclient/clientcommon"
-	"github.com/zmb3/spotify"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -19,16 +18,20 @@ import (
 const roomCollection = "rooms"
 
 var NotFound = errors.New("Not found")
+var ProcessingCancelled = errors.New("Processing of room was cancelled")
+var TracksNotConverted = errors.New("Tracks of room could not be converted")
 
 type MongoRoom struct {
 	*app.Room `bson:"inline"`
-	Playlists map[string]*MongoPlaylist `bson:"playlists"`
+	Playlists     map[string]*MongoPlaylist `bson:"playlists"`
+	Compatibility *app.CompatibilityMatrix  `bson:"compatibility"`
 }
 
 type MongoPlaylist struct {
 	app.PlaylistMetadata   `bson:"inline"`
 	TrackIdsPerSharedCount map[int][]string              `bson:"track_ids_per_shared_count"`
 	UserIdsPerSharedTracks map[string][]string           `bson:"user_ids_per_shared_tracks"`
+	ScorePerTrack          map[string]float64            `bson:"score_per_track"`
 	Users                  map[string]*clientcommon.User `bson:"users"`
 }
 
@@ -86,9 +89,16 @@ func InsertRoom(room *app.Room, ctx context.Context) error {
 	mongoRoom := MongoRoom{
 		room,
 		mongoPlaylists,
+		room.GetCompatibility(),
 	}
 
-	insertResult, err := mongoclient.GetDatabase().Collection(roomCollection).InsertOne(ctx, mongoRoom)
+	// a room processed again replaces its previous result
+	upsert := true
+	_, err = mongoclient.GetDatabase().Collection(roomCollection).ReplaceOne(
+		ctx,
+		bson.D{{"_id", room.Id}},
+		mongoRoom,
+		&options.ReplaceOptions{Upsert: &upsert})
 
 	if err != nil {
 		span.Finish(tracer.WithError(err))
@@ -96,7 +106,7 @@ func InsertRoom(room *app.Room, ctx context.Context) error {
 		return err
 	}
 
-	logger.Logger.Infof("Room was inserted successfully in mongo %v %v", insertResult.InsertedID, span)
+	logger.Logger.Infof("Room was inserted successfully in mongo %v %v", room.Id, span)
 
 	return nil
 }
@@ -147,6 +157,7 @@ func GetRoom(roomId string, ctx context.Context) (*app.Room, error) {
 	}
 
 	room.SetPlaylists(playlists)
+	room.SetCompatibility(mongoRoom.Compatibility)
 
 	return room, err
 }
@@ -164,7 +175,8 @@ func GetRoomsForUser(user *clientcommon.User, ctx context.Context) ([]*app.Room,
 		user.GetId(),
 	}}
 
-	projection := bson.M{"playlists": 0}  // exclude the playlist fields, which are huge and unnecessary
+	// exclude the playlist and compatibility fields, which are huge and unnecessary
+	projection := bson.M{"playlists": 0, "compatibility": 0}
 
 	otherSpan, ctx := tracer.StartSpanFromContext(rootCtx, "mongo.cursor.find")
 	cursor, err := mongoclient.GetDatabase().Collection(roomCollection).Find(ctx, filter,
@@ -243,6 +255,7 @@ func convertPlaylistsToMongoPlaylists(playlists map[string]*app.Playlist, room *
 			playlist.PlaylistMetadata,
 			trackIdsPerSharedCount,
 			playlist.UserIdsPerSharedTracks,
+			playlist.ScorePerTrack,
 			playlist.Users,
 		}
 
@@ -271,19 +284,30 @@ func convertMongoPlaylistsToPlaylists(mongoPlaylists map[string]*MongoPlaylist)
 
 	trackPerId, err := mongoclient.GetTracks(allTrackIds)
 
+	if err == mongoclient.ErrorLegacyTrackNotConverted {
+		return nil, TracksNotConverted
+	}
+
 	if err != nil {
 		logger.Logger.Error("Failed to get tracks when converting mongo playlist to playlists ", err)
 		return nil, err
 	}
 
 	for playlistId, mongoPlaylist := range mongoPlaylists {
-		tracksPerSharedCount := make(map[int][]*spotify.FullTrack)
+		tracksPerSharedCount := make(map[int][]*clientcommon.Track)
 
 		for sharedCount, trackIds := range mongoPlaylist.TrackIdsPerSharedCount {
 
-			tracks := make([]*spotify.FullTrack, 0)
+			tracks := make([]*clientcommon.Track, 0)
 			for _, trackId := range trackIds {
-				track := trackPerId[trackId]
+				track, ok := trackPerId[trackId]
+
+				// the playlist would be shown with blank tracks
+				if !ok {
+					logger.Logger.Errorf("Track %s of playlist %s was not found in mongo", trackId, playlistId)
+					return nil, TracksNotConverted
+				}
+
 				tracks = append(tracks, track)
 			}
 
@@ -294,6 +318,7 @@ func convertMongoPlaylistsToPlaylists(mongoPlaylists map[string]*MongoPlaylist)
 			PlaylistMetadata:       mongoPlaylist.PlaylistMetadata,
 			TracksPerSharedCount:   tracksPerSharedCount,
 			UserIdsPerSharedTracks: mongoPlaylist.UserIdsPerSharedTracks,
+			ScorePerTrack:          mongoPlaylist.ScorePerTrack,
 			Users:                  mongoPlaylist.Users,
 		}
 	}
@@ -301,7 +326,7 @@ func convertMongoPlaylistsToPlaylists(mongoPlaylists map[string]*MongoPlaylist)
 	return playlists, nil
 }
 
-func getTrackIds(tracks []*spotify.FullTrack) []string {
+func getTrackIds(tracks []*clientcommon.Track) []string {
 	trackIds := make([]string, 0)
 
 	for _, track := range tracks {
@@ -312,8 +337,8 @@ func getTrackIds(tracks []*spotify.FullTrack) []string {
 	return trackIds
 }
 
-func getAllTracksForPlaylists(playlists map[string]*app.Playlist) []*spotify.FullTrack {
-	allTracks := make([]*spotify.FullTrack, 0)
+func getAllTracksForPlaylists(playlists map[string]*app.Playlist) []*clientcommon.Track {
+	allTracks := make([]*clientcommon.Track, 0)
 
 	for _, playlist := range playlists {
 		tracks := playlist.GetAllTracks()
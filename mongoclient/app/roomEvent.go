@@ -0,0 +1,150 @@
+package app
+
+import (
+	"context"
+	"github.com/shared-spotify/app"
+	"github.com/shared-spotify/logger"
+	"github.com/shared-spotify/mongoclient"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// Room events are stored so the process sending them to the users does not need to be the one processing the room
+// Each event gets a sequence number per room, so users can continue from the last event they received
+// The sequence is allocated in the same transaction as the event is inserted, so the events of a room are committed
+// in the order of their sequence and a reader never skips an event committed late
+// Events are only useful while a room is processed, so they expire after a day
+
+const roomEventCollection = "room_events"
+const roomEventSequenceCollection = "room_event_sequences"
+
+const maxRoomEventsPerRead = 500
+const roomEventExpiry = 24 * time.Hour
+
+type roomEventSequence struct {
+	RoomId    string    `bson:"_id"`
+	Sequence  int64     `bson:"sequence"`
+	UpdatedAt time.Time `bson:"updated_at"`
+}
+
+// Creates the indexes to read the events of a room in order, and to expire the old events
+func CreateRoomEventIndexes(ctx context.Context) error {
+	expireAfter := int32(roomEventExpiry.Seconds())
+
+	_, err := mongoclient.GetDatabase().Collection(roomEventCollection).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{"room_id", 1}, {"sequence", 1}}},
+		{Keys: bson.D{{"created_at", 1}}, Options: options.Index().SetExpireAfterSeconds(expireAfter)},
+	})
+
+	if err != nil {
+		logger.Logger.Errorf("Failed to create room event indexes %v", err)
+		return err
+	}
+
+	_, err = mongoclient.GetDatabase().Collection(roomEventSequenceCollection).Indexes().CreateOne(ctx,
+		mongo.IndexModel{
+			Keys:    bson.D{{"updated_at", 1}},
+			Options: options.Index().SetExpireAfterSeconds(expireAfter),
+		})
+
+	if err != nil {
+		logger.Logger.Errorf("Failed to create room event sequence indexes %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func InsertRoomEvent(event *app.RoomEvent, ctx context.Context) error {
+	mongoSession, err := mongoclient.MongoClient.StartSession()
+
+	if err != nil {
+		logger.WithRoom(event.RoomId).Errorf("Failed to start mongo session to insert room event %s %v", event.Type,
+			err)
+		return err
+	}
+
+	defer mongoSession.EndSession(ctx)
+
+	// concurrent writers conflict on the sequence of the room, the transaction is retried until it is their turn
+	_, err = mongoSession.WithTransaction(ctx, func(sessionContext mongo.SessionContext) (interface{}, error) {
+		return nil, insertRoomEventWithSequence(event, sessionContext)
+	})
+
+	if err != nil {
+		logger.WithRoom(event.RoomId).Errorf("Failed to insert room event %s %v", event.Type, err)
+		return err
+	}
+
+	return nil
+}
+
+func insertRoomEventWithSequence(event *app.RoomEvent, ctx context.Context) error {
+	upsert := true
+	after := options.After
+
+	var sequence roomEventSequence
+
+	err := mongoclient.GetDatabase().Collection(roomEventSequenceCollection).FindOneAndUpdate(
+		ctx,
+		bson.D{{"_id", event.RoomId}},
+		bson.D{{"$inc", bson.D{{"sequence", 1}}}, {"$set", bson.D{{"updated_at", time.Now()}}}},
+		&options.FindOneAndUpdateOptions{Upsert: &upsert, ReturnDocument: &after}).Decode(&sequence)
+
+	if err != nil {
+		return err
+	}
+
+	event.Sequence = sequence.Sequence
+
+	_, err = mongoclient.GetDatabase().Collection(roomEventCollection).InsertOne(ctx, event)
+
+	return err
+}
+
+// Returns the sequence of the last event of the room, 0 if the room has no events
+func GetRoomEventSequence(roomId string, ctx context.Context) (int64, error) {
+	var sequence roomEventSequence
+
+	err := mongoclient.GetDatabase().Collection(roomEventSequenceCollection).FindOne(
+		ctx,
+		bson.D{{"_id", roomId}}).Decode(&sequence)
+
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+
+	if err != nil {
+		logger.WithRoom(roomId).Errorf("Failed to get room event sequence %v", err)
+		return 0, err
+	}
+
+	return sequence.Sequence, nil
+}
+
+// Returns the events of the room that happened after the sequence given, in order
+func GetRoomEventsAfter(roomId string, sequence int64, ctx context.Context) ([]*app.RoomEvent, error) {
+	events := make([]*app.RoomEvent, 0)
+	limit := int64(maxRoomEventsPerRead)
+
+	cursor, err := mongoclient.GetDatabase().Collection(roomEventCollection).Find(
+		ctx,
+		bson.D{{"room_id", roomId}, {"sequence", bson.D{{"$gt", sequence}}}},
+		&options.FindOptions{Sort: bson.D{{"sequence", 1}}, Limit: &limit})
+
+	if err != nil {
+		logger.WithRoom(roomId).Errorf("Failed to find room events %v", err)
+		return nil, err
+	}
+
+	err = cursor.All(ctx, &events)
+
+	if err != nil {
+		logger.WithRoom(roomId).Errorf("Failed to decode room events %v", err)
+		return nil, err
+	}
+
+	return events, nil
+}
@@ -47,6 +47,36 @@ func UpdateUnprocessedRoom(room *app.Room, ctx context.Context) error {
 	return nil
 }
 
+// Updates the room only if its processing was not cancelled, so a processing that is being stopped cannot overwrite
+// the room unlocked by the owner
+func UpdateUnprocessedRoomIfNotCancelled(room *app.Room, ctx context.Context) error {
+	span, ctx := tracer.StartSpanFromContext(ctx, "mongo.room.unprocessed.update.not.cancelled")
+	defer span.Finish()
+
+	mongoRoom := MongoUnprocessedRoom{Room: room}
+
+	updateResult, err := mongoclient.GetDatabase().Collection(unprocessedRoomCollection).ReplaceOne(
+		ctx,
+		bson.D{
+			{"_id", mongoRoom.Room.Id},
+			{"shared_music_library.processing_status.cancelled", bson.D{{"$ne", true}}},
+		},
+		mongoRoom)
+
+	if err != nil {
+		logger.Logger.Errorf("Failed to update unprocessed room in mongo %v %v", err, span)
+		span.Finish(tracer.WithError(err))
+		return err
+	}
+
+	if updateResult.MatchedCount == 0 {
+		logger.Logger.Warningf("Unprocessed room was not updated as its processing was cancelled %v", span)
+		return ProcessingCancelled
+	}
+
+	return nil
+}
+
 func GetUnprocessedRoom(roomId string, ctx context.Context) (*app.Room, error) {
 	var mongoRoom MongoUnprocessedRoom
 
@@ -130,4 +160,43 @@ func GetUnprocessedRoomsForUser(user *clientcommon.User, ctx context.Context) ([
 	}
 
 	return rooms, nil
-}
\ No newline at end of file
+}
+
+// Replace the token of the user in all the rooms he is part of, so they can still be processed with it
+func UpdateUserTokenInUnprocessedRooms(user *clientcommon.User, ctx context.Context) error {
+	span, ctx := tracer.StartSpanFromContext(ctx, "mongo.rooms.unprocessed.update.user.token")
+	span.SetTag("user", user.GetUserId())
+	defer span.Finish()
+
+	collection := mongoclient.GetDatabase().Collection(unprocessedRoomCollection)
+
+	usersResult, err := collection.UpdateMany(
+		ctx,
+		bson.D{{"users._id", user.GetId()}},
+		bson.D{{"$set", bson.D{{"users.$[user].token", user.GetToken()}}}},
+		options.Update().SetArrayFilters(options.ArrayFilters{
+			Filters: []interface{}{bson.D{{"user._id", user.GetId()}}},
+		}))
+
+	if err != nil {
+		span.Finish(tracer.WithError(err))
+		logger.WithUser(user.GetUserId()).Errorf("Failed to update user token in unprocessed rooms %v %v", err, span)
+		return err
+	}
+
+	ownerResult, err := collection.UpdateMany(
+		ctx,
+		bson.D{{"owner._id", user.GetId()}},
+		bson.D{{"$set", bson.D{{"owner.token", user.GetToken()}}}})
+
+	if err != nil {
+		span.Finish(tracer.WithError(err))
+		logger.WithUser(user.GetUserId()).Errorf("Failed to update owner token in unprocessed rooms %v %v", err, span)
+		return err
+	}
+
+	logger.WithUser(user.GetUserId()).Infof("Updated token of user in %d unprocessed rooms and %d as owner %v",
+		usersResult.ModifiedCount, ownerResult.ModifiedCount, span)
+
+	return nil
+}
@@ -21,6 +21,22 @@ func IsOnlyDuplicateError(err error) bool {
 	return true
 }
 
+func IsDuplicateError(err error) bool {
+	writeException, ok := err.(mongo.WriteException)
+
+	if !ok {
+		return IsOnlyDuplicateError(err)
+	}
+
+	for _, writeErr := range writeException.WriteErrors {
+		if isDup(writeErr) {
+			return true
+		}
+	}
+
+	return false
+}
+
 func isDup(err mongo.WriteError) bool {
 	return err.Code == 11000 ||
 		err.Code == 11001 ||
@@ -0,0 +1,410 @@
+package mongoclient
+
+import (
+	"context"
+	"errors"
+	"github.com/shared-spotify/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"math"
+	"time"
+)
+
+// Persistent job queue, so work such as processing a room survives restarts of the app
+//
+// A job is acquired by a worker with a lease that the worker extends with heartbeats while it runs the job. If the
+// worker dies, the lease expires and another worker picks the job up again. Failed jobs are retried with an
+// exponential backoff until they reach their max attempts, after which they are marked as dead. A job whose lease
+// expires on its last attempt, for example because it crashed its worker, is also marked as dead by the workers.
+
+const jobCollection = "jobs"
+
+const JobStatusPending = "pending"
+const JobStatusRunning = "running"
+const JobStatusSucceeded = "succeeded"
+const JobStatusDead = "dead"
+const JobStatusCancelled = "cancelled"
+
+const DefaultJobMaxAttempts = 3
+const jobBackoffBase = 30 * time.Second
+const jobBackoffMax = 10 * time.Minute
+const jobLeaseExpiredError = "Lease of the job expired on its last attempt"
+
+var ErrJobAlreadyQueued = errors.New("Job is already queued")
+var ErrJobLeaseLost = errors.New("Job lease was lost")
+
+type Job struct {
+	Id              string    `bson:"_id"`
+	Type            string    `bson:"type"`
+	Payload         string    `bson:"payload"`
+	Status          string    `bson:"status"`
+	Attempts        int       `bson:"attempts"`
+	MaxAttempts     int       `bson:"max_attempts"`
+	RunAt           time.Time `bson:"run_at"`
+	LeaseOwner      string    `bson:"lease_owner"`
+	LeaseExpiresAt  time.Time `bson:"lease_expires_at"`
+	HeartbeatAt     time.Time `bson:"heartbeat_at"`
+	LastError       string    `bson:"last_error"`
+	CancelRequested bool      `bson:"cancel_requested"`
+	CreatedAt       time.Time `bson:"created_at"`
+	UpdatedAt       time.Time `bson:"updated_at"`
+}
+
+func GetJobId(jobType string, payload string) string {
+	return jobType + ":" + payload
+}
+
+// Returns true if the job is waiting to run or running, so it cannot be queued again
+func (job *Job) IsQueued() bool {
+	return job.Status == JobStatusPending || job.Status == JobStatusRunning
+}
+
+func (job *Job) IsLastAttempt() bool {
+	return job.Attempts >= job.MaxAttempts
+}
+
+// Adds a job to the queue, a job for the same type and payload can only be queued once at a time
+func EnqueueJob(jobType string, payload string, ctx context.Context) error {
+	span, ctx := tracer.StartSpanFromContext(ctx, "mongo.job.enqueue")
+	defer span.Finish()
+
+	jobId := GetJobId(jobType, payload)
+	now := time.Now()
+	upsert := true
+
+	// the filter does not match if the job is already pending or running, so the upsert fails on the duplicate id
+	_, err := GetDatabase().Collection(jobCollection).UpdateOne(
+		ctx,
+		bson.D{
+			{"_id", jobId},
+			{"status", bson.D{{"$nin", []string{JobStatusPending, JobStatusRunning}}}},
+		},
+		bson.D{
+			{"$set", bson.D{
+				{"type", jobType},
+				{"payload", payload},
+				{"status", JobStatusPending},
+				{"attempts", 0},
+				{"max_attempts", DefaultJobMaxAttempts},
+				{"run_at", now},
+				{"lease_owner", ""},
+				{"last_error", ""},
+				{"cancel_requested", false},
+				{"updated_at", now},
+			}},
+			{"$setOnInsert", bson.D{{"created_at", now}}},
+		},
+		&options.UpdateOptions{Upsert: &upsert})
+
+	if IsDuplicateError(err) {
+		logger.Logger.Warningf("Job %s is already queued %v", jobId, span)
+		return ErrJobAlreadyQueued
+	}
+
+	if err != nil {
+		span.Finish(tracer.WithError(err))
+		logger.Logger.Errorf("Failed to enqueue job %s %v %v", jobId, err, span)
+		return err
+	}
+
+	logger.Logger.Infof("Job %s was enqueued successfully %v", jobId, span)
+
+	return nil
+}
+
+// Acquires the next job ready to run, or a running job whose worker stopped sending heartbeats
+// Returns nil if no job is available
+func AcquireJob(jobType string, owner string, leaseDuration time.Duration, ctx context.Context) (*Job, error) {
+	now := time.Now()
+	after := options.After
+
+	var job Job
+
+	err := GetDatabase().Collection(jobCollection).FindOneAndUpdate(
+		ctx,
+		getAcquirableJobFilter(jobType, now),
+		bson.D{
+			{"$set", bson.D{
+				{"status", JobStatusRunning},
+				{"lease_owner", owner},
+				{"lease_expires_at", now.Add(leaseDuration)},
+				{"heartbeat_at", now},
+				{"updated_at", now},
+			}},
+			{"$inc", bson.D{{"attempts", 1}}},
+		},
+		&options.FindOneAndUpdateOptions{
+			ReturnDocument: &after,
+			Sort:           bson.D{{"run_at", 1}},
+		}).Decode(&job)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+
+	if err != nil {
+		logger.Logger.Error("Failed to acquire job ", err)
+		return nil, err
+	}
+
+	logger.Logger.Infof("Job %s acquired by %s - attempt %d/%d", job.Id, owner, job.Attempts, job.MaxAttempts)
+
+	return &job, nil
+}
+
+// Marks as dead a running job whose lease expired on its last attempt, as its worker stopped before failing it
+// Returns nil if there is no such job
+func BuryExpiredJob(jobType string, ctx context.Context) (*Job, error) {
+	now := time.Now()
+	after := options.After
+
+	var job Job
+
+	err := GetDatabase().Collection(jobCollection).FindOneAndUpdate(
+		ctx,
+		getExpiredJobFilter(jobType, now),
+		bson.D{{"$set", bson.D{
+			{"status", JobStatusDead},
+			{"lease_owner", ""},
+			{"last_error", jobLeaseExpiredError},
+			{"updated_at", now},
+		}}},
+		&options.FindOneAndUpdateOptions{ReturnDocument: &after}).Decode(&job)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+
+	if err != nil {
+		logger.Logger.Error("Failed to bury expired job ", err)
+		return nil, err
+	}
+
+	logger.Logger.Warningf("Job %s is dead, its lease expired at attempt %d/%d", job.Id, job.Attempts,
+		job.MaxAttempts)
+
+	return &job, nil
+}
+
+// Extends the lease of the job, fails with ErrJobLeaseLost if another worker took the job
+// Also returns whether the job was asked to be cancelled, as the job might be running in another process
+func HeartbeatJob(job *Job, leaseDuration time.Duration, ctx context.Context) (bool, error) {
+	now := time.Now()
+	after := options.After
+
+	var updatedJob Job
+
+	err := GetDatabase().Collection(jobCollection).FindOneAndUpdate(
+		ctx,
+		bson.D{{"_id", job.Id}, {"lease_owner", job.LeaseOwner}, {"status", JobStatusRunning}},
+		bson.D{{"$set", bson.D{
+			{"lease_expires_at", now.Add(leaseDuration)},
+			{"heartbeat_at", now},
+			{"updated_at", now},
+		}}},
+		&options.FindOneAndUpdateOptions{ReturnDocument: &after}).Decode(&updatedJob)
+
+	if err == mongo.ErrNoDocuments {
+		logger.Logger.Warningf("Lease of job %s by %s was lost", job.Id, job.LeaseOwner)
+		return false, ErrJobLeaseLost
+	}
+
+	if err != nil {
+		logger.Logger.Errorf("Failed to send heartbeat for job %s %v", job.Id, err)
+		return false, err
+	}
+
+	return updatedJob.CancelRequested, nil
+}
+
+// Cancels a job, a pending job is cancelled straight away, a running job is cancelled by its worker on its next
+// heartbeat
+func RequestJobCancel(jobType string, payload string, ctx context.Context) error {
+	jobId := GetJobId(jobType, payload)
+	now := time.Now()
+
+	_, err := GetDatabase().Collection(jobCollection).UpdateOne(
+		ctx,
+		bson.D{{"_id", jobId}, {"status", JobStatusPending}},
+		bson.D{{"$set", bson.D{{"status", JobStatusCancelled}, {"updated_at", now}}}})
+
+	if err != nil {
+		logger.Logger.Errorf("Failed to cancel pending job %s %v", jobId, err)
+		return err
+	}
+
+	_, err = GetDatabase().Collection(jobCollection).UpdateOne(
+		ctx,
+		bson.D{{"_id", jobId}, {"status", JobStatusRunning}},
+		bson.D{{"$set", bson.D{{"cancel_requested", true}, {"updated_at", now}}}})
+
+	if err != nil {
+		logger.Logger.Errorf("Failed to request cancel of running job %s %v", jobId, err)
+		return err
+	}
+
+	logger.Logger.Infof("Cancel of job %s requested", jobId)
+
+	return nil
+}
+
+func CancelJob(job *Job, ctx context.Context) error {
+	err := updateLeasedJob(job, bson.D{
+		{"status", JobStatusCancelled},
+		{"lease_owner", ""},
+		{"updated_at", time.Now()},
+	}, ctx)
+
+	if err == nil {
+		logger.Logger.Infof("Job %s cancelled", job.Id)
+	}
+
+	return err
+}
+
+func CompleteJob(job *Job, ctx context.Context) error {
+	err := updateLeasedJob(job, bson.D{
+		{"status", JobStatusSucceeded},
+		{"lease_owner", ""},
+		{"updated_at", time.Now()},
+	}, ctx)
+
+	if err == nil {
+		logger.Logger.Infof("Job %s succeeded", job.Id)
+	}
+
+	return err
+}
+
+// Schedules the job again with an exponential backoff, or marks it as dead if it has no attempts left
+func FailJob(job *Job, jobErr error, ctx context.Context) error {
+	now := time.Now()
+	status, runAt := getFailedJobSchedule(job, now)
+
+	err := updateLeasedJob(job, bson.D{
+		{"status", status},
+		{"run_at", runAt},
+		{"lease_owner", ""},
+		{"last_error", jobErr.Error()},
+		{"updated_at", now},
+	}, ctx)
+
+	if err == nil {
+		logger.Logger.Warningf("Job %s failed at attempt %d/%d, status is now %s %v",
+			job.Id, job.Attempts, job.MaxAttempts, status, jobErr)
+	}
+
+	return err
+}
+
+// Puts the job back in the queue without counting the attempt, used when a worker is shutting down
+func ReleaseJob(job *Job, ctx context.Context) error {
+	now := time.Now()
+
+	_, err := GetDatabase().Collection(jobCollection).UpdateOne(
+		ctx,
+		bson.D{{"_id", job.Id}, {"lease_owner", job.LeaseOwner}, {"status", JobStatusRunning}},
+		bson.D{
+			{"$set", bson.D{
+				{"status", JobStatusPending},
+				{"run_at", now},
+				{"lease_owner", ""},
+				{"updated_at", now},
+			}},
+			{"$inc", bson.D{{"attempts", -1}}},
+		})
+
+	if err != nil {
+		logger.Logger.Errorf("Failed to release job %s %v", job.Id, err)
+		return err
+	}
+
+	logger.Logger.Infof("Job %s released", job.Id)
+
+	return nil
+}
+
+func GetJob(jobType string, payload string, ctx context.Context) (*Job, error) {
+	var job Job
+
+	err := GetDatabase().Collection(jobCollection).FindOne(
+		ctx,
+		bson.D{{"_id", GetJobId(jobType, payload)}}).Decode(&job)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+
+	if err != nil {
+		logger.Logger.Error("Failed to get job ", err)
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+func updateLeasedJob(job *Job, set bson.D, ctx context.Context) error {
+	result, err := GetDatabase().Collection(jobCollection).UpdateOne(
+		ctx,
+		bson.D{{"_id", job.Id}, {"lease_owner", job.LeaseOwner}, {"status", JobStatusRunning}},
+		bson.D{{"$set", set}})
+
+	if err != nil {
+		logger.Logger.Errorf("Failed to update job %s %v", job.Id, err)
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		logger.Logger.Warningf("Lease of job %s by %s was lost", job.Id, job.LeaseOwner)
+		return ErrJobLeaseLost
+	}
+
+	return nil
+}
+
+// The pending jobs ready to run, and the running jobs whose lease expired with attempts left
+func getAcquirableJobFilter(jobType string, now time.Time) bson.D {
+	return bson.D{
+		{"type", jobType},
+		{"$or", bson.A{
+			bson.D{{"status", JobStatusPending}, {"run_at", bson.D{{"$lte", now}}}},
+			bson.D{
+				{"status", JobStatusRunning},
+				{"lease_expires_at", bson.D{{"$lt", now}}},
+				// a job that kills its worker would be retried forever otherwise
+				{"$expr", bson.D{{"$lt", bson.A{"$attempts", "$max_attempts"}}}},
+			},
+		}},
+	}
+}
+
+// The running jobs whose lease expired on their last attempt, the ones the acquire filter leaves out
+func getExpiredJobFilter(jobType string, now time.Time) bson.D {
+	return bson.D{
+		{"type", jobType},
+		{"status", JobStatusRunning},
+		{"lease_expires_at", bson.D{{"$lt", now}}},
+		{"$expr", bson.D{{"$gte", bson.A{"$attempts", "$max_attempts"}}}},
+	}
+}
+
+// Returns the status of the failed job and when it runs again
+func getFailedJobSchedule(job *Job, now time.Time) (string, time.Time) {
+	if job.IsLastAttempt() {
+		return JobStatusDead, now
+	}
+
+	return JobStatusPending, now.Add(getJobBackoff(job.Attempts))
+}
+
+func getJobBackoff(attempts int) time.Duration {
+	backoff := time.Duration(float64(jobBackoffBase) * math.Pow(2, float64(attempts-1)))
+
+	if backoff > jobBackoffMax {
+		return jobBackoffMax
+	}
+
+	return backoff
+}
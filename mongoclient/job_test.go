@@ -0,0 +1,129 @@
+package mongoclient
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestGetJobBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{1, jobBackoffBase},
+		{2, 2 * jobBackoffBase},
+		{3, 4 * jobBackoffBase},
+		{5, 16 * jobBackoffBase},
+		// the backoff stops growing at the max
+		{6, jobBackoffMax},
+		{20, jobBackoffMax},
+	}
+
+	for _, test := range tests {
+		t.Run(strconv.Itoa(test.attempts), func(t *testing.T) {
+			if backoff := getJobBackoff(test.attempts); backoff != test.expected {
+				t.Errorf("Expected %s at attempt %d, got %s", test.expected, test.attempts, backoff)
+			}
+		})
+	}
+}
+
+func TestGetFailedJobSchedule(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name           string
+		attempts       int
+		expectedStatus string
+		expectedRunAt  time.Time
+	}{
+		{"first attempt", 1, JobStatusPending, now.Add(jobBackoffBase)},
+		{"second attempt", 2, JobStatusPending, now.Add(2 * jobBackoffBase)},
+		{"last attempt", DefaultJobMaxAttempts, JobStatusDead, now},
+		{"attempts above the max", DefaultJobMaxAttempts + 1, JobStatusDead, now},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			job := &Job{Attempts: test.attempts, MaxAttempts: DefaultJobMaxAttempts}
+
+			status, runAt := getFailedJobSchedule(job, now)
+
+			if status != test.expectedStatus || !runAt.Equal(test.expectedRunAt) {
+				t.Errorf("Expected %s at %s, got %s at %s", test.expectedStatus, test.expectedRunAt, status, runAt)
+			}
+		})
+	}
+}
+
+func TestJobIsQueued(t *testing.T) {
+	tests := []struct {
+		status   string
+		expected bool
+	}{
+		{JobStatusPending, true},
+		{JobStatusRunning, true},
+		{JobStatusSucceeded, false},
+		{JobStatusDead, false},
+		{JobStatusCancelled, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.status, func(t *testing.T) {
+			if isQueued := (&Job{Status: test.status}).IsQueued(); isQueued != test.expected {
+				t.Errorf("Expected is queued to be %t, got %t", test.expected, isQueued)
+			}
+		})
+	}
+}
+
+func TestExpiredJobLeases(t *testing.T) {
+	now := time.Now()
+
+	acquirableFilter := getAcquirableJobFilter("job", now)
+	expiredFilter := getExpiredJobFilter("job", now)
+
+	// the running job of the acquire filter is the second branch of its or
+	branches := getJobFilterValue(t, acquirableFilter, "$or").(bson.A)
+
+	if len(branches) != 2 {
+		t.Fatalf("Expected a pending and a running branch, got %v", branches)
+	}
+
+	expiredLease := branches[1].(bson.D)
+
+	for _, filter := range []bson.D{expiredLease, expiredFilter} {
+		if status := getJobFilterValue(t, filter, "status"); status != JobStatusRunning {
+			t.Errorf("Expected a running job, got %v", status)
+		}
+
+		leaseExpiresAt := getJobFilterValue(t, filter, "lease_expires_at").(bson.D)
+
+		if leaseExpiresAt[0].Key != "$lt" || leaseExpiresAt[0].Value != now {
+			t.Errorf("Expected a lease expired before now, got %v", leaseExpiresAt)
+		}
+	}
+
+	// a job with attempts left is acquired again, the others are dead, so a job is never in both
+	acquirableAttempts := getJobFilterValue(t, expiredLease, "$expr").(bson.D)
+	expiredAttempts := getJobFilterValue(t, expiredFilter, "$expr").(bson.D)
+
+	if acquirableAttempts[0].Key != "$lt" || expiredAttempts[0].Key != "$gte" {
+		t.Errorf("Expected attempts below the max to be acquired and the others to be dead, got %v and %v",
+			acquirableAttempts, expiredAttempts)
+	}
+}
+
+func getJobFilterValue(t *testing.T, filter bson.D, key string) interface{} {
+	for _, element := range filter {
+		if element.Key == key {
+			return element.Value
+		}
+	}
+
+	t.Fatalf("Expected %s in filter %v", key, filter)
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package mongoclient
+
+import (
+	"errors"
+	"github.com/shared-spotify/musicclient/clientcommon"
+	"github.com/zmb3/spotify"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// The tracks were first stored as the spotify tracks themselves, with most of their fields under "simpletrack". They
+// are decoded the way they were written and converted to our own tracks when they are read
+
+var ErrorLegacyTrackNotConverted = errors.New("A track stored in the spotify format could not be converted")
+
+const legacyTrackField = "simpletrack"
+
+type legacyMongoTrack struct {
+	TrackId            string `bson:"_id"`
+	*spotify.FullTrack `bson:"inline"`
+}
+
+func isLegacyTrack(document bson.Raw) bool {
+	_, err := document.LookupErr(legacyTrackField)
+	return err == nil
+}
+
+func decodeLegacyTrack(document bson.Raw) (*clientcommon.Track, error) {
+	var legacyTrack legacyMongoTrack
+	err := bson.Unmarshal(document, &legacyTrack)
+
+	if err != nil {
+		return nil, err
+	}
+
+	track := legacyTrack.FullTrack
+
+	// a track without these would be shown blank and could not be exported
+	if track == nil || track.Name == "" || len(track.Artists) == 0 || track.Duration == 0 || track.ID == "" {
+		return nil, ErrorLegacyTrackNotConverted
+	}
+
+	artists := make([]*clientcommon.Artist, 0)
+
+	for _, artist := range track.Artists {
+		artists = append(artists, &clientcommon.Artist{
+			Name:        artist.Name,
+			ProviderIds: clientcommon.ProviderIds{clientcommon.SpotifyLoginType: artist.ID.String()},
+		})
+	}
+
+	images := make([]clientcommon.Image, 0)
+
+	for _, image := range track.Album.Images {
+		images = append(images, clientcommon.Image{Url: image.URL, Height: image.Height, Width: image.Width})
+	}
+
+	convertedTrack := &clientcommon.Track{
+		// the id is always the isrc of the track
+		Isrc:    legacyTrack.TrackId,
+		Name:    track.Name,
+		Artists: artists,
+		Album: &clientcommon.Album{
+			Name:                 track.Album.Name,
+			Images:               images,
+			ReleaseDate:          track.Album.ReleaseDate,
+			ReleaseDatePrecision: track.Album.ReleaseDatePrecision,
+			ProviderIds:          clientcommon.ProviderIds{clientcommon.SpotifyLoginType: track.Album.ID.String()},
+		},
+		Duration:    track.Duration,
+		Popularity:  track.Popularity,
+		Explicit:    track.Explicit,
+		PreviewUrl:  track.PreviewURL,
+		ProviderIds: clientcommon.ProviderIds{clientcommon.SpotifyLoginType: track.ID.String()},
+	}
+
+	if track.LinkedFrom != nil && track.LinkedFrom.ID != "" {
+		convertedTrack.LinkedFrom = clientcommon.ProviderIds{clientcommon.SpotifyLoginType: track.LinkedFrom.ID.String()}
+	}
+
+	return convertedTrack, nil
+}
@@ -0,0 +1,237 @@
+package mongoclient
+
+import (
+	"context"
+	"errors"
+	"github.com/shared-spotify/logger"
+	"github.com/shared-spotify/musicclient/clientcommon"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"os"
+	"time"
+)
+
+// The library of a user is stored once fetched, as the ids of its tracks, so it can be used again without fetching
+// it from the music provider of the user. The tracks themselves are stored in the tracks collection
+// A snapshot younger than the max age is considered fresh, and is used by any room including the same sources and
+// playlists of the library instead of fetching it
+// Each room also keeps the snapshot of the library as it was fetched for it, so the users reused when the room is
+// processed again keep the library they had in the room, whatever was fetched for them in other rooms since
+
+const librarySnapshotCollection = "library_snapshots"
+const defaultLibrarySnapshotMaxAge = 1 * time.Hour
+
+var LibrarySnapshotMaxAge = getLibrarySnapshotMaxAge()
+
+var ErrLibrarySnapshotNotFound = errors.New("Library snapshot not found")
+
+type LibrarySnapshot struct {
+	Id                string                          `bson:"_id"`
+	UserId            string                          `bson:"user_id"`
+	RoomId            string                          `bson:"room_id"` // empty for the latest snapshot of the user
+	TrackIds          []string                        `bson:"track_ids"`
+	TrackSources      []string                        `bson:"track_sources"`   // the library source of each track id
+	TrackAddedAts     []time.Time                     `bson:"track_added_ats"` // when each track id was added
+	Sources           clientcommon.LibrarySources     `bson:"sources"`         // empty for the default sources
+	PlaylistSelection *clientcommon.PlaylistSelection `bson:"playlist_selection"`
+	FetchedAt         time.Time                       `bson:"fetched_at"`
+}
+
+func getLibrarySnapshotMaxAge() time.Duration {
+	maxAge, err := time.ParseDuration(os.Getenv("LIBRARY_SNAPSHOT_MAX_AGE"))
+
+	// a max age of 0 means snapshots are never reused
+	if err != nil || maxAge < 0 {
+		return defaultLibrarySnapshotMaxAge
+	}
+
+	return maxAge
+}
+
+func (snapshot *LibrarySnapshot) IsFresh() bool {
+	return time.Now().Sub(snapshot.FetchedAt) < LibrarySnapshotMaxAge
+}
+
+func (snapshot *LibrarySnapshot) HasOptions(options *clientcommon.LibraryOptions) bool {
+	snapshotOptions := clientcommon.CreateLibraryOptions(snapshot.Sources, snapshot.PlaylistSelection)
+	return snapshotOptions.Equals(options)
+}
+
+func getRoomLibrarySnapshotId(userId string, roomId string) string {
+	return userId + ":" + roomId
+}
+
+// Saves the snapshot as the latest one of the user, and as the one of the room
+func SaveLibrarySnapshot(user *clientcommon.User, roomId string, libraryOptions *clientcommon.LibraryOptions,
+	tracks []*clientcommon.Track, ctx context.Context) error {
+	span, ctx := tracer.StartSpanFromContext(ctx, "mongo.library_snapshot.save")
+	defer span.Finish()
+	span.SetTag("user", user.GetUserId())
+
+	// tracks without isrc cannot be found back, they would not be shared with other users anyway
+	tracksWithIsrc := make([]*clientcommon.Track, 0)
+	trackIds := make([]string, 0)
+	trackSources := make([]string, 0)
+	trackAddedAts := make([]time.Time, 0)
+
+	for _, track := range tracks {
+		isrc, ok := clientcommon.GetTrackISRC(track)
+
+		if ok {
+			tracksWithIsrc = append(tracksWithIsrc, track)
+			trackIds = append(trackIds, isrc)
+			trackSources = append(trackSources, track.LibrarySource)
+			trackAddedAts = append(trackAddedAts, track.AddedAt)
+		}
+	}
+
+	err := InsertTracksInBatches(tracksWithIsrc, ctx)
+
+	if err != nil {
+		span.Finish(tracer.WithError(err))
+		logger.WithUser(user.GetUserId()).Errorf("Failed to insert tracks of library snapshot %v %v", err, span)
+		return err
+	}
+
+	snapshot := LibrarySnapshot{
+		user.GetId(),
+		user.GetId(),
+		"",
+		trackIds,
+		trackSources,
+		trackAddedAts,
+		libraryOptions.Sources,
+		libraryOptions.PlaylistSelection,
+		time.Now(),
+	}
+
+	for _, snapshotToSave := range []LibrarySnapshot{snapshot, getRoomLibrarySnapshot(snapshot, roomId)} {
+		err = replaceLibrarySnapshot(snapshotToSave, ctx)
+
+		if err != nil {
+			span.Finish(tracer.WithError(err))
+			return err
+		}
+	}
+
+	logger.WithUser(user.GetUserId()).Infof("Library snapshot saved with %d tracks %v", len(trackIds), span)
+
+	return nil
+}
+
+// Keeps the snapshot as the one of the room, its tracks are already stored
+func SaveRoomLibrarySnapshot(snapshot *LibrarySnapshot, roomId string, ctx context.Context) error {
+	span, ctx := tracer.StartSpanFromContext(ctx, "mongo.library_snapshot.save_room")
+	defer span.Finish()
+	span.SetTag("user", snapshot.UserId)
+
+	err := replaceLibrarySnapshot(getRoomLibrarySnapshot(*snapshot, roomId), ctx)
+
+	if err != nil {
+		span.Finish(tracer.WithError(err))
+		return err
+	}
+
+	logger.WithUserAndRoom(snapshot.UserId, roomId).Infof("Library snapshot kept for room %v", span)
+
+	return nil
+}
+
+func getRoomLibrarySnapshot(snapshot LibrarySnapshot, roomId string) LibrarySnapshot {
+	snapshot.Id = getRoomLibrarySnapshotId(snapshot.UserId, roomId)
+	snapshot.RoomId = roomId
+
+	return snapshot
+}
+
+func replaceLibrarySnapshot(snapshot LibrarySnapshot, ctx context.Context) error {
+	upsert := true
+
+	_, err := GetDatabase().Collection(librarySnapshotCollection).ReplaceOne(
+		ctx,
+		bson.D{{"_id", snapshot.Id}},
+		snapshot,
+		&options.ReplaceOptions{Upsert: &upsert})
+
+	if err != nil {
+		logger.WithUser(snapshot.UserId).Errorf("Failed to save library snapshot %s %v", snapshot.Id, err)
+	}
+
+	return err
+}
+
+// Returns the latest snapshot of the user, whatever the room it was fetched for
+func GetLibrarySnapshot(userId string, ctx context.Context) (*LibrarySnapshot, error) {
+	return getLibrarySnapshot(userId, userId, ctx)
+}
+
+// Returns the snapshot of the library of the user as it was fetched for the room
+func GetRoomLibrarySnapshot(userId string, roomId string, ctx context.Context) (*LibrarySnapshot, error) {
+	return getLibrarySnapshot(getRoomLibrarySnapshotId(userId, roomId), userId, ctx)
+}
+
+func getLibrarySnapshot(snapshotId string, userId string, ctx context.Context) (*LibrarySnapshot, error) {
+	var snapshot LibrarySnapshot
+
+	err := GetDatabase().Collection(librarySnapshotCollection).FindOne(
+		ctx,
+		bson.D{{"_id", snapshotId}}).Decode(&snapshot)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrLibrarySnapshotNotFound
+	}
+
+	if err != nil {
+		logger.WithUser(userId).Errorf("Failed to find library snapshot %s %v", snapshotId, err)
+		return nil, err
+	}
+
+	// the snapshots saved before the rooms kept their own did not have the user id as a field
+	snapshot.UserId = userId
+
+	return &snapshot, nil
+}
+
+// Returns the tracks of the library snapshot with their library source and the time they were added, tracks that are
+// no longer stored are skipped. The snapshots saved before those were kept give tracks without them
+func GetLibrarySnapshotTracks(snapshot *LibrarySnapshot) ([]*clientcommon.Track, error) {
+	tracksPerId, err := GetTracks(snapshot.TrackIds)
+
+	if err != nil {
+		logger.WithUser(snapshot.UserId).Errorf("Failed to get tracks of library snapshot %v", err)
+		return nil, err
+	}
+
+	tracks := make([]*clientcommon.Track, 0, len(snapshot.TrackIds))
+
+	hasSources := len(snapshot.TrackSources) == len(snapshot.TrackIds)
+	hasAddedAts := len(snapshot.TrackAddedAts) == len(snapshot.TrackIds)
+
+	for i, trackId := range snapshot.TrackIds {
+		track, ok := tracksPerId[trackId]
+
+		if !ok {
+			continue
+		}
+
+		// the same track can come from several sources, so each of them gets its own copy
+		if hasSources || hasAddedAts {
+			libraryTrack := *track
+			track = &libraryTrack
+		}
+
+		if hasSources {
+			track.LibrarySource = snapshot.TrackSources[i]
+		}
+
+		if hasAddedAts {
+			track.AddedAt = snapshot.TrackAddedAts[i]
+		}
+
+		tracks = append(tracks, track)
+	}
+
+	return tracks, nil
+}
@@ -0,0 +1,80 @@
+package mongoclient
+
+import (
+	"github.com/shared-spotify/musicclient/clientcommon"
+	"testing"
+	"time"
+)
+
+func TestGetRoomLibrarySnapshot(t *testing.T) {
+	snapshot := LibrarySnapshot{Id: "user", UserId: "user", TrackIds: []string{"ISRC1", "ISRC2"}}
+
+	roomSnapshot := getRoomLibrarySnapshot(snapshot, "room")
+
+	if roomSnapshot.Id != "user:room" || roomSnapshot.RoomId != "room" || roomSnapshot.UserId != "user" {
+		t.Errorf("Unexpected room snapshot %s of user %s in room %s", roomSnapshot.Id, roomSnapshot.UserId,
+			roomSnapshot.RoomId)
+	}
+
+	if len(roomSnapshot.TrackIds) != 2 {
+		t.Errorf("Expected the room snapshot to keep the 2 tracks, got %d", len(roomSnapshot.TrackIds))
+	}
+
+	// the latest snapshot of the user is still saved as it is
+	if snapshot.Id != "user" || snapshot.RoomId != "" {
+		t.Errorf("Expected the latest snapshot to be unchanged, got %s in room %s", snapshot.Id, snapshot.RoomId)
+	}
+}
+
+func TestLibrarySnapshotIsFresh(t *testing.T) {
+	tests := []struct {
+		name      string
+		fetchedAt time.Time
+		expected  bool
+	}{
+		{"just fetched", time.Now(), true},
+		{"before the max age", time.Now().Add(-LibrarySnapshotMaxAge / 2), true},
+		{"after the max age", time.Now().Add(-2 * LibrarySnapshotMaxAge), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			snapshot := LibrarySnapshot{FetchedAt: test.fetchedAt}
+
+			if isFresh := snapshot.IsFresh(); isFresh != test.expected {
+				t.Errorf("Expected is fresh to be %t, got %t", test.expected, isFresh)
+			}
+		})
+	}
+}
+
+func TestLibrarySnapshotHasOptions(t *testing.T) {
+	selection := &clientcommon.PlaylistSelection{IncludedIds: []string{"playlist"}}
+
+	tests := []struct {
+		name              string
+		sources           clientcommon.LibrarySources
+		playlistSelection *clientcommon.PlaylistSelection
+		options           *clientcommon.LibraryOptions
+		expected          bool
+	}{
+		{"default sources", nil, nil, clientcommon.CreateLibraryOptions(nil, nil), true},
+		{"default sources chosen", nil, nil,
+			clientcommon.CreateLibraryOptions(clientcommon.DefaultLibrarySources, nil), true},
+		{"other sources", nil, nil,
+			clientcommon.CreateLibraryOptions(clientcommon.LibrarySources{clientcommon.LibrarySourceTopTracks}, nil),
+			false},
+		{"same playlist selection", nil, selection, clientcommon.CreateLibraryOptions(nil, selection), true},
+		{"playlist selection added", nil, nil, clientcommon.CreateLibraryOptions(nil, selection), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			snapshot := LibrarySnapshot{Sources: test.sources, PlaylistSelection: test.playlistSelection}
+
+			if hasOptions := snapshot.HasOptions(test.options); hasOptions != test.expected {
+				t.Errorf("Expected has options to be %t, got %t", test.expected, hasOptions)
+			}
+		})
+	}
+}
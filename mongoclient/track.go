@@ -4,7 +4,6 @@ import (
 	"context"
 	"github.com/shared-spotify/logger"
 	"github.com/shared-spotify/musicclient/clientcommon"
-	"github.com/zmb3/spotify"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -13,12 +12,15 @@ import (
 
 const trackCollection = "tracks"
 
+// the tracks of a library are written in batches, as a library can have too many tracks for a single transaction
+const trackBatchSize = 1000
+
 type MongoTrack struct {
-	TrackId            string `bson:"_id"`
-	*spotify.FullTrack `bson:"inline"`
+	TrackId             string `bson:"_id"`
+	*clientcommon.Track `bson:"inline"`
 }
 
-func InsertTracks(tracks []*spotify.FullTrack, ctx context.Context) error {
+func InsertTracks(tracks []*clientcommon.Track, ctx context.Context) error {
 	span, ctx := tracer.StartSpanFromContext(ctx, "mongo.tracks.insert")
 	defer span.Finish()
 
@@ -54,18 +56,9 @@ func InsertTracks(tracks []*spotify.FullTrack, ctx context.Context) error {
 
 	err = mongo.WithSession(ctx, mongoSession, func(sessionContext mongo.SessionContext) error {
 		ordered := false
-		upsert := true
-
-		writes := make([]mongo.WriteModel, 0)
-		for _, track := range tracksToInsert {
-			writes = append(writes, &mongo.ReplaceOneModel{Upsert: &upsert, Filter: bson.D{{
-				"_id",
-				track.TrackId,
-			}}, Replacement: track})
-		}
 
 		_, err = GetDatabase().Collection(trackCollection).BulkWrite(
-			ctx, writes, &options.BulkWriteOptions{Ordered: &ordered})
+			ctx, getTrackWrites(tracksToInsert), &options.BulkWriteOptions{Ordered: &ordered})
 
 		if err != nil {
 			span.Finish(tracer.WithError(err))
@@ -77,7 +70,7 @@ func InsertTracks(tracks []*spotify.FullTrack, ctx context.Context) error {
 
 		if err != nil {
 			span.Finish(tracer.WithError(err))
-			logger.Logger.Error("Failed to commit mongo transaction to insert tracks %v %v", err, span)
+			logger.Logger.Errorf("Failed to commit mongo transaction to insert tracks %v %v", err, span)
 			return err
 		}
 
@@ -98,9 +91,78 @@ func InsertTracks(tracks []*spotify.FullTrack, ctx context.Context) error {
 	return nil
 }
 
-func GetTracks(trackIds []string) (map[string]*spotify.FullTrack, error) {
-	mongoTracks := make([]*MongoTrack, 0)
-	tracksPerId := make(map[string]*spotify.FullTrack)
+// Inserts the tracks in batches outside of a transaction, a batch failing leaves the previous ones written
+// The tracks already stored are left as they are, they can have been merged with the infos of other providers and be
+// used by the playlists of rooms, which the copy of the track from a single provider would lose
+func InsertTracksInBatches(tracks []*clientcommon.Track, ctx context.Context) error {
+	span, ctx := tracer.StartSpanFromContext(ctx, "mongo.tracks.insert.batches")
+	defer span.Finish()
+
+	tracksToInsert := make([]MongoTrack, 0)
+
+	for _, track := range tracks {
+		id, _ := clientcommon.GetTrackISRC(track)
+		tracksToInsert = append(tracksToInsert, MongoTrack{id, track})
+	}
+
+	ordered := false
+
+	for i := 0; i < len(tracksToInsert); i += trackBatchSize {
+		upperBound := i + trackBatchSize
+
+		if upperBound > len(tracksToInsert) {
+			upperBound = len(tracksToInsert)
+		}
+
+		_, err := GetDatabase().Collection(trackCollection).BulkWrite(
+			ctx, getTrackInsertWrites(tracksToInsert[i:upperBound]), &options.BulkWriteOptions{Ordered: &ordered})
+
+		if err != nil {
+			span.Finish(tracer.WithError(err))
+			logger.Logger.Errorf("Failed to insert batch of tracks in mongo %v %v", err, span)
+			return err
+		}
+	}
+
+	logger.Logger.Infof("%d tracks were inserted successfully in mongo in batches %v", len(tracksToInsert), span)
+
+	return nil
+}
+
+func getTrackWrites(tracks []MongoTrack) []mongo.WriteModel {
+	upsert := true
+	writes := make([]mongo.WriteModel, 0)
+
+	for _, track := range tracks {
+		writes = append(writes, &mongo.ReplaceOneModel{Upsert: &upsert, Filter: bson.D{{
+			"_id",
+			track.TrackId,
+		}}, Replacement: track})
+	}
+
+	return writes
+}
+
+func getTrackInsertWrites(tracks []MongoTrack) []mongo.WriteModel {
+	upsert := true
+	writes := make([]mongo.WriteModel, 0)
+
+	for _, track := range tracks {
+		writes = append(writes, &mongo.UpdateOneModel{Upsert: &upsert, Filter: bson.D{{
+			"_id",
+			track.TrackId,
+		}}, Update: bson.D{{
+			"$setOnInsert",
+			track.Track,
+		}}})
+	}
+
+	return writes
+}
+
+func GetTracks(trackIds []string) (map[string]*clientcommon.Track, error) {
+	documents := make([]bson.Raw, 0)
+	tracksPerId := make(map[string]*clientcommon.Track)
 
 	filter := bson.D{{
 		"_id",
@@ -117,7 +179,7 @@ func GetTracks(trackIds []string) (map[string]*spotify.FullTrack, error) {
 		return nil, err
 	}
 
-	err = cursor.All(context.TODO(), &mongoTracks)
+	err = cursor.All(context.TODO(), &documents)
 
 	if err != nil {
 		logger.Logger.Error("Failed to find tracks in mongo ", err)
@@ -125,9 +187,30 @@ func GetTracks(trackIds []string) (map[string]*spotify.FullTrack, error) {
 	}
 
 	// we convert the tracks back to their original format
-	for _, mongoTrack := range mongoTracks {
-		isrc, _ := clientcommon.GetTrackISRC(mongoTrack.FullTrack)
-		tracksPerId[isrc] = mongoTrack.FullTrack
+	for _, document := range documents {
+		if isLegacyTrack(document) {
+			track, err := decodeLegacyTrack(document)
+
+			if err != nil {
+				logger.Logger.Errorf("Failed to convert legacy track %v in mongo %v", document.Lookup("_id"), err)
+				return nil, err
+			}
+
+			tracksPerId[track.Isrc] = track
+			continue
+		}
+
+		var mongoTrack MongoTrack
+		err = bson.Unmarshal(document, &mongoTrack)
+
+		if err != nil {
+			logger.Logger.Error("Failed to decode track in mongo ", err)
+			return nil, err
+		}
+
+		// the id is always the isrc of the track
+		mongoTrack.Track.Isrc = mongoTrack.TrackId
+		tracksPerId[mongoTrack.TrackId] = mongoTrack.Track
 	}
 
 	return tracksPerId, nil
@@ -0,0 +1,39 @@
+package mongoclient
+
+import (
+	"github.com/shared-spotify/musicclient/clientcommon"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"testing"
+)
+
+func TestGetTrackInsertWritesKeepStoredTracks(t *testing.T) {
+	track := &clientcommon.Track{Isrc: "ISRC1", Name: "Song"}
+
+	writes := getTrackInsertWrites([]MongoTrack{{"ISRC1", track}})
+
+	if len(writes) != 1 {
+		t.Fatalf("Expected 1 write, got %d", len(writes))
+	}
+
+	// a replace would overwrite the track merged with the infos of other providers
+	write, ok := writes[0].(*mongo.UpdateOneModel)
+
+	if !ok {
+		t.Fatalf("Expected an update, got %T", writes[0])
+	}
+
+	if write.Upsert == nil || !*write.Upsert {
+		t.Error("Expected the track to be inserted when it is not stored yet")
+	}
+
+	if filter := write.Filter.(bson.D); len(filter) != 1 || filter[0].Key != "_id" || filter[0].Value != "ISRC1" {
+		t.Errorf("Unexpected filter %v", filter)
+	}
+
+	update := write.Update.(bson.D)
+
+	if len(update) != 1 || update[0].Key != "$setOnInsert" || update[0].Value != track {
+		t.Errorf("Expected the track to only be set on insert, got %v", update)
+	}
+}
@@ -11,9 +11,7 @@ import (
 	"github.com/shared-spotify/logger"
 	"github.com/shared-spotify/mongoclient"
 	"github.com/shared-spotify/musicclient/clientcommon"
-	"github.com/shared-spotify/utils"
 	"net/http"
-	"net/url"
 	"time"
 )
 
@@ -86,14 +84,21 @@ func CallbackHandler(w http.ResponseWriter, r *http.Request) {
 		musickitToken,
 		musicKitUserToken}
 
-	cookie, err := EncryptToken(&appleLogin)
+	encryptedToken, err := EncryptToken(&appleLogin)
+	if err != nil {
+		logger.Logger.Error("Failed to encrypt token", err)
+		http.Error(w, "Failed to set token", http.StatusBadRequest)
+		return
+	}
+
+	cookie, err := clientcommon.GetTokenCookie(encryptedToken)
 	if err != nil {
 		logger.Logger.Error("Failed to set token", err)
 		http.Error(w, "Failed to set token", http.StatusBadRequest)
 		return
 	}
 
-	_, err = CreateUserFromToken(&appleLogin, cookie.Value)
+	_, err = CreateUserFromToken(&appleLogin, encryptedToken)
 
 	if err != nil {
 		logger.Logger.Error("Failed to authenticate user with apple music ", err)
@@ -185,53 +190,22 @@ func CreateUserFromToken(appleLogin *AppleLogin, tokenStr string) (*clientcommon
 	return user, nil
 }
 
-func EncryptToken(appleLogin *AppleLogin) (*http.Cookie, error) {
+func EncryptToken(appleLogin *AppleLogin) (string, error) {
 	jsonToken, err := json.Marshal(*appleLogin)
 
 	if err != nil {
 		logger.Logger.Error("Failed to serialise json apple login")
-		return nil, err
+		return "", err
 	}
 
-	encryptedToken, err := utils.Encrypt(jsonToken, clientcommon.TokenEncryptionKey)
+	encryptedToken, err := clientcommon.TokenKeyring.Encrypt(jsonToken)
 
 	if err != nil {
 		logger.Logger.Error("Failed to encrypt apple token ", err)
-		return nil, err
-	}
-
-	base64EncryptedToken := base64.StdEncoding.EncodeToString(encryptedToken)
-
-	expiration := time.Now().Add(365 * 24 * time.Hour)
-
-	urlParsed, err := url.Parse(clientcommon.BackendUrl)
-
-	if err != nil {
-		logger.Logger.Error("Failed to parse urls ", err)
-		return nil, err
-	}
-
-	secure := true
-	sameSite := http.SameSiteNoneMode
-
-	// for localhost development
-	if urlParsed.Scheme == "http" {
-		secure = false
-		sameSite = http.SameSiteDefaultMode
-	}
-
-	cookie := http.Cookie{
-		Name:    clientcommon.TokenCookieName,
-		Value:   base64EncryptedToken,
-		Expires: expiration,
-		// we send the cookie cross domain, so we need all this
-		Domain:   urlParsed.Host,
-		Path:     "/",
-		Secure:   secure,
-		SameSite: sameSite,
+		return "", err
 	}
 
-	return &cookie, nil
+	return base64.StdEncoding.EncodeToString(encryptedToken), nil
 }
 
 func DecryptToken(tokenStr string) (*AppleLogin, error) {
@@ -244,7 +218,7 @@ func DecryptToken(tokenStr string) (*AppleLogin, error) {
 		return nil, err
 	}
 
-	decryptedToken, err := utils.Decrypt(base64JsonToken, clientcommon.TokenEncryptionKey)
+	decryptedToken, err := clientcommon.TokenKeyring.Decrypt(base64JsonToken)
 
 	if err != nil {
 		logger.Logger.Error("Failed to decrypt apple token ", err)
@@ -0,0 +1,80 @@
+package applemusic
+
+import (
+	"fmt"
+	applemusic "github.com/minchao/go-apple-music"
+	"github.com/shared-spotify/musicclient/clientcommon"
+	"strings"
+)
+
+// Conversion of the apple music objects to our own music objects
+
+const artworkSize = 640
+const contentRatingExplicit = "explicit"
+
+func ToTrack(song *applemusic.Song) *clientcommon.Track {
+	attributes := song.Attributes
+
+	// apple music only gives us the name of the artist
+	artists := []*clientcommon.Artist{{Name: attributes.ArtistName}}
+
+	images := make([]clientcommon.Image, 0)
+
+	if attributes.Artwork.URL != "" {
+		// the artwork url is a template where we need to set the size we want
+		url := strings.NewReplacer(
+			"{w}", fmt.Sprint(artworkSize),
+			"{h}", fmt.Sprint(artworkSize),
+		).Replace(attributes.Artwork.URL)
+		images = append(images, clientcommon.Image{Url: url, Height: artworkSize, Width: artworkSize})
+	}
+
+	// release date is in the format 2006-01-02, but can sometimes only contain the year
+	releaseDatePrecision := "day"
+	if len(attributes.ReleaseDate) == 4 {
+		releaseDatePrecision = "year"
+	}
+
+	album := &clientcommon.Album{
+		Name:                 attributes.AlbumName,
+		Images:               images,
+		ReleaseDate:          attributes.ReleaseDate,
+		ReleaseDatePrecision: releaseDatePrecision,
+	}
+
+	previewUrl := ""
+	if attributes.Previews != nil && len(*attributes.Previews) > 0 {
+		previewUrl = (*attributes.Previews)[0].Url
+	}
+
+	return &clientcommon.Track{
+		Isrc:        attributes.ISRC,
+		Name:        attributes.Name,
+		Artists:     artists,
+		Album:       album,
+		Duration:    int(attributes.DurationInMillis),
+		Explicit:    attributes.ContentRating == contentRatingExplicit,
+		PreviewUrl:  previewUrl,
+		ProviderIds: clientcommon.ProviderIds{clientcommon.AppleMusicLoginType: song.Id},
+	}
+}
+
+// The playlists which the user did not create were added from the catalog
+// (we find this by checking edit and delete permissions)
+func toLibraryPlaylist(playlist *applemusic.LibraryPlaylist) *clientcommon.LibraryPlaylist {
+	return &clientcommon.LibraryPlaylist{
+		Id:    playlist.Id,
+		Name:  playlist.Attributes.Name,
+		Owned: playlist.Attributes.CanEdit,
+	}
+}
+
+func ToTracks(songs []*applemusic.Song) []*clientcommon.Track {
+	tracks := make([]*clientcommon.Track, 0)
+
+	for _, song := range songs {
+		tracks = append(tracks, ToTrack(song))
+	}
+
+	return tracks
+}
@@ -6,7 +6,6 @@ import (
 	"github.com/shared-spotify/datadog"
 	"github.com/shared-spotify/logger"
 	"github.com/shared-spotify/musicclient/clientcommon"
-	"github.com/zmb3/spotify"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 )
 
@@ -14,7 +13,8 @@ const maxISRCPerApiCall = 15
 const maxTrackPerPlaylistAddCall = 100
 const maxRetryAddSongs = 3
 
-func CreatePlaylist(user *clientcommon.User, playlistName string, tracks []*spotify.FullTrack, ctx context.Context) (*string, error) {
+func CreatePlaylist(user *clientcommon.User, playlistName string, tracks []*clientcommon.Track,
+	ctx context.Context) (*string, []*clientcommon.Track, error) {
 	rootSpan, rootCtx := tracer.StartSpanFromContext(ctx, "playlist.create.applemusic")
 	defer rootSpan.Finish()
 
@@ -25,11 +25,11 @@ func CreatePlaylist(user *clientcommon.User, playlistName string, tracks []*spot
 
 	if err != nil {
 		rootSpan.Finish(tracer.WithError(err))
-		return nil, err
+		return nil, nil, err
 	}
 
 	// we create the isrc mapping to be able later to select the best songs
-	trackToISRC := make(map[string]*spotify.FullTrack)
+	trackToISRC := make(map[string]*clientcommon.Track)
 
 	for _, track := range tracks {
 		t := track
@@ -76,7 +76,7 @@ func CreatePlaylist(user *clientcommon.User, playlistName string, tracks []*spot
 				WithUser(user.GetUserId()).
 				WithError(err).
 				Errorf("Failed to get apple songs by id to add to playlist %v", span)
-			return nil, err
+			return nil, nil, err
 		}
 
 		for _, s := range songs.Data {
@@ -100,7 +100,7 @@ func CreatePlaylist(user *clientcommon.User, playlistName string, tracks []*spot
 					allSongs[song.Attributes.ISRC] = &song
 				}
 
-				if song.Attributes.PlayParams != nil && song.Attributes.AlbumName == track.Album.Name {
+				if song.Attributes.PlayParams != nil && track.Album != nil && song.Attributes.AlbumName == track.Album.Name {
 					// if we see a second song that has the same ISRC, we take the one that has the most similar
 					// album name
 					allSongs[song.Attributes.ISRC] = &song
@@ -129,7 +129,7 @@ func CreatePlaylist(user *clientcommon.User, playlistName string, tracks []*spot
 			WithError(err).
 			Error("Failed to created apple music playlist %v", span)
 		span.Finish(tracer.WithError(err))
-		return nil, err
+		return nil, nil, err
 	}
 
 	playlist := playlists.Data[0]
@@ -140,9 +140,27 @@ func CreatePlaylist(user *clientcommon.User, playlistName string, tracks []*spot
 	// we add the tracks
 	span, ctx = tracer.StartSpanFromContext(rootCtx, "playlist.create.applemusic.add.tracks")
 	tracksToAdd := make([]applemusic.CreateLibraryPlaylistTrack, 0)
+	addedTracks := make([]*clientcommon.Track, 0)
 
-	for _, song := range allSongs {
+	addedISRCs := make(map[string]bool)
+
+	// the tracks are added in the order they were given, each song only once
+	for _, track := range tracks {
+		isrc, ok := clientcommon.GetTrackISRC(track)
+
+		if !ok || addedISRCs[isrc] {
+			continue
+		}
+
+		song, ok := allSongs[isrc]
+
+		if !ok {
+			continue
+		}
+
+		addedISRCs[isrc] = true
 		tracksToAdd = append(tracksToAdd, applemusic.CreateLibraryPlaylistTrack{Id: song.Id, Type: "music"})
+		addedTracks = append(addedTracks, track)
 	}
 
 	// Send the track by batch of maxTrackPerPlaylistAddCall, as we are limited on the number of songs we can
@@ -183,7 +201,7 @@ func CreatePlaylist(user *clientcommon.User, playlistName string, tracks []*spot
 				WithError(err).
 				Errorf("Failed to add songs to playlist %s %v", playlistName, span)
 			span.Finish(tracer.WithError(err))
-			return nil, err
+			return nil, nil, err
 		}
 
 		logger.
@@ -201,5 +219,5 @@ func CreatePlaylist(user *clientcommon.User, playlistName string, tracks []*spot
 	//   for this reason, we can only redirect the user at best to is apple music library where he will find the playlist
 	externalLink := "https://music.apple.com/library"
 
-	return &externalLink, nil
+	return &externalLink, addedTracks, nil
 }
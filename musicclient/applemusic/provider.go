@@ -0,0 +1,87 @@
+package applemusic
+
+import (
+	"context"
+	"errors"
+	"github.com/shared-spotify/datadog"
+	"github.com/shared-spotify/logger"
+	"github.com/shared-spotify/musicclient/clientcommon"
+	"net/http"
+)
+
+// The apple music implementation of the music provider
+var Provider clientcommon.MusicProvider = &provider{}
+
+type provider struct{}
+
+func (p *provider) LoginType() string {
+	return clientcommon.AppleMusicLoginType
+}
+
+func (p *provider) MetricsName() string {
+	return datadog.AppleMusicProvider
+}
+
+// The apple login is done in the frontend with musickit, we only receive the infos of the user here
+func (p *provider) LoginPath() string {
+	return "/callback/apple/user"
+}
+
+func (p *provider) Login(w http.ResponseWriter, r *http.Request) {
+	UserHandler(w, r)
+}
+
+func (p *provider) CallbackPath() string {
+	return "/callback/apple"
+}
+
+func (p *provider) Callback(w http.ResponseWriter, r *http.Request) {
+	CallbackHandler(w, r)
+}
+
+func (p *provider) EncryptToken(token interface{}) (string, error) {
+	appleLogin, ok := token.(*AppleLogin)
+
+	if !ok {
+		return "", errors.New("token is not an apple login")
+	}
+
+	return EncryptToken(appleLogin)
+}
+
+func (p *provider) DecryptToken(tokenStr string) (interface{}, error) {
+	return DecryptToken(tokenStr)
+}
+
+func (p *provider) CreateUserFromToken(tokenStr string) (*clientcommon.User, error) {
+	appleLogin, err := DecryptToken(tokenStr)
+
+	if err != nil {
+		errMsg := "failed to create user from request - failed to decrypt token "
+		logger.Logger.Error(errMsg, err)
+		return nil, errors.New(errMsg)
+	}
+
+	user, err := CreateUserFromToken(appleLogin, tokenStr)
+
+	if err != nil {
+		logger.Logger.Error("failed to create user from request - create user from token failed ", err)
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (p *provider) GetAllSongs(user *clientcommon.User, options *clientcommon.LibraryOptions,
+	progress clientcommon.ProgressHook) ([]*clientcommon.Track, error) {
+	return GetAllSongs(user, options, progress)
+}
+
+func (p *provider) GetPlaylists(user *clientcommon.User) ([]*clientcommon.LibraryPlaylist, error) {
+	return GetPlaylists(user)
+}
+
+func (p *provider) CreatePlaylist(user *clientcommon.User, playlistName string, tracks []*clientcommon.Track,
+	ctx context.Context) (*string, []*clientcommon.Track, error) {
+	return CreatePlaylist(user, playlistName, tracks, ctx)
+}
@@ -14,45 +14,62 @@ const maxCatalogSongsPerApiCall = 300
 const maxPlaylistPerApiCall = 100
 const maxRetryGetSongsByIsrc = 10
 
-func GetAllSongs(user *clientcommon.User) ([]*applemusic.Song, error) {
+func GetAllSongs(user *clientcommon.User, options *clientcommon.LibraryOptions,
+	progress clientcommon.ProgressHook) ([]*clientcommon.Track, error) {
+	allTracks := make([]*clientcommon.Track, 0)
+
 	// Get the library songs
-	logger.WithUser(user.GetUserId()).Info("Fetching all apple library songs for user")
+	if options.Sources.Includes(clientcommon.LibrarySourceLikedSongs) {
+		logger.WithUser(user.GetUserId()).Info("Fetching all apple library songs for user")
 
-	savedSongs, err := GetLibrarySongs(user)
+		savedSongs, err := GetLibrarySongs(user, progress)
 
-	if err != nil {
-		logger.WithUser(user.GetUserId()).Error(
-			"Failed to fetch all apple library songs for user ",
-			err)
-		return nil, err
-	}
+		if err != nil {
+			logger.WithUser(user.GetUserId()).Error(
+				"Failed to fetch all apple library songs for user ",
+				err)
+			return nil, err
+		}
+
+		logger.WithUser(user.GetUserId()).Info("Successfully fetched all apple library songs for user")
 
-	logger.WithUser(user.GetUserId()).Info("Successfully fetched all apple library songs for user")
+		allTracks = append(allTracks,
+			clientcommon.SetLibrarySource(ToTracks(savedSongs), clientcommon.LibrarySourceLikedSongs)...)
+	}
 
 	// Get the playlist songs
-	logger.WithUser(user.GetUserId()).Info("Fetching all apple library songs for library playlists for user")
+	if options.IncludesPlaylists() {
+		logger.WithUser(user.GetUserId()).Info("Fetching all apple library songs for library playlists for user")
+
+		playlistSongs, err := GetAllLibraryPlaylistSongs(user, options, progress)
 
-	playlistSongs, err := GetAllLibraryPlaylistSongs(user)
+		if err != nil {
+			logger.WithUser(user.GetUserId()).Error(
+				"Failed to fetch all apple library songs for library playlists for user",
+				err)
+			return nil, err
+		}
 
-	logger.WithUser(user.GetUserId()).Info("Successfully fetched all apple library songs for library playlists for user")
+		logger.WithUser(user.GetUserId()).Info("Successfully fetched all apple library songs for library playlists for user")
 
-	if err != nil {
-		logger.WithUser(user.GetUserId()).Error(
-			"Failed to fetch all apple library songs for library playlists for user",
-			err)
-		return nil, err
+		allTracks = append(allTracks, playlistSongs...)
 	}
 
-	// Merge all the songs here
-	allSongs := make([]*applemusic.Song, 0)
-	allSongs = append(allSongs, savedSongs...)
-	allSongs = append(allSongs, playlistSongs...)
+	// apple music does not give the top tracks or the recently played tracks of a user
+	if options.Sources.Includes(clientcommon.LibrarySourceTopTracks) {
+		logger.WithUser(user.GetUserId()).Warning("Top tracks are not available on apple music, skipping them")
+	}
 
-	return allSongs, nil
+	if options.Sources.Includes(clientcommon.LibrarySourceRecentlyPlayed) {
+		logger.WithUser(user.GetUserId()).Warning(
+			"Recently played tracks are not available on apple music, skipping them")
+	}
+
+	return allTracks, nil
 }
 
 // This method gets all the library songs of a user
-func GetLibrarySongs(user *clientcommon.User) ([]*applemusic.Song, error) {
+func GetLibrarySongs(user *clientcommon.User, progress clientcommon.ProgressHook) ([]*applemusic.Song, error) {
 	client := user.AppleMusicClient
 
 	// We fetch all the library songs
@@ -83,6 +100,8 @@ func GetLibrarySongs(user *clientcommon.User) ([]*applemusic.Song, error) {
 			allLibrarySongs = append(allLibrarySongs, &song)
 		}
 
+		progress.Report(clientcommon.ProgressStepPageFetched, clientcommon.SourceSavedSongs, len(allLibrarySongs), 0)
+
 		logger.WithUser(user.GetUserId()).Debugf("Library songs next=%s href=%s", librarySongs.Next, librarySongs.Href)
 
 		if librarySongs.Next == "" {
@@ -92,7 +111,7 @@ func GetLibrarySongs(user *clientcommon.User) ([]*applemusic.Song, error) {
 		offset += maxPage
 	}
 
-	allTracks, err := getFullSongsForLibrarySongs(user, allLibrarySongs)
+	allTracks, err := getFullSongsForLibrarySongs(user, allLibrarySongs, progress)
 
 	if err != nil {
 		logger.WithUser(user.GetUserId()).Error("Failed to convert apple library songs to catalog songs ", err)
@@ -104,61 +123,31 @@ func GetLibrarySongs(user *clientcommon.User) ([]*applemusic.Song, error) {
 	return allTracks, nil
 }
 
-// This method gets all the songs from the playlists of the user
-func GetAllLibraryPlaylistSongs(user *clientcommon.User) ([]*applemusic.Song, error) {
+// This method gets all the songs from the playlists of the user included by the options, with the source of their
+// playlist
+func GetAllLibraryPlaylistSongs(user *clientcommon.User, options *clientcommon.LibraryOptions,
+	progress clientcommon.ProgressHook) ([]*clientcommon.Track, error) {
 	client := user.AppleMusicClient
 
-	// We fetch all the library playlists
-	allLibraryPlaylists := make([]*applemusic.LibraryPlaylist, 0)
-
-	next := true
-	offset := 0
-
-	for next {
-		logger.WithUser(user.GetUserId()).Debugf("Fetching library playlists songs offset %d", offset)
+	allLibraryPlaylists, err := getLibraryPlaylists(user, progress)
 
-		playlists, _, err := client.Me.GetAllLibraryPlaylists(
-			context.Background(),
-			&applemusic.PageOptions{Offset: offset, Limit: maxPlaylistPerApiCall})
-
-		clientcommon.SendRequestMetric(datadog.AppleMusicProvider, datadog.RequestTypePlaylists, true, err)
-
-		if err != nil {
-			logger.WithUser(user.GetUserId()).Error("Failed to fetch apple library playlists ", err)
-			return nil, err
-		}
-
-		logger.WithUser(user.GetUserId()).Debugf("Found %d library playlists songs for offset %d", len(playlists.Data), offset)
-
-		// Add all the playlists
-		for _, p := range playlists.Data {
-			playlist := p
-			allLibraryPlaylists = append(allLibraryPlaylists, &playlist)
-		}
-
-		if playlists.Next == "" {
-			next = false
-		}
-
-		logger.WithUser(user.GetUserId()).Debugf("Library playlist songs next=%s", playlists.Next)
-
-		offset += maxPlaylistPerApiCall
+	if err != nil {
+		return nil, err
 	}
 
-	logger.WithUser(user.GetUserId()).Infof("User %s has a total of %d apple playlists", user.GetUserId(), len(allLibraryPlaylists))
-
 	// We fetch all the songs for each library playlist
 
 	// These are not real song objects, we need to fetch storefront to have real songs with all the info
-	allIncompleteSongs := make([]*applemusic.Song, 0)
+	// They are kept per source, so the songs can be tagged with the source they come from
+	incompleteSongsPerSource := make(map[string][]*applemusic.Song)
+	incompleteSongCount := 0
 
 	for _, playlist := range allLibraryPlaylists {
+		libraryPlaylist := toLibraryPlaylist(playlist)
 
-		// Do not take into account playlists which the user did not create
-		// (we find this by checking edit and delete permissions)
-		if !playlist.Attributes.CanEdit {
+		if !options.IncludesPlaylist(libraryPlaylist) {
 			logger.WithUser(user.GetUserId()).Warningf(
-				"Skipped apple playlist %s as user had not write access edit=%t",
+				"Skipped apple playlist %s as it is not included edit=%t",
 				playlist.Attributes.Name,
 				playlist.Attributes.CanEdit)
 			continue
@@ -195,17 +184,30 @@ func GetAllLibraryPlaylistSongs(user *clientcommon.User) ([]*applemusic.Song, er
 			len(librarySongs),
 			playlist.Attributes.Name)
 
+		source := options.GetPlaylistSource(libraryPlaylist)
+
 		for _, l := range librarySongs {
 			librarySong := l
-			allIncompleteSongs = append(allIncompleteSongs, &librarySong)
+			incompleteSongsPerSource[source] = append(incompleteSongsPerSource[source], &librarySong)
 		}
+
+		incompleteSongCount += len(librarySongs)
+
+		progress.Report(clientcommon.ProgressStepPageFetched, clientcommon.SourcePlaylistSongs,
+			incompleteSongCount, 0)
 	}
 
-	allTracks, err := getFullSongsForIncompleteSongs(user, allIncompleteSongs)
+	allTracks := make([]*clientcommon.Track, 0)
 
-	if err != nil {
-		logger.WithUser(user.GetUserId()).Error("Failed to convert apple playlist library songs to catalog songs ", err)
-		return nil, err
+	for source, incompleteSongs := range incompleteSongsPerSource {
+		songs, err := getFullSongsForIncompleteSongs(user, incompleteSongs, progress)
+
+		if err != nil {
+			logger.WithUser(user.GetUserId()).Error("Failed to convert apple playlist library songs to catalog songs ", err)
+			return nil, err
+		}
+
+		allTracks = append(allTracks, clientcommon.SetLibrarySource(ToTracks(songs), source)...)
 	}
 
 	logger.WithUser(user.GetUserId()).Infof("Found %d apple playlist library songs", len(allTracks))
@@ -213,8 +215,73 @@ func GetAllLibraryPlaylistSongs(user *clientcommon.User) ([]*applemusic.Song, er
 	return allTracks, nil
 }
 
+func GetPlaylists(user *clientcommon.User) ([]*clientcommon.LibraryPlaylist, error) {
+	libraryPlaylists, err := getLibraryPlaylists(user, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	playlists := make([]*clientcommon.LibraryPlaylist, 0)
+
+	for _, libraryPlaylist := range libraryPlaylists {
+		playlists = append(playlists, toLibraryPlaylist(libraryPlaylist))
+	}
+
+	return playlists, nil
+}
+
+// This method gets all the library playlists of the user
+func getLibraryPlaylists(user *clientcommon.User, progress clientcommon.ProgressHook) ([]*applemusic.LibraryPlaylist, error) {
+	client := user.AppleMusicClient
+
+	// We fetch all the library playlists
+	allLibraryPlaylists := make([]*applemusic.LibraryPlaylist, 0)
+
+	next := true
+	offset := 0
+
+	for next {
+		logger.WithUser(user.GetUserId()).Debugf("Fetching library playlists songs offset %d", offset)
+
+		playlists, _, err := client.Me.GetAllLibraryPlaylists(
+			context.Background(),
+			&applemusic.PageOptions{Offset: offset, Limit: maxPlaylistPerApiCall})
+
+		clientcommon.SendRequestMetric(datadog.AppleMusicProvider, datadog.RequestTypePlaylists, true, err)
+
+		if err != nil {
+			logger.WithUser(user.GetUserId()).Error("Failed to fetch apple library playlists ", err)
+			return nil, err
+		}
+
+		logger.WithUser(user.GetUserId()).Debugf("Found %d library playlists songs for offset %d", len(playlists.Data), offset)
+
+		// Add all the playlists
+		for _, p := range playlists.Data {
+			playlist := p
+			allLibraryPlaylists = append(allLibraryPlaylists, &playlist)
+		}
+
+		progress.Report(clientcommon.ProgressStepPageFetched, clientcommon.SourcePlaylists, len(allLibraryPlaylists), 0)
+
+		if playlists.Next == "" {
+			next = false
+		}
+
+		logger.WithUser(user.GetUserId()).Debugf("Library playlist songs next=%s", playlists.Next)
+
+		offset += maxPlaylistPerApiCall
+	}
+
+	logger.WithUser(user.GetUserId()).Infof("User %s has a total of %d apple playlists", user.GetUserId(), len(allLibraryPlaylists))
+
+	return allLibraryPlaylists, nil
+}
+
 // Allow us to transform incomplete songs into catalog songs where we can get all info related to a song such as ISRC
-func getFullSongsForIncompleteSongs(user *clientcommon.User, librarySongs []*applemusic.Song) ([]*applemusic.Song, error) {
+func getFullSongsForIncompleteSongs(user *clientcommon.User, librarySongs []*applemusic.Song,
+	progress clientcommon.ProgressHook) ([]*applemusic.Song, error) {
 	songByIds := make([]string, 0)
 
 	for _, librarySong := range librarySongs {
@@ -224,21 +291,22 @@ func getFullSongsForIncompleteSongs(user *clientcommon.User, librarySongs []*app
 		}
 	}
 
-	return getFullSongs(user, songByIds)
+	return getFullSongs(user, songByIds, progress)
 }
 
 // Allow us to transform library songs into catalog songs where we can get all info related to a song such as ISRC
-func getFullSongsForLibrarySongs(user *clientcommon.User, librarySongs []*applemusic.LibrarySong) ([]*applemusic.Song, error) {
+func getFullSongsForLibrarySongs(user *clientcommon.User, librarySongs []*applemusic.LibrarySong,
+	progress clientcommon.ProgressHook) ([]*applemusic.Song, error) {
 	songByIds := make([]string, 0)
 
 	for _, librarySong := range librarySongs {
 		songByIds = append(songByIds, librarySong.Attributes.PlayParams.CatalogId)
 	}
 
-	return getFullSongs(user, songByIds)
+	return getFullSongs(user, songByIds, progress)
 }
 
-func getFullSongs(user *clientcommon.User, songIds []string) ([]*applemusic.Song, error) {
+func getFullSongs(user *clientcommon.User, songIds []string, progress clientcommon.ProgressHook) ([]*applemusic.Song, error) {
 	client := user.AppleMusicClient
 
 	storefront, err := GetStorefront(user)
@@ -275,6 +343,8 @@ func getFullSongs(user *clientcommon.User, songIds []string) ([]*applemusic.Song
 		}
 
 		logger.Logger.Infof("Fetched %d apple songs successfully", upperBound-i)
+
+		progress.Report(clientcommon.ProgressStepIsrcConverted, clientcommon.SourceCatalog, upperBound, len(songIds))
 	}
 
 	return allSongs, nil
@@ -2,25 +2,23 @@ package musicclient
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
 	"github.com/shared-spotify/datadog"
 	"github.com/shared-spotify/httputils"
 	"github.com/shared-spotify/logger"
-	"github.com/shared-spotify/musicclient/applemusic"
+	"github.com/shared-spotify/mongoclient"
 	"github.com/shared-spotify/musicclient/clientcommon"
 	spotifyclient "github.com/shared-spotify/musicclient/spotify"
-	"github.com/zmb3/spotify"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 	"net/http"
+	"time"
 )
 
 // The goal of this client is to provide a general abstraction regardless of the underlying music service
 // used by the user
 //
-// We use the spotify objects for now as the reference objects - e.g. FullTrack object
-// Eventually, we should create out own data model so we can get rid of spotify and have real abstraction
-
-const retryFailCreateUserFromRequestSpotify = 5
+// Every provider converts its objects to our own data model in clientcommon - e.g. the Track object
 
 func Logout(w http.ResponseWriter, r *http.Request)  {
 	// delete the cookies
@@ -37,16 +35,12 @@ func Logout(w http.ResponseWriter, r *http.Request)  {
 	http.SetCookie(w, loginTypeDeleteCookie)
 
 	tag := "unknown"
-	tokenCookie, err := r.Cookie(clientcommon.LoginTypeCookieName)
-
-	if err != nil {
-		// nothing, do not crash
-
-	} else if tokenCookie.Value == clientcommon.SpotifyLoginType {
-		tag = datadog.SpotifyProvider
+	loginTypeCookie, err := r.Cookie(clientcommon.LoginTypeCookieName)
 
-	} else if tokenCookie.Value == clientcommon.AppleMusicLoginType {
-		tag = datadog.AppleMusicProvider
+	if err == nil {
+		if provider, ok := GetProvider(loginTypeCookie.Value); ok {
+			tag = provider.MetricsName()
+		}
 	}
 
 	datadog.Increment(1, datadog.UserLogout, datadog.Provider.Tag(tag))
@@ -67,7 +61,34 @@ func GetUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	httputils.SendJsonWithCtx(w, user, r.Context())
+	// if the token was refreshed, we send the new one to the user
+	tokenCookie, err := r.Cookie(clientcommon.TokenCookieName)
+
+	token := user.GetToken()
+
+	if err == nil && tokenCookie.Value != token {
+		cookie, err := clientcommon.GetTokenCookie(token)
+
+		if err == nil {
+			http.SetCookie(w, cookie)
+		}
+	}
+
+	userWithLibraryInfo := UserWithLibraryInfo{User: user}
+
+	// the library of the user is synced when a room it is in is processed
+	snapshot, err := mongoclient.GetLibrarySnapshot(user.GetId(), r.Context())
+
+	if err == nil {
+		userWithLibraryInfo.LibrarySyncedAt = &snapshot.FetchedAt
+	}
+
+	httputils.SendJsonWithCtx(w, userWithLibraryInfo, r.Context())
+}
+
+type UserWithLibraryInfo struct {
+	*clientcommon.User
+	LibrarySyncedAt *time.Time `json:"library_synced_at"`
 }
 
 func CreateUserFromRequest(r *http.Request) (*clientcommon.User, error) {
@@ -112,177 +133,146 @@ func CreateUserFromToken(token string, loginType string, ctx context.Context) (*
 		return user, nil
 	}
 
-	if loginType == clientcommon.SpotifyLoginType {
-		span.SetOperationName("create.user.from.spotify_token")
-		user, err := createUserFromTokenSpotify(token)
+	provider, ok := GetProvider(loginType)
 
-		if user != nil {
-			clientcommon.AddUserToCache(token, user)
-		}
-
-		span.Finish(tracer.WithError(err))
-		return user, err
-
-	} else if loginType == clientcommon.AppleMusicLoginType {
-		span.SetOperationName("create.user.from.apple_token")
-		user, err := createUserFromTokenAppleMusic(token)
-
-		if user != nil {
-			clientcommon.AddUserToCache(token, user)
-		}
-
-		span.Finish(tracer.WithError(err))
-		return user, err
-
-	} else {
+	if !ok {
 		msg := "Unknown token login type, found " + loginType
 		err := errors.New(msg)
 		logger.Logger.Warning(msg)
 		span.Finish(tracer.WithError(err))
 		return nil, err
 	}
-}
 
-func createUserFromTokenSpotify(tokenStr string) (*clientcommon.User, error) {
-	token, err := spotifyclient.DecryptToken(tokenStr)
+	span.SetOperationName("create.user.from." + provider.MetricsName() + "_token")
+	user, err := provider.CreateUserFromToken(token)
 
-	if err != nil {
-		errMsg := "failed to create user from request - failed to decrypt token "
-		logger.Logger.Error(errMsg, err)
-		return nil, errors.New(errMsg)
+	if user != nil {
+		clientcommon.AddUserToCache(token, user)
+		reencryptTokenIfNeeded(provider, user)
 	}
 
-	var user *clientcommon.User
-	retry := 0
+	span.Finish(tracer.WithError(err))
+	return user, err
+}
 
-	// We retry for spotify because the api throws randomly 503 sometimes
-	for retry < retryFailCreateUserFromRequestSpotify {
-		user, err = spotifyclient.CreateUserFromToken(token, tokenStr)
+// Tokens encrypted with a previous key or in the legacy format are encrypted again with the current key, the new
+// token is then saved the same way as a refreshed token
+func reencryptTokenIfNeeded(provider clientcommon.MusicProvider, user *clientcommon.User) {
+	currentToken := user.GetToken()
+	encryptedToken, err := base64.StdEncoding.DecodeString(currentToken)
 
-		if user != nil {
-			break
-		}
-
-		retry += 1
-		logger.Logger.Warningf("Failed to create user from request, retrying with retry count=%d, %v", retry, err)
+	if err != nil || clientcommon.TokenKeyring.IsCurrent(encryptedToken) {
+		return
 	}
 
-	if err != nil {
-		logger.Logger.Error("failed to create user from request - create user from token failed ", err)
-		return nil, err
-	}
-
-	return user, nil
-}
-
-func createUserFromTokenAppleMusic(tokenStr string) (*clientcommon.User, error) {
-	appleLogin, err := applemusic.DecryptToken(tokenStr)
+	token, err := provider.DecryptToken(currentToken)
 
 	if err != nil {
-		errMsg := "failed to create user from request - failed to decrypt token "
-		logger.Logger.Error(errMsg, err)
-		return nil, errors.New(errMsg)
+		logger.WithUser(user.GetUserId()).Error("Failed to decrypt token to encrypt it again ", err)
+		return
 	}
 
-	user, err := applemusic.CreateUserFromToken(appleLogin, tokenStr)
+	newToken, err := provider.EncryptToken(token)
 
 	if err != nil {
-		logger.Logger.Error("failed to create user from request - create user from token failed ", err)
-		return nil, err
+		logger.WithUser(user.GetUserId()).Error("Failed to encrypt token again ", err)
+		return
 	}
 
-	return user, nil
+	oldToken := user.SetToken(newToken)
+
+	clientcommon.NotifyTokenRefreshed(user, oldToken)
 }
 
 /**
   Get all songs abstraction
 */
 
-func GetAllSongs(user *clientcommon.User) ([]*spotify.FullTrack, error) {
-	var allSongs []*spotify.FullTrack
-
-	if user.IsSpotify() {
-		songs, err := spotifyclient.GetAllSongs(user)
-
-		if err != nil {
-			return nil, err
-		}
+func GetAllSongs(user *clientcommon.User, options *clientcommon.LibraryOptions,
+	progress clientcommon.ProgressHook) ([]*clientcommon.Track, error) {
+	provider, err := getUserProvider(user)
 
-		allSongs = songs
-
-	} else if user.IsAppleMusic() {
-		// we first query the songs
-		appleMusicSongs, err := applemusic.GetAllSongs(user)
-
-		if err != nil {
-			return nil, err
-		}
-
-		isrcs := make([]string, 0)
-
-		for _, song := range appleMusicSongs {
-			isrcs = append(isrcs, song.Attributes.ISRC)
-		}
+	if err != nil {
+		return nil, err
+	}
 
-		// we then convert the data to spotify tracks
-		songs, err := spotifyclient.GetTrackForISRCs(user, isrcs)
+	return provider.GetAllSongs(user, options, progress)
+}
 
-		if err != nil {
-			return nil, err
-		}
+func GetPlaylists(user *clientcommon.User) ([]*clientcommon.LibraryPlaylist, error) {
+	provider, err := getUserProvider(user)
 
-		allSongs = songs
+	if err != nil {
+		return nil, err
 	}
 
-	return allSongs, nil
+	return provider.GetPlaylists(user)
 }
 
 /**
   Get additional information abstractions
 */
 
-func GetAlbums(tracks []*spotify.FullTrack) (map[string]*spotify.FullAlbum, error) {
+// Additional information is only available on spotify, so we first find the spotify version of the tracks
+// coming from other providers
+func ResolveTracks(tracks []*clientcommon.Track, progress clientcommon.ProgressHook) error {
+	return spotifyclient.ResolveTracks(tracks, progress)
+}
+
+func GetAlbums(tracks []*clientcommon.Track) (map[string]*clientcommon.Album, error) {
 	return spotifyclient.GetAlbums(tracks)
 }
 
-func GetArtists(tracks []*spotify.FullTrack) (map[string][]*spotify.FullArtist, error) {
+func GetArtists(tracks []*clientcommon.Track) (map[string][]*clientcommon.Artist, error) {
 	return spotifyclient.GetArtists(tracks)
 }
 
-func GetAudioFeatures(tracks []*spotify.FullTrack) (map[string]*spotify.AudioFeatures, error) {
+func GetAudioFeatures(tracks []*clientcommon.Track) (map[string]*clientcommon.AudioFeatures, error) {
 	return spotifyclient.GetAudioFeatures(tracks)
 }
 
+// The catalog is searched on spotify, as it is where the additional information is
+func SearchTracks(name string, artist string, limit int) ([]*clientcommon.Track, error) {
+	return spotifyclient.SearchTracks(name, artist, limit)
+}
+
+// Recommendations are only available on spotify, the ids given are spotify ids
+func GetRecommendations(trackIds []string, artistIds []string, genres []string, limit int) ([]*clientcommon.Track, error) {
+	return spotifyclient.GetRecommendations(trackIds, artistIds, genres, limit)
+}
+
 /**
   Create playlists
 */
 
-func CreatePlaylist(user *clientcommon.User, playlistName string, tracks []*spotify.FullTrack, ctx context.Context) (*string, error) {
+func CreatePlaylist(user *clientcommon.User, playlistName string, tracks []*clientcommon.Track,
+	ctx context.Context) (*string, []*clientcommon.Track, error) {
 	span, ctx := tracer.StartSpanFromContext(ctx, "playlist.create")
 	defer span.Finish()
 
-	var link *string
+	provider, err := getUserProvider(user)
 
-	if user.IsSpotify() {
-		externalLink, err := spotifyclient.CreatePlaylist(user, playlistName, tracks, ctx)
+	if err != nil {
+		span.Finish(tracer.WithError(err))
+		return nil, nil, err
+	}
 
-		if err != nil {
-			span.Finish(tracer.WithError(err))
-			return nil, err
-		}
+	link, addedTracks, err := provider.CreatePlaylist(user, playlistName, tracks, ctx)
 
-		link = externalLink
+	if err != nil {
+		span.Finish(tracer.WithError(err))
+		return nil, nil, err
+	}
 
-	} else if user.IsAppleMusic() {
-		externalLink, err := applemusic.CreatePlaylist(user, playlistName, tracks, ctx)
+	return link, addedTracks, nil
+}
 
-		if err != nil {
-			span.Finish(tracer.WithError(err))
-			return nil, err
-		}
+func getUserProvider(user *clientcommon.User) (clientcommon.MusicProvider, error) {
+	provider, ok := GetProvider(user.LoginType)
 
-		link = externalLink
+	if !ok {
+		return nil, errors.New("Unknown login type for user, found " + user.LoginType)
 	}
 
-	return link, nil
+	return provider, nil
 }
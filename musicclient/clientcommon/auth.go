@@ -1,10 +1,13 @@
 package clientcommon
 
 import (
+	"fmt"
 	"github.com/shared-spotify/logger"
+	"github.com/shared-spotify/utils"
 	"net/http"
 	"net/url"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -14,13 +17,49 @@ const TokenCookieName = "token"
 // Login types
 const SpotifyLoginType = "spotify"
 const AppleMusicLoginType = "applemusic"
+const DeezerLoginType = "deezer"
 
+// Tokens are encrypted with the current key, the previous keys (comma separated) are only used to decrypt tokens
+// encrypted before a key rotation. Legacy tokens are accepted until TOKEN_ENCRYPTION_ALLOW_LEGACY is set to false
 var TokenEncryptionKey = os.Getenv("TOKEN_ENCRYPTION_KEY")
+var TokenEncryptionPreviousKeys = os.Getenv("TOKEN_ENCRYPTION_PREVIOUS_KEYS")
+var TokenEncryptionAllowLegacy = os.Getenv("TOKEN_ENCRYPTION_ALLOW_LEGACY") != "false"
+
+var TokenKeyring = createTokenKeyring()
 
 var BackendUrl = os.Getenv("BACKEND_URL")
 var FrontendUrl = os.Getenv("FRONTEND_URL")
 
+const RedirectParam = "redirect_uri"
+var loginUrl = FrontendUrl + "/login"
+
+func createTokenKeyring() *utils.Keyring {
+	previousKeys := make([]string, 0)
+
+	for _, key := range strings.Split(TokenEncryptionPreviousKeys, ",") {
+		if key != "" {
+			previousKeys = append(previousKeys, key)
+		}
+	}
+
+	keyring, err := utils.NewKeyring(TokenEncryptionKey, previousKeys, TokenEncryptionAllowLegacy)
+
+	if err != nil {
+		logger.Logger.Fatal("Failed to create token keyring ", err)
+	}
+
+	return keyring
+}
+
 func GetLoginTypeCookie(loginType string) (*http.Cookie, error) {
+	return getCookie(LoginTypeCookieName, loginType)
+}
+
+func GetTokenCookie(encryptedToken string) (*http.Cookie, error) {
+	return getCookie(TokenCookieName, encryptedToken)
+}
+
+func getCookie(cookieName string, value string) (*http.Cookie, error) {
 	expiration := time.Now().Add(365 * 24 * time.Hour)
 
 	urlParsed, err := url.Parse(BackendUrl)
@@ -40,8 +79,8 @@ func GetLoginTypeCookie(loginType string) (*http.Cookie, error) {
 	}
 
 	return &http.Cookie{
-		Name:    LoginTypeCookieName,
-		Value:   loginType,
+		Name:    cookieName,
+		Value:   value,
 		Expires: expiration,
 		// we send the cookie cross domain, so we need all this
 		Domain:   urlParsed.Host,
@@ -68,3 +107,14 @@ func GetDeletedCookie(cookieName string) (*http.Cookie, error) {
 		MaxAge: -1,
 	}, nil
 }
+
+// we form here the login url with the redirect uri
+func FormRedirectLoginUrl(redirectUrl string) string {
+	return fmt.Sprintf(
+		"%s?%s=%s",
+		loginUrl,
+		RedirectParam,
+		// create the uri by removing the frontend url
+		strings.ReplaceAll(redirectUrl, FrontendUrl, ""),
+	)
+}
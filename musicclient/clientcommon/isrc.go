@@ -1,11 +1,7 @@
 package clientcommon
 
-import "github.com/zmb3/spotify"
-
-func GetTrackISRC(track *spotify.FullTrack) (string, bool) {
+func GetTrackISRC(track *Track) (string, bool) {
 	// Unique id representing a track
 	// https://en.wikipedia.org/wiki/International_Standard_Recording_Code
-	trackId, ok := track.ExternalIDs["isrc"]
-
-	return trackId, ok
+	return track.Isrc, track.Isrc != ""
 }
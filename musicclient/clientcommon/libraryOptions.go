@@ -0,0 +1,122 @@
+package clientcommon
+
+import "strings"
+
+// What to fetch from the library of a user for a room
+type LibraryOptions struct {
+	Sources           LibrarySources
+	PlaylistSelection *PlaylistSelection // the playlists the user chose, nil if he did not choose any
+}
+
+// A playlist in the library of a user, created by him or by someone else
+type LibraryPlaylist struct {
+	Id            string `json:"id"`
+	Name          string `json:"name"`
+	Owned         bool   `json:"owned"`
+	Collaborative bool   `json:"collaborative"`
+	TrackCount    int    `json:"track_count,omitempty"` // 0 when the provider does not give it
+}
+
+// The playlists a user chose to include or exclude, whatever the sources of the room
+type PlaylistSelection struct {
+	IncludedIds []string `json:"included_ids"`
+	ExcludedIds []string `json:"excluded_ids"`
+}
+
+func CreateLibraryOptions(sources LibrarySources, playlistSelection *PlaylistSelection) *LibraryOptions {
+	return &LibraryOptions{sources.OrDefault(), playlistSelection}
+}
+
+// Returns if some playlists can be included, so we know if we need to get the playlists of the user
+func (options *LibraryOptions) IncludesPlaylists() bool {
+	return options.Sources.Includes(LibrarySourceOwnedPlaylists) ||
+		options.Sources.Includes(LibrarySourceFollowedPlaylists) ||
+		options.Sources.Includes(LibrarySourceCollaborativePlaylists) ||
+		(options.PlaylistSelection != nil && len(options.PlaylistSelection.IncludedIds) > 0)
+}
+
+// A playlist is included if its source is, unless the user chose otherwise
+func (options *LibraryOptions) IncludesPlaylist(playlist *LibraryPlaylist) bool {
+	// the playlists we created have the name credits, they would add the shared songs again
+	includedBySource := !strings.Contains(playlist.Name, NameCredits) &&
+		options.Sources.Includes(options.GetPlaylistSource(playlist))
+
+	if options.PlaylistSelection == nil {
+		return includedBySource
+	}
+
+	return options.PlaylistSelection.isIncluded(playlist.Id, includedBySource)
+}
+
+// A collaborative playlist comes from its own source when it is included, otherwise from the one of its owner
+func (options *LibraryOptions) GetPlaylistSource(playlist *LibraryPlaylist) string {
+	if playlist.Collaborative && options.Sources.Includes(LibrarySourceCollaborativePlaylists) {
+		return LibrarySourceCollaborativePlaylists
+	}
+
+	if playlist.Owned {
+		return LibrarySourceOwnedPlaylists
+	}
+
+	return LibrarySourceFollowedPlaylists
+}
+
+func (options *LibraryOptions) Equals(otherOptions *LibraryOptions) bool {
+	return options.Sources.Equals(otherOptions.Sources) &&
+		options.PlaylistSelection.Equals(otherOptions.PlaylistSelection)
+}
+
+func (selection *PlaylistSelection) isIncluded(playlistId string, includedByDefault bool) bool {
+	for _, id := range selection.ExcludedIds {
+		if id == playlistId {
+			return false
+		}
+	}
+
+	for _, id := range selection.IncludedIds {
+		if id == playlistId {
+			return true
+		}
+	}
+
+	return includedByDefault
+}
+
+// An empty selection is the same as no selection
+func (selection *PlaylistSelection) Equals(otherSelection *PlaylistSelection) bool {
+	if selection.isEmpty() || otherSelection.isEmpty() {
+		return selection.isEmpty() && otherSelection.isEmpty()
+	}
+
+	return haveSameIds(selection.IncludedIds, otherSelection.IncludedIds) &&
+		haveSameIds(selection.ExcludedIds, otherSelection.ExcludedIds)
+}
+
+func (selection *PlaylistSelection) isEmpty() bool {
+	return selection == nil || (len(selection.IncludedIds) == 0 && len(selection.ExcludedIds) == 0)
+}
+
+func haveSameIds(ids []string, otherIds []string) bool {
+	idSet := make(map[string]bool)
+	otherIdSet := make(map[string]bool)
+
+	for _, id := range ids {
+		idSet[id] = true
+	}
+
+	for _, id := range otherIds {
+		otherIdSet[id] = true
+	}
+
+	if len(idSet) != len(otherIdSet) {
+		return false
+	}
+
+	for id := range idSet {
+		if !otherIdSet[id] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,81 @@
+package clientcommon
+
+import "sort"
+
+// The parts of the library of a user that can be included in a room, each provider fetches the ones it supports
+const LibrarySourceLikedSongs = "liked_songs"
+const LibrarySourceOwnedPlaylists = "owned_playlists"
+const LibrarySourceFollowedPlaylists = "followed_playlists"
+const LibrarySourceCollaborativePlaylists = "collaborative_playlists"
+const LibrarySourceTopTracks = "top_tracks"
+const LibrarySourceRecentlyPlayed = "recently_played"
+
+var AllLibrarySources = LibrarySources{
+	LibrarySourceLikedSongs,
+	LibrarySourceOwnedPlaylists,
+	LibrarySourceFollowedPlaylists,
+	LibrarySourceCollaborativePlaylists,
+	LibrarySourceTopTracks,
+	LibrarySourceRecentlyPlayed,
+}
+
+// The liked songs and the playlists created by the user are included when no source is chosen
+var DefaultLibrarySources = LibrarySources{LibrarySourceLikedSongs, LibrarySourceOwnedPlaylists}
+
+type LibrarySources []string
+
+func IsLibrarySource(source string) bool {
+	return AllLibrarySources.Includes(source)
+}
+
+func (sources LibrarySources) OrDefault() LibrarySources {
+	if len(sources) == 0 {
+		return DefaultLibrarySources
+	}
+
+	return sources
+}
+
+func (sources LibrarySources) Includes(source string) bool {
+	for _, includedSource := range sources {
+		if includedSource == source {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Two lists of sources are the same if they include the same sources, whatever the order
+func (sources LibrarySources) Equals(otherSources LibrarySources) bool {
+	sortedSources := sources.sorted()
+	otherSortedSources := otherSources.sorted()
+
+	if len(sortedSources) != len(otherSortedSources) {
+		return false
+	}
+
+	for i := range sortedSources {
+		if sortedSources[i] != otherSortedSources[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (sources LibrarySources) sorted() []string {
+	sortedSources := make([]string, 0)
+	seen := make(map[string]bool)
+
+	for _, source := range sources.OrDefault() {
+		if !seen[source] {
+			sortedSources = append(sortedSources, source)
+			seen[source] = true
+		}
+	}
+
+	sort.Strings(sortedSources)
+
+	return sortedSources
+}
@@ -0,0 +1,31 @@
+package clientcommon
+
+// Steps reported while fetching the library of a user or converting tracks between providers
+const ProgressStepPageFetched = "page_fetched"
+const ProgressStepIsrcConverted = "isrc_converted"
+
+// Sources of the tracks of a user
+const SourceSavedSongs = "saved_songs"
+const SourcePlaylists = "playlists"
+const SourcePlaylistSongs = "playlist_songs"
+const SourceTopTracks = "top_tracks"
+const SourceRecentlyPlayed = "recently_played"
+const SourceCatalog = "catalog"
+
+type Progress struct {
+	Step   string `json:"step" bson:"step"`
+	Source string `json:"source,omitempty" bson:"source,omitempty"`
+	Done   int    `json:"done" bson:"done"`
+	Total  int    `json:"total,omitempty" bson:"total,omitempty"` // 0 when the total is not known
+}
+
+// Called by the providers as they make progress, it can be nil when nobody follows the progress
+type ProgressHook func(progress *Progress)
+
+func (hook ProgressHook) Report(step string, source string, done int, total int) {
+	if hook == nil {
+		return
+	}
+
+	hook(&Progress{step, source, done, total})
+}
@@ -0,0 +1,37 @@
+package clientcommon
+
+import (
+	"context"
+	"net/http"
+)
+
+// A music service a user can login with, such as spotify or apple music
+// Every provider is registered in musicclient, so the rest of the app does not need to know which one a user uses
+type MusicProvider interface {
+	// The login type of the provider, set in the login type cookie and on the user
+	LoginType() string
+	// The name of the provider used to tag metrics
+	MetricsName() string
+
+	// Path of the endpoint starting the login, empty if the login does not go through the backend
+	LoginPath() string
+	Login(w http.ResponseWriter, r *http.Request)
+	// Path of the endpoint the user is sent back to once logged in with the provider
+	CallbackPath() string
+	Callback(w http.ResponseWriter, r *http.Request)
+
+	// Tokens are encrypted as we store them in a cookie on the user side
+	EncryptToken(token interface{}) (string, error)
+	DecryptToken(tokenStr string) (interface{}, error)
+	// Creates the user with a client to access the provider, from an encrypted token
+	CreateUserFromToken(tokenStr string) (*User, error)
+
+	// Get all the songs in the library of the user included by the options, reporting the pages fetched and tracks
+	// converted on the way. The sources the provider does not support are skipped
+	GetAllSongs(user *User, options *LibraryOptions, progress ProgressHook) ([]*Track, error)
+	// Get the playlists in the library of the user, created by him or not
+	GetPlaylists(user *User) ([]*LibraryPlaylist, error)
+	// Create a playlist for the user with the tracks and return the link to it, with the tracks added as the ones the
+	// provider does not have are skipped
+	CreatePlaylist(user *User, playlistName string, tracks []*Track, ctx context.Context) (*string, []*Track, error)
+}
@@ -0,0 +1,40 @@
+package clientcommon
+
+import (
+	"github.com/shared-spotify/logger"
+	"sync"
+)
+
+// Called when the token of a user was refreshed by its provider, the user already has the new encrypted token
+// The hooks should read the token of the user when they save it, so a later refresh is never overridden
+type TokenRefreshHook func(user *User, oldToken string)
+
+var tokenRefreshHooksMutex sync.RWMutex
+var tokenRefreshHooks = make([]TokenRefreshHook, 0)
+
+func RegisterTokenRefreshHook(hook TokenRefreshHook) {
+	tokenRefreshHooksMutex.Lock()
+	defer tokenRefreshHooksMutex.Unlock()
+
+	tokenRefreshHooks = append(tokenRefreshHooks, hook)
+}
+
+// Providers call this once they have set the new token on the user
+// The hooks run in the background, as they save the token and the token can be refreshed in the middle of a request
+func NotifyTokenRefreshed(user *User, oldToken string) {
+	logger.WithUser(user.GetUserId()).Info("Token of user was refreshed")
+
+	// the old token can still be sent by the user until his cookie is updated, so we keep both in the cache
+	AddUserToCache(user.GetToken(), user)
+
+	go runTokenRefreshHooks(user, oldToken)
+}
+
+func runTokenRefreshHooks(user *User, oldToken string) {
+	tokenRefreshHooksMutex.RLock()
+	defer tokenRefreshHooksMutex.RUnlock()
+
+	for _, hook := range tokenRefreshHooks {
+		hook(user, oldToken)
+	}
+}
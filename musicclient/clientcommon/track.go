@@ -0,0 +1,183 @@
+package clientcommon
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// These are our own music objects, every music provider converts its objects to them so the rest of the app
+// never depends on the data model of a specific provider
+
+const releaseDateLayout = "2006-01-02"
+
+// The id of an object for each music provider it is available on, with key the provider login type
+type ProviderIds map[string]string
+
+func (ids ProviderIds) Get(loginType string) (string, bool) {
+	id, ok := ids[loginType]
+	return id, ok && id != ""
+}
+
+type Image struct {
+	Url    string `json:"url"`
+	Height int    `json:"height"`
+	Width  int    `json:"width"`
+}
+
+type Artist struct {
+	Name        string      `json:"name"`
+	Genres      []string    `json:"genres"`
+	ProviderIds ProviderIds `json:"provider_ids"`
+}
+
+type Album struct {
+	Name                 string      `json:"name"`
+	Images               []Image     `json:"images"`
+	ReleaseDate          string      `json:"release_date"`
+	ReleaseDatePrecision string      `json:"release_date_precision"` // year, month or day
+	ProviderIds          ProviderIds `json:"provider_ids"`
+}
+
+type Track struct {
+	// Unique id representing a track across all providers
+	// https://en.wikipedia.org/wiki/International_Standard_Recording_Code
+	Isrc        string      `json:"isrc"`
+	Name        string      `json:"name"`
+	Artists     []*Artist   `json:"artists"`
+	Album       *Album      `json:"album"`
+	Duration    int         `json:"duration_ms"`
+	Popularity  int         `json:"popularity"` // out of 100, 0 if the provider does not know it
+	Explicit    bool        `json:"explicit"`
+	PreviewUrl  string      `json:"preview_url"`
+	ProviderIds ProviderIds `json:"provider_ids"`
+	// The ids of the original track for each provider that relinked it to another version of the same recording
+	LinkedFrom ProviderIds `json:"linked_from"`
+	// The library source the track was fetched from for a user, it is not stored with the track as it depends on him
+	LibrarySource string `json:"-" bson:"-"`
+	// When the user added the track to this source, zero if the provider does not give it
+	AddedAt time.Time `json:"-" bson:"-"`
+}
+
+type AudioFeatures struct {
+	Acousticness     float32 `json:"acousticness"`
+	Danceability     float32 `json:"danceability"`
+	Energy           float32 `json:"energy"`
+	Instrumentalness float32 `json:"instrumentalness"`
+	Key              int     `json:"key"`
+	Liveness         float32 `json:"liveness"`
+	Loudness         float32 `json:"loudness"`
+	Mode             int     `json:"mode"`
+	Speechiness      float32 `json:"speechiness"`
+	Tempo            float32 `json:"tempo"`
+	TimeSignature    int     `json:"time_signature"`
+	Valence          float32 `json:"valence"`
+}
+
+func (track *Track) GetProviderId(loginType string) (string, bool) {
+	return track.ProviderIds.Get(loginType)
+}
+
+func (track *Track) SetProviderId(loginType string, id string) {
+	if track.ProviderIds == nil {
+		track.ProviderIds = make(ProviderIds)
+	}
+
+	track.ProviderIds[loginType] = id
+}
+
+func SetLibrarySource(tracks []*Track, source string) []*Track {
+	for _, track := range tracks {
+		track.LibrarySource = source
+	}
+
+	return tracks
+}
+
+// Merge the info found for the same track on another provider, so the track can be used on both providers
+// Info already known for the track is never overridden
+func (track *Track) Merge(otherTrack *Track) {
+	for loginType, id := range otherTrack.ProviderIds {
+		if _, ok := track.GetProviderId(loginType); !ok {
+			track.SetProviderId(loginType, id)
+		}
+	}
+
+	if track.Popularity == 0 {
+		track.Popularity = otherTrack.Popularity
+	}
+
+	if track.PreviewUrl == "" {
+		track.PreviewUrl = otherTrack.PreviewUrl
+	}
+
+	if track.Album == nil {
+		track.Album = otherTrack.Album
+
+	} else if otherTrack.Album != nil {
+		track.Album.merge(otherTrack.Album)
+	}
+
+	// artists are matched by name, as it is the only thing we can compare between providers
+	for _, otherArtist := range otherTrack.Artists {
+		for _, artist := range track.Artists {
+			if strings.EqualFold(artist.Name, otherArtist.Name) {
+				artist.merge(otherArtist)
+			}
+		}
+	}
+}
+
+func (album *Album) merge(otherAlbum *Album) {
+	for loginType, id := range otherAlbum.ProviderIds {
+		if _, ok := album.ProviderIds.Get(loginType); !ok {
+			if album.ProviderIds == nil {
+				album.ProviderIds = make(ProviderIds)
+			}
+			album.ProviderIds[loginType] = id
+		}
+	}
+
+	if len(album.Images) == 0 {
+		album.Images = otherAlbum.Images
+	}
+}
+
+func (artist *Artist) merge(otherArtist *Artist) {
+	for loginType, id := range otherArtist.ProviderIds {
+		if _, ok := artist.ProviderIds.Get(loginType); !ok {
+			if artist.ProviderIds == nil {
+				artist.ProviderIds = make(ProviderIds)
+			}
+			artist.ProviderIds[loginType] = id
+		}
+	}
+
+	if len(artist.Genres) == 0 {
+		artist.Genres = otherArtist.Genres
+	}
+}
+
+// All of the fields in the result may not be valid depending on the release date precision, for example if the
+// precision is "month", only the month and year of the result are valid
+func (album *Album) ReleaseDateTime() time.Time {
+	if album.ReleaseDatePrecision == "day" {
+		result, _ := time.Parse(releaseDateLayout, album.ReleaseDate)
+		return result
+	}
+
+	if album.ReleaseDatePrecision == "month" {
+		ym := strings.Split(album.ReleaseDate, "-")
+		year, _ := strconv.Atoi(ym[0])
+		month := 1
+
+		if len(ym) > 1 {
+			month, _ = strconv.Atoi(ym[1])
+		}
+
+		return time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	year, _ := strconv.Atoi(album.ReleaseDate)
+	return time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
+}
@@ -4,7 +4,9 @@ import (
 	"github.com/minchao/go-apple-music"
 	"github.com/patrickmn/go-cache"
 	"github.com/shared-spotify/logger"
+	"github.com/shared-spotify/musicclient/deezer/deezerapi"
 	"github.com/zmb3/spotify"
+	"sync"
 	"time"
 )
 
@@ -23,8 +25,11 @@ type User struct {
 	*UserInfos       `bson:"inline"`
 	SpotifyClient    *spotify.Client    `json:"-"` // we ignore this field
 	AppleMusicClient *applemusic.Client `json:"-"` // we ignore this field
+	DeezerClient     *deezerapi.Client  `json:"-"` // we ignore this field
 	LoginType        string             `json:"-" bson:"login_type"`
 	Token            string             `json:"-" bson:"token"`
+	// the token is refreshed by the client of the user while the user is shared through the cache
+	tokenMutex sync.RWMutex
 }
 
 func (user *User) GetId() string {
@@ -35,6 +40,24 @@ func (user *User) GetUserId() string {
 	return user.Name
 }
 
+func (user *User) GetToken() string {
+	user.tokenMutex.RLock()
+	defer user.tokenMutex.RUnlock()
+
+	return user.Token
+}
+
+// Returns the previous token of the user
+func (user *User) SetToken(token string) string {
+	user.tokenMutex.Lock()
+	defer user.tokenMutex.Unlock()
+
+	oldToken := user.Token
+	user.Token = token
+
+	return oldToken
+}
+
 func (user *User) IsEqual(otherUser *User) bool {
 	return otherUser.Id == user.Id
 }
@@ -51,6 +74,10 @@ func (user *User) IsAppleMusic() bool {
 	return user.LoginType == AppleMusicLoginType || user.AppleMusicClient != nil
 }
 
+func (user *User) IsDeezer() bool {
+	return user.LoginType == DeezerLoginType || user.DeezerClient != nil
+}
+
 /**
   User Cache
  */
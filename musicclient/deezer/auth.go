@@ -0,0 +1,276 @@
+package deezer
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/shared-spotify/datadog"
+	"github.com/shared-spotify/logger"
+	"github.com/shared-spotify/mongoclient"
+	"github.com/shared-spotify/musicclient/clientcommon"
+	"github.com/shared-spotify/musicclient/deezer/deezerapi"
+	"github.com/shared-spotify/utils"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultConnectUrl = "https://connect.deezer.com"
+
+// offline_access gives us a token that does not expire, manage_library allows us to create playlists and
+// listening_history to get the tracks the user listened to lately
+const permissions = "basic_access,email,offline_access,manage_library,listening_history"
+
+// Cache 1000 states max
+var states, _ = lru.New(1000)
+
+var AppId = os.Getenv("DEEZER_APP_ID")
+var SecretKey = os.Getenv("DEEZER_SECRET_KEY")
+
+// Can be changed to point to another server, for example a fake deezer server when developing locally
+var ConnectUrl = getConnectUrl()
+
+var CallbackUrl = fmt.Sprintf("%s/callback/deezer", clientcommon.BackendUrl)
+
+func getConnectUrl() string {
+	if connectUrl := os.Getenv("DEEZER_CONNECT_URL"); connectUrl != "" {
+		return strings.TrimSuffix(connectUrl, "/")
+	}
+
+	return defaultConnectUrl
+}
+
+type DeezerLogin struct {
+	AccessToken string `json:"access_token"`
+	Expires     int    `json:"expires"` // 0 when the token never expires
+}
+
+func Authenticate(w http.ResponseWriter, r *http.Request) {
+	logger.Logger.Info("Headers for request to authenticate with deezer are ", r.Header)
+	datadog.Increment(1, datadog.UserLoginStarted, datadog.Provider.Tag(datadog.DeezerProvider))
+
+	// We extract the redirect_uri if it exists, to redirect to it once the auth is finished
+	redirectUri := r.URL.Query().Get(clientcommon.RedirectParam)
+	redirect := clientcommon.FrontendUrl
+
+	if redirectUri != "" {
+		redirect = clientcommon.FrontendUrl + redirectUri
+	}
+
+	logger.Logger.Info("Redirect Url for deezer user after auth will be: ", redirect)
+
+	// we generate a random state and remember the redirect url so we use it once we are redirected
+	randomState := utils.GenerateStrongHash()
+	states.Add(randomState, redirect)
+
+	params := url.Values{
+		"app_id":       {AppId},
+		"redirect_uri": {CallbackUrl},
+		"perms":        {permissions},
+		"state":        {randomState},
+	}
+	authUrl := fmt.Sprintf("%s/oauth/auth.php?%s", ConnectUrl, params.Encode())
+
+	logger.Logger.Info("Url to login with deezer is: ", authUrl)
+	clientcommon.SendRequestMetric(datadog.DeezerProvider, datadog.RequestTypeAuth, false, nil)
+
+	http.Redirect(w, r, authUrl, http.StatusFound)
+}
+
+// the user will eventually be redirected back to the callback url
+func CallbackHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Logger.Info("Headers for request to deezer callback are ", r.Header)
+
+	st := r.FormValue("state")
+	var redirectUrl, ok = states.Get(st)
+
+	// check state exists to prevent csrf attacks
+	if !ok {
+		logger.Logger.Errorf("Deezer state not found found=%s - redirecting user back to login page", st)
+		http.NotFound(w, r)
+		return
+	}
+
+	// form the url in case we fail to auth and need to redirect the user again to the login page
+	loginRedirectUrl := clientcommon.FormRedirectLoginUrl(redirectUrl.(string))
+
+	// deezer sends back an error reason instead of the code if the user refused access
+	code := r.FormValue("code")
+
+	if code == "" {
+		logger.Logger.Errorf("No deezer code received, error_reason=%s - redirecting user back to login page",
+			r.FormValue("error_reason"))
+		http.Redirect(w, r, loginRedirectUrl, http.StatusFound)
+		return
+	}
+
+	deezerLogin, err := getAccessToken(code)
+
+	if err != nil {
+		logger.Logger.
+			WithError(err).
+			Error("Couldn't get deezer token - redirecting user back to login page")
+		http.Redirect(w, r, loginRedirectUrl, http.StatusFound)
+		return
+	}
+
+	// we delete the state entry
+	states.Remove(st)
+
+	// Add the token as an encrypted cookie
+	encryptedToken, err := EncryptToken(deezerLogin)
+	if err != nil {
+		logger.Logger.
+			WithError(err).
+			Errorf("Failed to encrypt deezer token - redirecting user back to login page")
+		http.Redirect(w, r, loginRedirectUrl, http.StatusFound)
+		return
+	}
+	cookie, err := clientcommon.GetTokenCookie(encryptedToken)
+	if err != nil {
+		logger.Logger.
+			WithError(err).
+			Errorf("Failed to set token - redirecting user back to login page")
+		http.Redirect(w, r, loginRedirectUrl, http.StatusFound)
+		return
+	}
+	http.SetCookie(w, cookie)
+
+	// Add the login type cookie name
+	loginTypeCookie, err := clientcommon.GetLoginTypeCookie(clientcommon.DeezerLoginType)
+	if err != nil {
+		logger.Logger.
+			WithError(err).
+			Errorf("Failed to set loginType - redirecting user back to login page")
+		http.Redirect(w, r, loginRedirectUrl, http.StatusFound)
+		return
+	}
+	http.SetCookie(w, loginTypeCookie)
+
+	// Add the users to the database if we can, but don't fail as we will add him otherwise at another time
+	// for example when the room is processed
+	user, err := CreateUserFromToken(deezerLogin, encryptedToken)
+	if err == nil {
+		_ = mongoclient.InsertUsers([]*clientcommon.User{user})
+	}
+
+	logger.Logger.Info("Redirecting to ", redirectUrl)
+	datadog.Increment(1, datadog.UserLoginSuccess, datadog.Provider.Tag(datadog.DeezerProvider))
+
+	http.Redirect(w, r, redirectUrl.(string), http.StatusFound)
+}
+
+// Exchange the code received in the callback for an access token
+func getAccessToken(code string) (*DeezerLogin, error) {
+	params := url.Values{
+		"app_id": {AppId},
+		"secret": {SecretKey},
+		"code":   {code},
+		"output": {"json"},
+	}
+	tokenUrl := fmt.Sprintf("%s/oauth/access_token.php?%s", ConnectUrl, params.Encode())
+
+	client := &http.Client{Timeout: time.Second * ClientTimeout}
+	response, err := client.Get(tokenUrl)
+
+	clientcommon.SendRequestMetric(datadog.DeezerProvider, datadog.RequestTypeAuth, false, err)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer response.Body.Close()
+
+	var deezerLogin DeezerLogin
+	// deezer answers with plain text such as "wrong code" when the code is invalid
+	err = json.NewDecoder(response.Body).Decode(&deezerLogin)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if deezerLogin.AccessToken == "" {
+		return nil, errors.New("no access token received from deezer")
+	}
+
+	return &deezerLogin, nil
+}
+
+func CreateUserFromToken(deezerLogin *DeezerLogin, tokenStr string) (*clientcommon.User, error) {
+	httpClient := &http.Client{Timeout: time.Second * ClientTimeout}
+	client := deezerapi.NewClient(httpClient, deezerLogin.AccessToken)
+
+	deezerUser, err := client.GetCurrentUser()
+
+	clientcommon.SendRequestMetric(datadog.DeezerProvider, datadog.RequestTypeUserInfo, true, err)
+
+	if err != nil {
+		logger.Logger.Warning("Failed to create deezer user from token ", err)
+		return nil, err
+	}
+
+	userInfos := clientcommon.UserInfos{
+		Id:       strconv.Itoa(deezerUser.Id),
+		Name:     deezerUser.Name,
+		ImageUrl: deezerUser.Picture,
+		Email:    deezerUser.Email,
+		JoinDate: time.Now(),
+	}
+
+	return &clientcommon.User{
+		UserInfos:    &userInfos,
+		DeezerClient: client,
+		LoginType:    clientcommon.DeezerLoginType,
+		Token:        tokenStr,
+	}, nil
+}
+
+func EncryptToken(deezerLogin *DeezerLogin) (string, error) {
+	jsonToken, err := json.Marshal(*deezerLogin)
+
+	if err != nil {
+		logger.Logger.Error("Failed to serialise json deezer token")
+		return "", err
+	}
+
+	encryptedToken, err := clientcommon.TokenKeyring.Encrypt(jsonToken)
+
+	if err != nil {
+		logger.Logger.Error("Failed to encrypt deezer token ", err)
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(encryptedToken), nil
+}
+
+func DecryptToken(tokenStr string) (*DeezerLogin, error) {
+	var deezerLogin DeezerLogin
+
+	base64JsonToken, err := base64.StdEncoding.DecodeString(tokenStr)
+
+	if err != nil {
+		logger.Logger.Error("Failed to decode base64 deezer token ", err)
+		return nil, err
+	}
+
+	decryptedToken, err := clientcommon.TokenKeyring.Decrypt(base64JsonToken)
+
+	if err != nil {
+		logger.Logger.Error("Failed to decrypt deezer token ", err)
+		return nil, err
+	}
+
+	err = json.Unmarshal(decryptedToken, &deezerLogin)
+
+	if err != nil {
+		logger.Logger.Error("Failed to deserialise json deezer token ", err)
+		return nil, err
+	}
+
+	return &deezerLogin, nil
+}
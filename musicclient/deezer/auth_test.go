@@ -0,0 +1,70 @@
+package deezer
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestGetAccessToken(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/access_token.php", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		if query.Get("app_id") != AppId || query.Get("secret") != SecretKey || query.Get("output") != "json" {
+			t.Errorf("Unexpected access token request %s", r.URL)
+		}
+
+		// deezer answers with plain text when the code is invalid
+		if query.Get("code") != "valid-code" {
+			fmt.Fprint(w, "wrong code")
+			return
+		}
+
+		writeJson(t, w, DeezerLogin{AccessToken: fakeAccessToken, Expires: 0})
+	})
+	newFakeDeezer(t, mux)
+
+	tests := []struct {
+		name        string
+		code        string
+		accessToken string
+		expectError bool
+	}{
+		{"valid code", "valid-code", fakeAccessToken, false},
+		{"wrong code", "wrong-code", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			deezerLogin, err := getAccessToken(test.code)
+
+			if test.expectError {
+				if err == nil {
+					t.Fatalf("Expected an error, got login %+v", deezerLogin)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+
+			if deezerLogin.AccessToken != test.accessToken || deezerLogin.Expires != 0 {
+				t.Errorf("Unexpected login %+v", deezerLogin)
+			}
+		})
+	}
+}
+
+func TestGetAccessTokenWithoutToken(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/access_token.php", func(w http.ResponseWriter, r *http.Request) {
+		writeJson(t, w, DeezerLogin{})
+	})
+	newFakeDeezer(t, mux)
+
+	if _, err := getAccessToken("valid-code"); err == nil {
+		t.Fatal("Expected an error when deezer sends back no access token")
+	}
+}
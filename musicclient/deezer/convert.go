@@ -0,0 +1,86 @@
+package deezer
+
+import (
+	"github.com/shared-spotify/musicclient/clientcommon"
+	"github.com/shared-spotify/musicclient/deezer/deezerapi"
+	"strconv"
+)
+
+// Conversion of the deezer objects to our own music objects
+
+const coverXlSize = 1000
+const coverMediumSize = 250
+
+func ToTrack(track *deezerapi.Track) *clientcommon.Track {
+	artists := make([]*clientcommon.Artist, 0)
+
+	// the contributors are only available on the full track, and contain the main artist
+	deezerArtists := track.Contributors
+	if len(deezerArtists) == 0 {
+		deezerArtists = []deezerapi.Artist{track.Artist}
+	}
+
+	for _, artist := range deezerArtists {
+		artists = append(artists, &clientcommon.Artist{
+			Name:        artist.Name,
+			ProviderIds: clientcommon.ProviderIds{clientcommon.DeezerLoginType: strconv.Itoa(artist.Id)},
+		})
+	}
+
+	images := make([]clientcommon.Image, 0)
+
+	if track.Album.CoverXl != "" {
+		images = append(images, clientcommon.Image{Url: track.Album.CoverXl, Height: coverXlSize, Width: coverXlSize})
+	}
+
+	if track.Album.CoverMedium != "" {
+		images = append(images, clientcommon.Image{Url: track.Album.CoverMedium, Height: coverMediumSize,
+			Width: coverMediumSize})
+	}
+
+	// the release date of the track is in the format 2006-01-02
+	releaseDate := track.ReleaseDate
+	if releaseDate == "" {
+		releaseDate = track.Album.ReleaseDate
+	}
+
+	album := &clientcommon.Album{
+		Name:                 track.Album.Title,
+		Images:               images,
+		ReleaseDate:          releaseDate,
+		ReleaseDatePrecision: "day",
+		ProviderIds:          clientcommon.ProviderIds{clientcommon.DeezerLoginType: strconv.Itoa(track.Album.Id)},
+	}
+
+	return &clientcommon.Track{
+		Isrc:        track.Isrc,
+		Name:        track.Title,
+		Artists:     artists,
+		Album:       album,
+		Duration:    track.Duration * 1000,
+		Explicit:    track.ExplicitLyrics,
+		PreviewUrl:  track.Preview,
+		ProviderIds: clientcommon.ProviderIds{clientcommon.DeezerLoginType: strconv.Itoa(track.Id)},
+	}
+}
+
+func ToTracks(tracks []*deezerapi.Track) []*clientcommon.Track {
+	convertedTracks := make([]*clientcommon.Track, 0)
+
+	for _, track := range tracks {
+		convertedTracks = append(convertedTracks, ToTrack(track))
+	}
+
+	return convertedTracks
+}
+
+// The playlist was created by someone else if it was just "liked" by the user
+func toLibraryPlaylist(playlist *deezerapi.Playlist, user *clientcommon.User) *clientcommon.LibraryPlaylist {
+	return &clientcommon.LibraryPlaylist{
+		Id:            strconv.Itoa(playlist.Id),
+		Name:          playlist.Title,
+		Owned:         strconv.Itoa(playlist.Creator.Id) == user.GetId(),
+		Collaborative: playlist.Collaborative,
+		TrackCount:    playlist.TrackCount,
+	}
+}
@@ -0,0 +1,363 @@
+package deezerapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/shared-spotify/logger"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Minimal client for the deezer api, see https://developers.deezer.com/api
+// The base url can be changed to point to another server, for example a fake deezer server when developing locally
+
+const defaultApiUrl = "https://api.deezer.com"
+const accessTokenParam = "access_token"
+const maxPerPage = 100
+
+// Deezer allows 50 requests every 5 seconds, so we wait when the quota is exceeded
+const maxRetryQuotaExceeded = 5
+const waitQuotaExceeded = 5 * time.Second
+
+// Error codes sent back by deezer, https://developers.deezer.com/api/errors
+const QuotaExceededErrorCode = 4
+const DataNotFoundErrorCode = 800
+
+var ApiUrl = getApiUrl()
+
+func getApiUrl() string {
+	if apiUrl := os.Getenv("DEEZER_API_URL"); apiUrl != "" {
+		return strings.TrimSuffix(apiUrl, "/")
+	}
+
+	return defaultApiUrl
+}
+
+type Client struct {
+	httpClient  *http.Client
+	accessToken string
+}
+
+func NewClient(httpClient *http.Client, accessToken string) *Client {
+	return &Client{httpClient, accessToken}
+}
+
+// Deezer sends back errors with a 200 status code, with the error in the body
+type Error struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+	Code    int    `json:"code"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("deezer error type=%s code=%d: %s", e.Type, e.Code, e.Message)
+}
+
+func IsNotFound(err error) bool {
+	deezerErr, ok := err.(*Error)
+	return ok && deezerErr.Code == DataNotFoundErrorCode
+}
+
+type errorResponse struct {
+	Error *Error `json:"error"`
+}
+
+type page struct {
+	Data  json.RawMessage `json:"data"`
+	Total int             `json:"total"`
+	Next  string          `json:"next"`
+}
+
+type User struct {
+	Id      int    `json:"id"`
+	Name    string `json:"name"`
+	Email   string `json:"email"`
+	Picture string `json:"picture_medium"`
+}
+
+type Artist struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type Album struct {
+	Id          int    `json:"id"`
+	Title       string `json:"title"`
+	CoverMedium string `json:"cover_medium"`
+	CoverXl     string `json:"cover_xl"`
+	ReleaseDate string `json:"release_date"`
+}
+
+type Track struct {
+	Id             int      `json:"id"`
+	Readable       bool     `json:"readable"`
+	Title          string   `json:"title"`
+	Isrc           string   `json:"isrc"`
+	Duration       int      `json:"duration"` // in seconds
+	Rank           int      `json:"rank"`
+	ExplicitLyrics bool     `json:"explicit_lyrics"`
+	Preview        string   `json:"preview"`
+	ReleaseDate    string   `json:"release_date"`
+	Artist         Artist   `json:"artist"`
+	Contributors   []Artist `json:"contributors"`
+	Album          Album    `json:"album"`
+	TimeAdd        int64    `json:"time_add"` // unix time the user added the track, only in the lists of the user
+}
+
+type Playlist struct {
+	Id            int    `json:"id"`
+	Title         string `json:"title"`
+	Link          string `json:"link"`
+	TrackCount    int    `json:"nb_tracks"`
+	Collaborative bool   `json:"collaborative"`
+	Creator       User   `json:"creator"`
+}
+
+type created struct {
+	Id int `json:"id"`
+}
+
+func (c *Client) GetCurrentUser() (*User, error) {
+	var user User
+	err := c.get("/user/me", nil, &user)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// The tracks the user added to his favourites
+func (c *Client) GetFavouriteTracks() ([]*Track, error) {
+	tracks := make([]*Track, 0)
+
+	err := c.getAllPages("/user/me/tracks", func(data json.RawMessage) error {
+		var pageTracks []*Track
+		err := json.Unmarshal(data, &pageTracks)
+		tracks = append(tracks, pageTracks...)
+		return err
+	})
+
+	return tracks, err
+}
+
+// The tracks the user listened to the most recently
+func (c *Client) GetTopTracks() ([]*Track, error) {
+	tracks := make([]*Track, 0)
+
+	err := c.getAllPages("/user/me/charts/tracks", func(data json.RawMessage) error {
+		var pageTracks []*Track
+		err := json.Unmarshal(data, &pageTracks)
+		tracks = append(tracks, pageTracks...)
+		return err
+	})
+
+	return tracks, err
+}
+
+// The tracks the user listened to lately, this needs the listening_history permission
+func (c *Client) GetHistoryTracks() ([]*Track, error) {
+	tracks := make([]*Track, 0)
+
+	err := c.getAllPages("/user/me/history", func(data json.RawMessage) error {
+		var pageTracks []*Track
+		err := json.Unmarshal(data, &pageTracks)
+		tracks = append(tracks, pageTracks...)
+		return err
+	})
+
+	return tracks, err
+}
+
+func (c *Client) GetPlaylists() ([]*Playlist, error) {
+	playlists := make([]*Playlist, 0)
+
+	err := c.getAllPages("/user/me/playlists", func(data json.RawMessage) error {
+		var pagePlaylists []*Playlist
+		err := json.Unmarshal(data, &pagePlaylists)
+		playlists = append(playlists, pagePlaylists...)
+		return err
+	})
+
+	return playlists, err
+}
+
+func (c *Client) GetPlaylistTracks(playlistId int) ([]*Track, error) {
+	tracks := make([]*Track, 0)
+
+	err := c.getAllPages(fmt.Sprintf("/playlist/%d/tracks", playlistId), func(data json.RawMessage) error {
+		var pageTracks []*Track
+		err := json.Unmarshal(data, &pageTracks)
+		tracks = append(tracks, pageTracks...)
+		return err
+	})
+
+	return tracks, err
+}
+
+// Tracks in lists do not contain the isrc, only the full track does
+func (c *Client) GetTrack(trackId int) (*Track, error) {
+	var track Track
+	err := c.get(fmt.Sprintf("/track/%d", trackId), nil, &track)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &track, nil
+}
+
+func (c *Client) GetTrackByIsrc(isrc string) (*Track, error) {
+	var track Track
+	err := c.get("/track/isrc:"+url.PathEscape(isrc), nil, &track)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &track, nil
+}
+
+// Creates a playlist for the current user and returns its id
+func (c *Client) CreatePlaylist(title string) (int, error) {
+	var playlist created
+	err := c.post("/user/me/playlists", url.Values{"title": {title}}, &playlist)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return playlist.Id, nil
+}
+
+func (c *Client) AddTracksToPlaylist(playlistId int, trackIds []int) error {
+	songs := make([]string, 0, len(trackIds))
+
+	for _, trackId := range trackIds {
+		songs = append(songs, strconv.Itoa(trackId))
+	}
+
+	var success bool
+	return c.post(fmt.Sprintf("/playlist/%d/tracks", playlistId), url.Values{"songs": {strings.Join(songs, ",")}},
+		&success)
+}
+
+func (c *Client) getAllPages(path string, handlePage func(data json.RawMessage) error) error {
+	params := url.Values{"limit": {strconv.Itoa(maxPerPage)}}
+	requestUrl := c.formUrl(path, params)
+
+	for requestUrl != "" {
+		var result page
+		err := c.do(http.MethodGet, requestUrl, &result)
+
+		if err != nil {
+			return err
+		}
+
+		err = handlePage(result.Data)
+
+		if err != nil {
+			return err
+		}
+
+		requestUrl = c.withAccessToken(result.Next)
+	}
+
+	return nil
+}
+
+func (c *Client) get(path string, params url.Values, result interface{}) error {
+	return c.do(http.MethodGet, c.formUrl(path, params), result)
+}
+
+func (c *Client) post(path string, params url.Values, result interface{}) error {
+	return c.do(http.MethodPost, c.formUrl(path, params), result)
+}
+
+func (c *Client) formUrl(path string, params url.Values) string {
+	if params == nil {
+		params = url.Values{}
+	}
+
+	params.Set(accessTokenParam, c.accessToken)
+
+	return fmt.Sprintf("%s%s?%s", ApiUrl, path, params.Encode())
+}
+
+// the next urls sent back by deezer do not always contain the access token
+func (c *Client) withAccessToken(requestUrl string) string {
+	if requestUrl == "" {
+		return ""
+	}
+
+	parsedUrl, err := url.Parse(requestUrl)
+
+	if err != nil {
+		logger.Logger.Errorf("Failed to parse deezer next url %s %v", requestUrl, err)
+		return ""
+	}
+
+	query := parsedUrl.Query()
+	query.Set(accessTokenParam, c.accessToken)
+	parsedUrl.RawQuery = query.Encode()
+
+	return parsedUrl.String()
+}
+
+func (c *Client) do(method string, requestUrl string, result interface{}) error {
+	var err error
+
+	for retry := 0; retry <= maxRetryQuotaExceeded; retry++ {
+		err = c.doOnce(method, requestUrl, result)
+
+		if deezerErr, ok := err.(*Error); !ok || deezerErr.Code != QuotaExceededErrorCode {
+			return err
+		}
+
+		logger.Logger.Warningf("Deezer quota exceeded, waiting before retrying - retry count=%d", retry)
+		time.Sleep(waitQuotaExceeded)
+	}
+
+	return err
+}
+
+func (c *Client) doOnce(method string, requestUrl string, result interface{}) error {
+	request, err := http.NewRequest(method, requestUrl, nil)
+
+	if err != nil {
+		return err
+	}
+
+	response, err := c.httpClient.Do(request)
+
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("deezer request failed with status %d: %s", response.StatusCode, string(body))
+	}
+
+	var errResponse errorResponse
+
+	// the body is not always an object, for example when adding tracks to a playlist it is a boolean
+	if json.Unmarshal(body, &errResponse) == nil && errResponse.Error != nil {
+		return errResponse.Error
+	}
+
+	return json.Unmarshal(body, result)
+}
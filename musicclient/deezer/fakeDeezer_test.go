@@ -0,0 +1,66 @@
+package deezer
+
+import (
+	"encoding/json"
+	"github.com/shared-spotify/musicclient/clientcommon"
+	"github.com/shared-spotify/musicclient/deezer/deezerapi"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const fakeAccessToken = "fake-access-token"
+
+// A local fake deezer server, the api and the connect urls both point to it for the duration of the test
+func newFakeDeezer(t *testing.T, mux *http.ServeMux) *httptest.Server {
+	server := httptest.NewServer(mux)
+
+	apiUrl := deezerapi.ApiUrl
+	connectUrl := ConnectUrl
+
+	deezerapi.ApiUrl = server.URL
+	ConnectUrl = server.URL
+
+	t.Cleanup(func() {
+		deezerapi.ApiUrl = apiUrl
+		ConnectUrl = connectUrl
+		server.Close()
+	})
+
+	return server
+}
+
+func newFakeDeezerUser(server *httptest.Server) *clientcommon.User {
+	return &clientcommon.User{
+		UserInfos:    &clientcommon.UserInfos{Id: "1", Name: "fake user"},
+		DeezerClient: deezerapi.NewClient(server.Client(), fakeAccessToken),
+		LoginType:    clientcommon.DeezerLoginType,
+	}
+}
+
+// Every request to the api needs the access token, deezer answers with an error in the body otherwise
+func handleDeezerApi(t *testing.T, handler func(w http.ResponseWriter, r *http.Request) interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("access_token") != fakeAccessToken {
+			t.Errorf("Request %s %s was sent without the access token", r.Method, r.URL)
+			writeJson(t, w, map[string]interface{}{"error": deezerapi.Error{Type: "OAuthException", Code: 300}})
+			return
+		}
+
+		writeJson(t, w, handler(w, r))
+	}
+}
+
+func writeJson(t *testing.T, w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		t.Errorf("Failed to write fake deezer response %v", err)
+	}
+}
+
+func notFound() interface{} {
+	return map[string]interface{}{
+		"error": deezerapi.Error{Type: "DataException", Message: "no data", Code: deezerapi.DataNotFoundErrorCode},
+	}
+}
@@ -0,0 +1,3 @@
+package deezer
+
+const ClientTimeout = 15 // 15s
@@ -0,0 +1,130 @@
+package deezer
+
+import (
+	"context"
+	"fmt"
+	"github.com/shared-spotify/datadog"
+	"github.com/shared-spotify/logger"
+	"github.com/shared-spotify/musicclient/clientcommon"
+	"github.com/shared-spotify/musicclient/deezer/deezerapi"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"strconv"
+)
+
+const maxTrackPerPlaylistAddCall = 100
+const playlistUrl = "https://www.deezer.com/playlist/%d"
+
+func CreatePlaylist(user *clientcommon.User, playlistName string, tracks []*clientcommon.Track,
+	ctx context.Context) (*string, []*clientcommon.Track, error) {
+	rootSpan, rootCtx := tracer.StartSpanFromContext(ctx, "playlist.create.deezer")
+	defer rootSpan.Finish()
+
+	client := user.DeezerClient
+
+	// we find the deezer version of the tracks coming from other providers using their isrc
+	span, _ := tracer.StartSpanFromContext(rootCtx, "playlist.create.deezer.convert")
+	trackIds := make([]int, 0)
+	addedTracks := make([]*clientcommon.Track, 0)
+
+	for _, track := range tracks {
+		trackId, err := getDeezerTrackId(user, track)
+
+		if err != nil {
+			span.Finish(tracer.WithError(err))
+			logger.
+				WithUser(user.GetUserId()).
+				WithError(err).
+				Errorf("Failed to get deezer track to add to playlist %v", span)
+			return nil, nil, err
+		}
+
+		if trackId != 0 {
+			trackIds = append(trackIds, trackId)
+			addedTracks = append(addedTracks, track)
+		}
+	}
+	span.Finish()
+
+	span, _ = tracer.StartSpanFromContext(rootCtx, "playlist.create.deezer.empty")
+
+	playlistId, err := client.CreatePlaylist(playlistName)
+
+	clientcommon.SendRequestMetric(datadog.DeezerProvider, datadog.RequestTypePlaylistCreated, true, err)
+
+	if err != nil {
+		logger.
+			WithUser(user.GetUserId()).
+			WithError(err).
+			Errorf("Failed to create deezer playlist %v", span)
+		span.Finish(tracer.WithError(err))
+		return nil, nil, err
+	}
+
+	logger.WithUser(user.GetUserId()).Infof("Playlist '%s' successfully created for user %v", playlistName, span)
+	span.Finish()
+
+	// we add the tracks
+	span, _ = tracer.StartSpanFromContext(rootCtx, "playlist.create.deezer.add.tracks")
+
+	for i := 0; i < len(trackIds); i += maxTrackPerPlaylistAddCall {
+		upperBound := i + maxTrackPerPlaylistAddCall
+
+		if upperBound > len(trackIds) {
+			upperBound = len(trackIds)
+		}
+
+		err := client.AddTracksToPlaylist(playlistId, trackIds[i:upperBound])
+
+		clientcommon.SendRequestMetric(datadog.DeezerProvider, datadog.RequestTypePlaylistSongsAdded, true, err)
+
+		if err != nil {
+			logger.
+				WithUser(user.GetUserId()).
+				WithError(err).
+				Errorf("Failed to add songs to deezer playlist %s %v", playlistName, span)
+			span.Finish(tracer.WithError(err))
+			return nil, nil, err
+		}
+	}
+
+	logger.
+		WithUser(user.GetUserId()).
+		Infof("Added %d tracks to deezer playlist %s for user %v", len(trackIds), playlistName, span)
+	span.Finish()
+
+	externalLink := fmt.Sprintf(playlistUrl, playlistId)
+
+	return &externalLink, addedTracks, nil
+}
+
+// returns 0 if the track does not exist on deezer
+func getDeezerTrackId(user *clientcommon.User, track *clientcommon.Track) (int, error) {
+	if id, ok := track.GetProviderId(clientcommon.DeezerLoginType); ok {
+		return strconv.Atoi(id)
+	}
+
+	isrc, ok := clientcommon.GetTrackISRC(track)
+
+	if !ok {
+		return 0, nil
+	}
+
+	deezerTrack, err := user.DeezerClient.GetTrackByIsrc(isrc)
+
+	if deezerapi.IsNotFound(err) {
+		clientcommon.SendRequestMetric(datadog.DeezerProvider, datadog.RequestTypeSearch, true, nil)
+		logger.WithUser(user.GetUserId()).Debugf("No deezer track found for isrc %s", isrc)
+		return 0, nil
+	}
+
+	clientcommon.SendRequestMetric(datadog.DeezerProvider, datadog.RequestTypeSearch, true, err)
+
+	if err != nil {
+		return 0, err
+	}
+
+	// remember the id in case the track is used again
+	track.SetProviderId(clientcommon.DeezerLoginType, strconv.Itoa(deezerTrack.Id))
+
+	return deezerTrack.Id, nil
+}
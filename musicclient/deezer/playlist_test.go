@@ -0,0 +1,110 @@
+package deezer
+
+import (
+	"context"
+	"github.com/shared-spotify/musicclient/clientcommon"
+	"github.com/shared-spotify/musicclient/deezer/deezerapi"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCreatePlaylist(t *testing.T) {
+	playlistTitle := ""
+	addedSongs := make([]string, 0)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/user/me/playlists", handleDeezerApi(t, func(w http.ResponseWriter, r *http.Request) interface{} {
+		if r.Method != http.MethodPost {
+			t.Errorf("Expected the playlist to be created with a post, got %s", r.Method)
+		}
+
+		playlistTitle = r.URL.Query().Get("title")
+		return map[string]int{"id": 42}
+	}))
+	mux.HandleFunc("/playlist/42/tracks", handleDeezerApi(t, func(w http.ResponseWriter, r *http.Request) interface{} {
+		addedSongs = append(addedSongs, r.URL.Query().Get("songs"))
+		return true
+	}))
+	// the tracks coming from other providers are found with their isrc
+	mux.HandleFunc("/track/", handleDeezerApi(t, func(w http.ResponseWriter, r *http.Request) interface{} {
+		if r.URL.Path == "/track/isrc:ISRC2" {
+			return deezerapi.Track{Id: 2, Isrc: "ISRC2"}
+		}
+
+		return notFound()
+	}))
+	fakeDeezer := newFakeDeezer(t, mux)
+
+	tracks := []*clientcommon.Track{
+		{Isrc: "ISRC1", ProviderIds: clientcommon.ProviderIds{clientcommon.DeezerLoginType: "1"}},
+		{Isrc: "ISRC2", ProviderIds: clientcommon.ProviderIds{clientcommon.SpotifyLoginType: "spotify2"}},
+		{Isrc: "ISRC3", ProviderIds: clientcommon.ProviderIds{clientcommon.SpotifyLoginType: "spotify3"}},
+	}
+
+	playlistUrl, addedTracks, err := CreatePlaylist(newFakeDeezerUser(fakeDeezer), "Room - Playlist", tracks,
+		context.Background())
+
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if *playlistUrl != "https://www.deezer.com/playlist/42" {
+		t.Errorf("Unexpected playlist url %s", *playlistUrl)
+	}
+
+	if playlistTitle != "Room - Playlist" {
+		t.Errorf("Unexpected playlist title %s", playlistTitle)
+	}
+
+	// the track not found on deezer is skipped
+	if strings.Join(addedSongs, "|") != "1,2" {
+		t.Errorf("Expected the songs 1,2 to be added in a single call, got %v", addedSongs)
+	}
+
+	if len(addedTracks) != 2 || addedTracks[0] != tracks[0] || addedTracks[1] != tracks[1] {
+		t.Errorf("Expected the first 2 tracks to be returned as added, got %v", addedTracks)
+	}
+
+	if id, _ := tracks[1].GetProviderId(clientcommon.DeezerLoginType); id != "2" {
+		t.Errorf("Expected the deezer id to be remembered on the track, got %s", id)
+	}
+}
+
+func TestCreatePlaylistAddsTracksInBatches(t *testing.T) {
+	addCallCount := 0
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/user/me/playlists", handleDeezerApi(t, func(w http.ResponseWriter, r *http.Request) interface{} {
+		return map[string]int{"id": 42}
+	}))
+	mux.HandleFunc("/playlist/42/tracks", handleDeezerApi(t, func(w http.ResponseWriter, r *http.Request) interface{} {
+		addCallCount += 1
+
+		if songCount := len(strings.Split(r.URL.Query().Get("songs"), ",")); songCount > maxTrackPerPlaylistAddCall {
+			t.Errorf("Expected at most %d songs per call, got %d", maxTrackPerPlaylistAddCall, songCount)
+		}
+
+		return true
+	}))
+	fakeDeezer := newFakeDeezer(t, mux)
+
+	tracks := make([]*clientcommon.Track, 0)
+
+	for i := 1; i <= 2*maxTrackPerPlaylistAddCall+1; i++ {
+		track := &clientcommon.Track{}
+		track.SetProviderId(clientcommon.DeezerLoginType, strconv.Itoa(i))
+		tracks = append(tracks, track)
+	}
+
+	_, _, err := CreatePlaylist(newFakeDeezerUser(fakeDeezer), "Room - Playlist", tracks, context.Background())
+
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if addCallCount != 3 {
+		t.Errorf("Expected 3 calls to add the tracks, got %d", addCallCount)
+	}
+}
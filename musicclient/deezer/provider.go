@@ -0,0 +1,86 @@
+package deezer
+
+import (
+	"context"
+	"errors"
+	"github.com/shared-spotify/datadog"
+	"github.com/shared-spotify/logger"
+	"github.com/shared-spotify/musicclient/clientcommon"
+	"net/http"
+)
+
+// The deezer implementation of the music provider
+var Provider clientcommon.MusicProvider = &provider{}
+
+type provider struct{}
+
+func (p *provider) LoginType() string {
+	return clientcommon.DeezerLoginType
+}
+
+func (p *provider) MetricsName() string {
+	return datadog.DeezerProvider
+}
+
+func (p *provider) LoginPath() string {
+	return "/login/deezer"
+}
+
+func (p *provider) Login(w http.ResponseWriter, r *http.Request) {
+	Authenticate(w, r)
+}
+
+func (p *provider) CallbackPath() string {
+	return "/callback/deezer"
+}
+
+func (p *provider) Callback(w http.ResponseWriter, r *http.Request) {
+	CallbackHandler(w, r)
+}
+
+func (p *provider) EncryptToken(token interface{}) (string, error) {
+	deezerLogin, ok := token.(*DeezerLogin)
+
+	if !ok {
+		return "", errors.New("token is not a deezer login")
+	}
+
+	return EncryptToken(deezerLogin)
+}
+
+func (p *provider) DecryptToken(tokenStr string) (interface{}, error) {
+	return DecryptToken(tokenStr)
+}
+
+func (p *provider) CreateUserFromToken(tokenStr string) (*clientcommon.User, error) {
+	deezerLogin, err := DecryptToken(tokenStr)
+
+	if err != nil {
+		errMsg := "failed to create user from request - failed to decrypt token "
+		logger.Logger.Error(errMsg, err)
+		return nil, errors.New(errMsg)
+	}
+
+	user, err := CreateUserFromToken(deezerLogin, tokenStr)
+
+	if err != nil {
+		logger.Logger.Error("failed to create user from request - create user from token failed ", err)
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (p *provider) GetAllSongs(user *clientcommon.User, options *clientcommon.LibraryOptions,
+	progress clientcommon.ProgressHook) ([]*clientcommon.Track, error) {
+	return GetAllSongs(user, options, progress)
+}
+
+func (p *provider) GetPlaylists(user *clientcommon.User) ([]*clientcommon.LibraryPlaylist, error) {
+	return GetPlaylists(user)
+}
+
+func (p *provider) CreatePlaylist(user *clientcommon.User, playlistName string, tracks []*clientcommon.Track,
+	ctx context.Context) (*string, []*clientcommon.Track, error) {
+	return CreatePlaylist(user, playlistName, tracks, ctx)
+}
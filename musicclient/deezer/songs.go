@@ -0,0 +1,263 @@
+package deezer
+
+import (
+	"github.com/shared-spotify/datadog"
+	"github.com/shared-spotify/logger"
+	"github.com/shared-spotify/musicclient/clientcommon"
+	"github.com/shared-spotify/musicclient/deezer/deezerapi"
+	"time"
+)
+
+const fullTracksProgressInterval = 50
+
+func GetAllSongs(user *clientcommon.User, options *clientcommon.LibraryOptions,
+	progress clientcommon.ProgressHook) ([]*clientcommon.Track, error) {
+	// the tracks are kept per source, so the converted tracks can be tagged with the source they come from
+	tracksPerSource := make(map[string][]*deezerapi.Track)
+
+	// Get the favourite songs
+	if options.Sources.Includes(clientcommon.LibrarySourceLikedSongs) {
+		logger.WithUser(user.GetUserId()).Info("Fetching all deezer favourite songs for user")
+
+		favouriteTracks, err := user.DeezerClient.GetFavouriteTracks()
+
+		clientcommon.SendRequestMetric(datadog.DeezerProvider, datadog.RequestTypeSavedSongs, true, err)
+
+		if err != nil {
+			logger.WithUser(user.GetUserId()).Error("Failed to fetch all deezer favourite songs for user ", err)
+			return nil, err
+		}
+
+		logger.WithUser(user.GetUserId()).Infof("Found %d deezer favourite songs for user", len(favouriteTracks))
+
+		progress.Report(clientcommon.ProgressStepPageFetched, clientcommon.SourceSavedSongs, len(favouriteTracks),
+			len(favouriteTracks))
+
+		tracksPerSource[clientcommon.LibrarySourceLikedSongs] = favouriteTracks
+	}
+
+	// Get the playlist songs
+	if options.IncludesPlaylists() {
+		logger.WithUser(user.GetUserId()).Info("Fetching all deezer playlist songs for user")
+
+		playlistTracksPerSource, err := getAllPlaylistSongs(user, options, progress)
+
+		if err != nil {
+			logger.WithUser(user.GetUserId()).Error("Failed to fetch all deezer playlist songs for user ", err)
+			return nil, err
+		}
+
+		for source, playlistTracks := range playlistTracksPerSource {
+			logger.WithUser(user.GetUserId()).Infof("Found %d deezer playlist songs for source %s for user",
+				len(playlistTracks), source)
+
+			tracksPerSource[source] = playlistTracks
+		}
+	}
+
+	// Get the top tracks
+	if options.Sources.Includes(clientcommon.LibrarySourceTopTracks) {
+		logger.WithUser(user.GetUserId()).Info("Fetching deezer top tracks for user")
+
+		topTracks, err := user.DeezerClient.GetTopTracks()
+
+		clientcommon.SendRequestMetric(datadog.DeezerProvider, datadog.RequestTypeTopTracks, true, err)
+
+		if err != nil {
+			logger.WithUser(user.GetUserId()).Error("Failed to fetch deezer top tracks for user ", err)
+			return nil, err
+		}
+
+		logger.WithUser(user.GetUserId()).Infof("Found %d deezer top tracks for user", len(topTracks))
+
+		progress.Report(clientcommon.ProgressStepPageFetched, clientcommon.SourceTopTracks, len(topTracks),
+			len(topTracks))
+
+		tracksPerSource[clientcommon.LibrarySourceTopTracks] = topTracks
+	}
+
+	// Get the recently played tracks
+	if options.Sources.Includes(clientcommon.LibrarySourceRecentlyPlayed) {
+		logger.WithUser(user.GetUserId()).Info("Fetching deezer recently played tracks for user")
+
+		historyTracks, err := user.DeezerClient.GetHistoryTracks()
+
+		clientcommon.SendRequestMetric(datadog.DeezerProvider, datadog.RequestTypeRecentlyPlayed, true, err)
+
+		if err != nil {
+			logger.WithUser(user.GetUserId()).Error("Failed to fetch deezer recently played tracks for user ", err)
+			return nil, err
+		}
+
+		logger.WithUser(user.GetUserId()).Infof("Found %d deezer recently played tracks for user", len(historyTracks))
+
+		progress.Report(clientcommon.ProgressStepPageFetched, clientcommon.SourceRecentlyPlayed, len(historyTracks),
+			len(historyTracks))
+
+		tracksPerSource[clientcommon.LibrarySourceRecentlyPlayed] = historyTracks
+	}
+
+	// the full tracks are fetched once for all the sources
+	allTracks := make([]*deezerapi.Track, 0)
+
+	for _, source := range clientcommon.AllLibrarySources {
+		allTracks = append(allTracks, tracksPerSource[source]...)
+	}
+
+	fullTracks, err := getFullTracks(user, allTracks, progress)
+
+	if err != nil {
+		logger.WithUser(user.GetUserId()).Error("Failed to fetch full deezer songs for user ", err)
+		return nil, err
+	}
+
+	fullTrackPerId := make(map[int]*deezerapi.Track)
+
+	for _, fullTrack := range fullTracks {
+		fullTrackPerId[fullTrack.Id] = fullTrack
+	}
+
+	convertedTracks := make([]*clientcommon.Track, 0)
+
+	for _, source := range clientcommon.AllLibrarySources {
+		for _, track := range tracksPerSource[source] {
+			// the tracks removed from deezer do not have a full track
+			fullTrack, ok := fullTrackPerId[track.Id]
+
+			if !ok {
+				continue
+			}
+
+			convertedTrack := ToTrack(fullTrack)
+			convertedTrack.LibrarySource = source
+
+			if track.TimeAdd != 0 {
+				convertedTrack.AddedAt = time.Unix(track.TimeAdd, 0)
+			}
+			convertedTracks = append(convertedTracks, convertedTrack)
+		}
+	}
+
+	return convertedTracks, nil
+}
+
+// This method gets all the songs from the playlists of the user included by the options, per source of their playlist
+func getAllPlaylistSongs(user *clientcommon.User, options *clientcommon.LibraryOptions,
+	progress clientcommon.ProgressHook) (map[string][]*deezerapi.Track, error) {
+	client := user.DeezerClient
+
+	playlists, err := client.GetPlaylists()
+
+	clientcommon.SendRequestMetric(datadog.DeezerProvider, datadog.RequestTypePlaylists, true, err)
+
+	if err != nil {
+		logger.WithUser(user.GetUserId()).Errorf("Failed to get deezer playlists for user %v", err)
+		return nil, err
+	}
+
+	logger.WithUser(user.GetUserId()).Infof("User has %d total deezer playlists", len(playlists))
+
+	tracksPerSource := make(map[string][]*deezerapi.Track)
+	trackCount := 0
+
+	for i, playlist := range playlists {
+		progress.Report(clientcommon.ProgressStepPageFetched, clientcommon.SourcePlaylists, i, len(playlists))
+
+		libraryPlaylist := toLibraryPlaylist(playlist, user)
+
+		if !options.IncludesPlaylist(libraryPlaylist) {
+			continue
+		}
+
+		tracks, err := client.GetPlaylistTracks(playlist.Id)
+
+		clientcommon.SendRequestMetric(datadog.DeezerProvider, datadog.RequestTypePlaylistSongs, true, err)
+
+		if err != nil {
+			logger.WithUser(user.GetUserId()).Errorf("Failed to get tracks for deezer playlist %d %v",
+				playlist.Id, err)
+			return nil, err
+		}
+
+		logger.WithUser(user.GetUserId()).Debugf("Got %d tracks from deezer playlist %d for user",
+			len(tracks), playlist.Id)
+
+		source := options.GetPlaylistSource(libraryPlaylist)
+		tracksPerSource[source] = append(tracksPerSource[source], tracks...)
+		trackCount += len(tracks)
+
+		progress.Report(clientcommon.ProgressStepPageFetched, clientcommon.SourcePlaylistSongs, trackCount, 0)
+	}
+
+	progress.Report(clientcommon.ProgressStepPageFetched, clientcommon.SourcePlaylists, len(playlists), len(playlists))
+
+	return tracksPerSource, nil
+}
+
+func GetPlaylists(user *clientcommon.User) ([]*clientcommon.LibraryPlaylist, error) {
+	deezerPlaylists, err := user.DeezerClient.GetPlaylists()
+
+	clientcommon.SendRequestMetric(datadog.DeezerProvider, datadog.RequestTypePlaylists, true, err)
+
+	if err != nil {
+		logger.WithUser(user.GetUserId()).Errorf("Failed to get deezer playlists for user %v", err)
+		return nil, err
+	}
+
+	playlists := make([]*clientcommon.LibraryPlaylist, 0)
+
+	for _, playlist := range deezerPlaylists {
+		playlists = append(playlists, toLibraryPlaylist(playlist, user))
+	}
+
+	return playlists, nil
+}
+
+// The tracks in the lists sent back by deezer do not contain the isrc, so we fetch the full tracks
+func getFullTracks(user *clientcommon.User, tracks []*deezerapi.Track,
+	progress clientcommon.ProgressHook) ([]*deezerapi.Track, error) {
+	fullTracks := make([]*deezerapi.Track, 0)
+	seenTrackIds := make(map[int]bool)
+
+	for i, track := range tracks {
+		// one call is made per track, so we only report from time to time
+		if i%fullTracksProgressInterval == 0 {
+			progress.Report(clientcommon.ProgressStepIsrcConverted, clientcommon.SourceCatalog, i, len(tracks))
+		}
+
+		if seenTrackIds[track.Id] {
+			continue
+		}
+
+		seenTrackIds[track.Id] = true
+
+		if track.Isrc != "" {
+			fullTracks = append(fullTracks, track)
+			continue
+		}
+
+		fullTrack, err := user.DeezerClient.GetTrack(track.Id)
+
+		// tracks can be removed from deezer while still being in the library of the user
+		if deezerapi.IsNotFound(err) {
+			clientcommon.SendRequestMetric(datadog.DeezerProvider, datadog.RequestTypeSongs, true, nil)
+			logger.WithUser(user.GetUserId()).Warningf("Deezer track %d was not found, skipping it", track.Id)
+			continue
+		}
+
+		clientcommon.SendRequestMetric(datadog.DeezerProvider, datadog.RequestTypeSongs, true, err)
+
+		if err != nil {
+			logger.WithUser(user.GetUserId()).Errorf("Failed to get full deezer track %d %v", track.Id, err)
+			return nil, err
+		}
+
+		fullTracks = append(fullTracks, fullTrack)
+	}
+
+	progress.Report(clientcommon.ProgressStepIsrcConverted, clientcommon.SourceCatalog, len(tracks), len(tracks))
+
+	logger.WithUser(user.GetUserId()).Infof("Fetched %d full deezer tracks successfully", len(fullTracks))
+
+	return fullTracks, nil
+}
@@ -0,0 +1,90 @@
+package deezer
+
+import (
+	"github.com/shared-spotify/musicclient/clientcommon"
+	"github.com/shared-spotify/musicclient/deezer/deezerapi"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetAllSongsFollowsPages(t *testing.T) {
+	fullTracks := map[string]deezerapi.Track{
+		"1": {Id: 1, Title: "First", Isrc: "ISRC1", Duration: 200, Artist: deezerapi.Artist{Id: 10, Name: "Artist"}},
+		"2": {Id: 2, Title: "Second", Isrc: "ISRC2", Duration: 180, Artist: deezerapi.Artist{Id: 10, Name: "Artist"}},
+	}
+	requestedPages := make([]string, 0)
+
+	mux := http.NewServeMux()
+	fakeDeezer := newFakeDeezer(t, mux)
+
+	mux.HandleFunc("/user/me/tracks", handleDeezerApi(t, func(w http.ResponseWriter, r *http.Request) interface{} {
+		index := r.URL.Query().Get("index")
+		requestedPages = append(requestedPages, index)
+
+		// the lists do not contain the isrc of the tracks, and the next url does not contain the access token
+		switch index {
+		case "":
+			return map[string]interface{}{
+				"data":  []deezerapi.Track{{Id: 1, Title: "First", TimeAdd: 1600000000}},
+				"total": 3,
+				"next":  fakeDeezer.URL + "/user/me/tracks?index=1&limit=1",
+			}
+		case "1":
+			return map[string]interface{}{
+				"data":  []deezerapi.Track{{Id: 2, Title: "Second"}},
+				"total": 3,
+				"next":  fakeDeezer.URL + "/user/me/tracks?index=2&limit=1",
+			}
+		default:
+			// a track removed from deezer is still in the favourites of the user
+			return map[string]interface{}{
+				"data":  []deezerapi.Track{{Id: 3, Title: "Removed"}},
+				"total": 3,
+			}
+		}
+	}))
+	mux.HandleFunc("/track/", handleDeezerApi(t, func(w http.ResponseWriter, r *http.Request) interface{} {
+		track, ok := fullTracks[strings.TrimPrefix(r.URL.Path, "/track/")]
+
+		if !ok {
+			return notFound()
+		}
+
+		return track
+	}))
+
+	user := newFakeDeezerUser(fakeDeezer)
+	options := clientcommon.CreateLibraryOptions(clientcommon.LibrarySources{clientcommon.LibrarySourceLikedSongs}, nil)
+
+	tracks, err := GetAllSongs(user, options, nil)
+
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if strings.Join(requestedPages, ",") != ",1,2" {
+		t.Errorf("Expected the 3 pages to be requested, got %v", requestedPages)
+	}
+
+	if len(tracks) != 2 {
+		t.Fatalf("Expected 2 tracks, got %d", len(tracks))
+	}
+
+	for i, isrc := range []string{"ISRC1", "ISRC2"} {
+		track := tracks[i]
+
+		if track.Isrc != isrc || track.LibrarySource != clientcommon.LibrarySourceLikedSongs {
+			t.Errorf("Unexpected track %d %+v", i, track)
+		}
+	}
+
+	if tracks[0].Duration != 200000 {
+		t.Errorf("Expected the duration in milliseconds, got %d", tracks[0].Duration)
+	}
+
+	if !tracks[0].AddedAt.Equal(time.Unix(1600000000, 0)) || !tracks[1].AddedAt.IsZero() {
+		t.Errorf("Unexpected added dates %v %v", tracks[0].AddedAt, tracks[1].AddedAt)
+	}
+}
@@ -0,0 +1,47 @@
+package musicclient
+
+import (
+	"github.com/shared-spotify/logger"
+	"github.com/shared-spotify/musicclient/applemusic"
+	"github.com/shared-spotify/musicclient/clientcommon"
+	"github.com/shared-spotify/musicclient/deezer"
+	spotifyclient "github.com/shared-spotify/musicclient/spotify"
+)
+
+// All the music providers users can login with, by login type
+var providers = make(map[string]clientcommon.MusicProvider)
+
+// Keep the order of registration so routes and listings are stable
+var providerLoginTypes = make([]string, 0)
+
+func init() {
+	RegisterProvider(spotifyclient.Provider)
+	RegisterProvider(applemusic.Provider)
+	RegisterProvider(deezer.Provider)
+}
+
+func RegisterProvider(provider clientcommon.MusicProvider) {
+	loginType := provider.LoginType()
+
+	if _, ok := providers[loginType]; ok {
+		logger.Logger.Fatalf("Music provider %s registered twice", loginType)
+	}
+
+	providers[loginType] = provider
+	providerLoginTypes = append(providerLoginTypes, loginType)
+}
+
+func GetProvider(loginType string) (clientcommon.MusicProvider, bool) {
+	provider, ok := providers[loginType]
+	return provider, ok
+}
+
+func GetProviders() []clientcommon.MusicProvider {
+	registeredProviders := make([]clientcommon.MusicProvider, 0, len(providerLoginTypes))
+
+	for _, loginType := range providerLoginTypes {
+		registeredProviders = append(registeredProviders, providers[loginType])
+	}
+
+	return registeredProviders
+}
@@ -9,10 +9,10 @@ import (
 
 const maxAlbumsPerApiCall = 20
 
-func GetAlbums(tracks []*spotify.FullTrack) (map[string]*spotify.FullAlbum, error) {
+func GetAlbums(tracks []*clientcommon.Track) (map[string]*clientcommon.Album, error) {
 	logger.Logger.Infof("Fetching albums for %d tracks", len(tracks))
 
-	albumsPerTrack := make(map[string]*spotify.FullAlbum)
+	albumsPerTrack := make(map[string]*clientcommon.Album)
 	albums := make([]*spotify.FullAlbum, 0)
 
 	albumIds := make([]spotify.ID, 0)
@@ -21,7 +21,19 @@ func GetAlbums(tracks []*spotify.FullTrack) (map[string]*spotify.FullAlbum, erro
 
 	for _, track := range tracks {
 		trackISCR, _ := clientcommon.GetTrackISRC(track)
-		albumId := track.Album.ID
+
+		if track.Album == nil {
+			continue
+		}
+
+		spotifyAlbumId, ok := track.Album.ProviderIds.Get(clientcommon.SpotifyLoginType)
+
+		// the album might not exist on spotify
+		if !ok {
+			continue
+		}
+
+		albumId := spotify.ID(spotifyAlbumId)
 
 		// we only add the albumId if we have not seen it already
 		if _, seen := albumsSeen[albumId]; !seen {
@@ -71,10 +83,16 @@ func GetAlbums(tracks []*spotify.FullTrack) (map[string]*spotify.FullAlbum, erro
 	}
 
 	for _, album := range albums {
+		// spotify sends back null for the albums it does not know
+		if album == nil {
+			continue
+		}
+
 		trackISCRs := TrackISCRsPerAlbumId[album.ID]
+		convertedAlbum := toAlbum(album.SimpleAlbum)
 
 		for _, trackISCR := range trackISCRs {
-			albumsPerTrack[trackISCR] = album
+			albumsPerTrack[trackISCR] = &convertedAlbum
 		}
 	}
 
@@ -9,10 +9,10 @@ import (
 
 const maxArtistsPerApiCall = 50
 
-func GetArtists(tracks []*spotify.FullTrack) (map[string][]*spotify.FullArtist, error) {
+func GetArtists(tracks []*clientcommon.Track) (map[string][]*clientcommon.Artist, error) {
 	logger.Logger.Infof("Fetching artists for %d tracks", len(tracks))
 
-	artistsPerTrack := make(map[string][]*spotify.FullArtist)
+	artistsPerTrack := make(map[string][]*clientcommon.Artist)
 	artists := make([]*spotify.FullArtist, 0)
 
 	artistIds := make([]spotify.ID, 0)
@@ -22,7 +22,14 @@ func GetArtists(tracks []*spotify.FullTrack) (map[string][]*spotify.FullArtist,
 	for _, track := range tracks {
 		for _, artist := range track.Artists {
 			trackISCR, _ := clientcommon.GetTrackISRC(track)
-			artistId := artist.ID
+			spotifyArtistId, ok := artist.ProviderIds.Get(clientcommon.SpotifyLoginType)
+
+			// the artist might not exist on spotify
+			if !ok {
+				continue
+			}
+
+			artistId := spotify.ID(spotifyArtistId)
 
 			// we only add the artistId if we have not seen it already
 			if _, seen := artistSeen[artistId]; !seen {
@@ -73,16 +80,22 @@ func GetArtists(tracks []*spotify.FullTrack) (map[string][]*spotify.FullArtist,
 	}
 
 	for _, artist := range artists {
+		// spotify sends back null for the artists it does not know
+		if artist == nil {
+			continue
+		}
+
 		trackISCRs := TrackISCRsPerArtistId[artist.ID]
+		convertedArtist := toFullArtist(artist)
 
 		for _, trackISCR := range trackISCRs {
 			artistsForTrack := artistsPerTrack[trackISCR]
 
 			if artistsForTrack == nil {
-				artistsForTrack = make([]*spotify.FullArtist, 1)
-				artistsForTrack[0] = artist
+				artistsForTrack = make([]*clientcommon.Artist, 1)
+				artistsForTrack[0] = convertedArtist
 			} else {
-				artistsForTrack = append(artistsForTrack, artist)
+				artistsForTrack = append(artistsForTrack, convertedArtist)
 			}
 
 			artistsPerTrack[trackISCR] = artistsForTrack
@@ -9,10 +9,10 @@ import (
 
 const maxAudioFeaturePerApiCall = 100
 
-func GetAudioFeatures(tracks []*spotify.FullTrack) (map[string]*spotify.AudioFeatures, error) {
+func GetAudioFeatures(tracks []*clientcommon.Track) (map[string]*clientcommon.AudioFeatures, error) {
 	logger.Logger.Infof("Fetching audio features for %d tracks", len(tracks))
 
-	audioFeaturesPerTrack := make(map[string]*spotify.AudioFeatures)
+	audioFeaturesPerTrack := make(map[string]*clientcommon.AudioFeatures)
 	audioFeatures := make([]*spotify.AudioFeatures, 0)
 
 	trackIds := make([]spotify.ID, 0)
@@ -20,9 +20,16 @@ func GetAudioFeatures(tracks []*spotify.FullTrack) (map[string]*spotify.AudioFea
 
 	for _, track := range tracks {
 		trackISCR, _ := clientcommon.GetTrackISRC(track)
-		trackId := track.ID
+		spotifyId, ok := track.GetProviderId(clientcommon.SpotifyLoginType)
 
-		trackIds = append(trackIds, track.ID)
+		// the track might not exist on spotify
+		if !ok {
+			continue
+		}
+
+		trackId := spotify.ID(spotifyId)
+
+		trackIds = append(trackIds, trackId)
 		TrackISCRPerTrackIds[trackId] = trackISCR
 	}
 
@@ -56,8 +63,13 @@ func GetAudioFeatures(tracks []*spotify.FullTrack) (map[string]*spotify.AudioFea
 	}
 
 	for _, audioFeature := range audioFeatures {
+		// spotify sends back null for the tracks it has no audio features for
+		if audioFeature == nil {
+			continue
+		}
+
 		trackISCR := TrackISCRPerTrackIds[audioFeature.ID]
-		audioFeaturesPerTrack[trackISCR] = audioFeature
+		audioFeaturesPerTrack[trackISCR] = toAudioFeatures(audioFeature)
 	}
 
 	return audioFeaturesPerTrack, nil
@@ -13,18 +13,13 @@ import (
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/clientcredentials"
 	"net/http"
-	"net/url"
 	"os"
-	"strings"
 	"time"
 
 	"github.com/shared-spotify/logger"
 	"github.com/zmb3/spotify"
 )
 
-const redirectParam = "redirect_uri"
-var loginUrl = clientcommon.FrontendUrl + "/login"
-
 // Cache 1000 states max
 var states, _ = lru.New(1000)
 
@@ -43,7 +38,9 @@ var auth = spotify.NewAuthenticator(
 	spotify.ScopePlaylistReadCollaborative,
 	spotify.ScopePlaylistModifyPrivate,
 	spotify.ScopePlaylistModifyPublic,
-	spotify.ScopeUserLibraryRead)
+	spotify.ScopeUserLibraryRead,
+	spotify.ScopeUserTopRead,
+	spotify.ScopeUserReadRecentlyPlayed)
 
 func init() {
 	// set client id and secret here for spotify
@@ -51,7 +48,12 @@ func init() {
 }
 
 func CreateUserFromToken(token *oauth2.Token, tokenStr string) (*clientcommon.User, error) {
-	client := auth.NewClient(token)
+	user := &clientcommon.User{
+		LoginType: clientcommon.SpotifyLoginType,
+		Token:     tokenStr,
+	}
+
+	client := newClientForUser(token, user)
 	client.AutoRetry = true // enable auto retries when rate limited
 
 	privateUser, err := client.CurrentUser()
@@ -64,13 +66,15 @@ func CreateUserFromToken(token *oauth2.Token, tokenStr string) (*clientcommon.Us
 	}
 
 	userInfos := toUserInfos(privateUser)
+	user.UserInfos = &userInfos
+	user.SpotifyClient = &client
 
-	return &clientcommon.User{
-		UserInfos:     &userInfos,
-		SpotifyClient: &client,
-		LoginType:     clientcommon.SpotifyLoginType,
-		Token:         tokenStr,
-	}, nil
+	// the token might have been refreshed while getting the user infos
+	if user.GetToken() != tokenStr {
+		clientcommon.NotifyTokenRefreshed(user, tokenStr)
+	}
+
+	return user, nil
 }
 
 func toUserInfos(user *spotify.PrivateUser) clientcommon.UserInfos {
@@ -90,7 +94,7 @@ func Authenticate(w http.ResponseWriter, r *http.Request) {
 	datadog.Increment(1, datadog.UserLoginStarted, datadog.Provider.Tag(datadog.SpotifyProvider))
 
 	// We extract the redirect_uri if it exists, to redirect to it once the auth is finished
-	redirectUri := r.URL.Query().Get(redirectParam)
+	redirectUri := r.URL.Query().Get(clientcommon.RedirectParam)
 	redirect := clientcommon.FrontendUrl
 
 	if redirect != "" {
@@ -131,7 +135,7 @@ func CallbackHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// form the url in case we fail to auth and need to redirect the user again to the login page
-	loginRedirectUrl := FormRedirectLoginUrl(redirectUrl.(string))
+	loginRedirectUrl := clientcommon.FormRedirectLoginUrl(redirectUrl.(string))
 
 	// use the same state string here that you used to generate the URL
 	token, err := auth.Token(st, r)
@@ -148,7 +152,15 @@ func CallbackHandler(w http.ResponseWriter, r *http.Request) {
 	states.Remove(st)
 
 	// Add the token as an encrypted cookie
-	cookie, err := EncryptToken(token)
+	encryptedToken, err := EncryptToken(token)
+	if err != nil {
+		logger.Logger.
+			WithError(err).
+			Errorf("Failed to encrypt token - redirecting user back to login page")
+		http.Redirect(w, r, loginRedirectUrl, http.StatusFound)
+		return
+	}
+	cookie, err := clientcommon.GetTokenCookie(encryptedToken)
 	if err != nil {
 		logger.Logger.
 			WithError(err).
@@ -171,7 +183,7 @@ func CallbackHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Add the users to the database if we can, but don't fail as we will add him otherwise at another time
 	// for example when the room is processed
-	user, err := CreateUserFromToken(token, cookie.Value)
+	user, err := CreateUserFromToken(token, encryptedToken)
 	if err == nil {
 		_ = mongoclient.InsertUsers([]*clientcommon.User{user})
 	}
@@ -192,7 +204,7 @@ func DecryptToken(tokenStr string) (*oauth2.Token, error) {
 		return nil, err
 	}
 
-	decryptedToken, err := utils.Decrypt(base64JsonToken, clientcommon.TokenEncryptionKey)
+	decryptedToken, err := clientcommon.TokenKeyring.Decrypt(base64JsonToken)
 
 	if err != nil {
 		logger.Logger.Error("Failed to decrypt token ", err)
@@ -209,53 +221,22 @@ func DecryptToken(tokenStr string) (*oauth2.Token, error) {
 	return &token, nil
 }
 
-func EncryptToken(token *oauth2.Token) (*http.Cookie, error) {
+func EncryptToken(token *oauth2.Token) (string, error) {
 	jsonToken, err := json.Marshal(*token)
 
 	if err != nil {
 		logger.Logger.Error("Failed to serialise json token")
-		return nil, err
+		return "", err
 	}
 
-	encryptedToken, err := utils.Encrypt(jsonToken, clientcommon.TokenEncryptionKey)
+	encryptedToken, err := clientcommon.TokenKeyring.Encrypt(jsonToken)
 
 	if err != nil {
 		logger.Logger.Error("Failed to encrypt token ", err)
-		return nil, err
+		return "", err
 	}
 
-	base64EncryptedToken := base64.StdEncoding.EncodeToString(encryptedToken)
-
-	expiration := time.Now().Add(365 * 24 * time.Hour)
-
-	urlParsed, err := url.Parse(clientcommon.BackendUrl)
-
-	if err != nil {
-		logger.Logger.Error("Failed to parse urls ", err)
-		return nil, err
-	}
-
-	secure := true
-	sameSite := http.SameSiteNoneMode
-
-	// for localhost development
-	if urlParsed.Scheme == "http" {
-		secure = false
-		sameSite = http.SameSiteDefaultMode
-	}
-
-	cookie := http.Cookie{
-		Name:    clientcommon.TokenCookieName,
-		Value:   base64EncryptedToken,
-		Expires: expiration,
-		// we send the cookie cross domain, so we need all this
-		Domain:   urlParsed.Host,
-		Path:     "/",
-		Secure:   secure,
-		SameSite: sameSite,
-	}
-
-	return &cookie, nil
+	return base64.StdEncoding.EncodeToString(encryptedToken), nil
 }
 
 func CreateGenericClient(clientId string, clientSecret string) (*spotify.Client, error) {
@@ -276,14 +257,3 @@ func CreateGenericClient(clientId string, clientSecret string) (*spotify.Client,
 
 	return &client, nil
 }
-
-// we form here the login url with the redirect uri
-func FormRedirectLoginUrl(redirectUrl string) string {
-	return fmt.Sprintf(
-		"%s?%s=%s",
-		loginUrl,
-		redirectParam,
-		// create the uri by removing the frontend url
-		strings.ReplaceAll(redirectUrl, clientcommon.FrontendUrl, ""),
-	)
-}
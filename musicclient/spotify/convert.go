@@ -0,0 +1,119 @@
+package spotify
+
+import (
+	"github.com/shared-spotify/musicclient/clientcommon"
+	"github.com/zmb3/spotify"
+	"time"
+)
+
+// Conversion of the spotify objects to our own music objects
+
+func ToTrack(track *spotify.FullTrack) *clientcommon.Track {
+	artists := make([]*clientcommon.Artist, 0)
+
+	for _, artist := range track.Artists {
+		artists = append(artists, toArtist(artist))
+	}
+
+	album := toAlbum(track.Album)
+
+	convertedTrack := &clientcommon.Track{
+		Isrc:        track.ExternalIDs["isrc"],
+		Name:        track.Name,
+		Artists:     artists,
+		Album:       &album,
+		Duration:    track.Duration,
+		Popularity:  track.Popularity,
+		Explicit:    track.Explicit,
+		PreviewUrl:  track.PreviewURL,
+		ProviderIds: clientcommon.ProviderIds{clientcommon.SpotifyLoginType: track.ID.String()},
+	}
+
+	// spotify gives the version of the track playable in the market of the user, and the one it was relinked from
+	if track.LinkedFrom != nil && track.LinkedFrom.ID != "" {
+		convertedTrack.LinkedFrom = clientcommon.ProviderIds{clientcommon.SpotifyLoginType: track.LinkedFrom.ID.String()}
+	}
+
+	return convertedTrack
+}
+
+// The tracks of the library of the user also have the time he added them, it stays zero if spotify does not give it
+func toLibraryTrack(track *spotify.FullTrack, addedAt string) *clientcommon.Track {
+	convertedTrack := ToTrack(track)
+	convertedTrack.AddedAt, _ = time.Parse(spotify.TimestampLayout, addedAt)
+
+	return convertedTrack
+}
+
+func ToTracks(tracks []*spotify.FullTrack) []*clientcommon.Track {
+	convertedTracks := make([]*clientcommon.Track, 0)
+
+	for _, track := range tracks {
+		// spotify sends back null for the tracks it does not know
+		if track == nil {
+			continue
+		}
+
+		convertedTracks = append(convertedTracks, ToTrack(track))
+	}
+
+	return convertedTracks
+}
+
+func toArtist(artist spotify.SimpleArtist) *clientcommon.Artist {
+	return &clientcommon.Artist{
+		Name:        artist.Name,
+		ProviderIds: clientcommon.ProviderIds{clientcommon.SpotifyLoginType: artist.ID.String()},
+	}
+}
+
+func toFullArtist(artist *spotify.FullArtist) *clientcommon.Artist {
+	convertedArtist := toArtist(artist.SimpleArtist)
+	convertedArtist.Genres = artist.Genres
+
+	return convertedArtist
+}
+
+func toAlbum(album spotify.SimpleAlbum) clientcommon.Album {
+	images := make([]clientcommon.Image, 0)
+
+	for _, image := range album.Images {
+		images = append(images, clientcommon.Image{Url: image.URL, Height: image.Height, Width: image.Width})
+	}
+
+	return clientcommon.Album{
+		Name:                 album.Name,
+		Images:               images,
+		ReleaseDate:          album.ReleaseDate,
+		ReleaseDatePrecision: album.ReleaseDatePrecision,
+		ProviderIds:          clientcommon.ProviderIds{clientcommon.SpotifyLoginType: album.ID.String()},
+	}
+}
+
+// The playlist is owned by someone else if it was just "liked" by the user
+func toLibraryPlaylist(playlist spotify.SimplePlaylist, user *clientcommon.User) *clientcommon.LibraryPlaylist {
+	return &clientcommon.LibraryPlaylist{
+		Id:            playlist.ID.String(),
+		Name:          playlist.Name,
+		Owned:         playlist.Owner.ID == user.GetId(),
+		Collaborative: playlist.Collaborative,
+		TrackCount:    int(playlist.Tracks.Total),
+	}
+}
+
+func toAudioFeatures(audioFeatures *spotify.AudioFeatures) *clientcommon.AudioFeatures {
+	return &clientcommon.AudioFeatures{
+		Acousticness:     audioFeatures.Acousticness,
+		Danceability:     audioFeatures.Danceability,
+		Energy:           audioFeatures.Energy,
+		Instrumentalness: audioFeatures.Instrumentalness,
+		Key:              audioFeatures.Key,
+		Liveness:         audioFeatures.Liveness,
+		Loudness:         audioFeatures.Loudness,
+		Mode:             audioFeatures.Mode,
+		Speechiness:      audioFeatures.Speechiness,
+		Tempo:            audioFeatures.Tempo,
+		TimeSignature:    audioFeatures.TimeSignature,
+		Valence:          audioFeatures.Valence,
+	}
+}
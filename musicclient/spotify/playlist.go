@@ -14,7 +14,8 @@ const maxTrackPerPlaylistAddCall = 100
 const spotifyExternalLinkName = "spotify"
 const maxRetryAddSongs = 3
 
-func CreatePlaylist(user *clientcommon.User, playlistName string, tracks []*spotify.FullTrack, ctx context.Context) (*string, error) {
+func CreatePlaylist(user *clientcommon.User, playlistName string, tracks []*clientcommon.Track,
+	ctx context.Context) (*string, []*clientcommon.Track, error) {
 	rootSpan, rootCtx := tracer.StartSpanFromContext(ctx, "playlist.create.spotify")
 	defer rootSpan.Finish()
 
@@ -28,7 +29,7 @@ func CreatePlaylist(user *clientcommon.User, playlistName string, tracks []*spot
 	if err != nil {
 		logger.WithUser(user.GetUserId()).Error("Failed to created playlist ", err)
 		span.Finish(tracer.WithError(err))
-		return nil, err
+		return nil, nil, err
 	}
 
 	logger.WithUser(user.GetUserId()).Infof("Playlist '%s' successfully created for user %s", playlistName, user.GetUserId())
@@ -36,9 +37,19 @@ func CreatePlaylist(user *clientcommon.User, playlistName string, tracks []*spot
 
 	// we add the tracks
 	trackIds := make([]spotify.ID, 0)
+	addedTracks := make([]*clientcommon.Track, 0)
 
 	for _, track := range tracks {
-		trackIds = append(trackIds, track.ID)
+		spotifyId, ok := track.GetProviderId(clientcommon.SpotifyLoginType)
+
+		// the track might not exist on spotify
+		if !ok {
+			logger.WithUser(user.GetUserId()).Warningf("No spotify id for track %s, skipping it", track.Name)
+			continue
+		}
+
+		trackIds = append(trackIds, spotify.ID(spotifyId))
+		addedTracks = append(addedTracks, track)
 	}
 
 	span, ctx = tracer.StartSpanFromContext(rootCtx, "playlist.create.spotify.add.tracks")
@@ -78,7 +89,7 @@ func CreatePlaylist(user *clientcommon.User, playlistName string, tracks []*spot
 				WithError(err).
 				Errorf("Failed to add songs to playlist %s %v", playlistName, span)
 			span.Finish(tracer.WithError(err))
-			return nil, err
+			return nil, nil, err
 		}
 
 		logger.
@@ -99,8 +110,8 @@ func CreatePlaylist(user *clientcommon.User, playlistName string, tracks []*spot
 		logger.
 			WithUser(user.GetUserId()).
 			Warningf("No spotify external link for playlist '%s' for user %v", playlistName, span)
-		return nil, nil
+		return nil, addedTracks, nil
 	}
 
-	return &externalLink, nil
+	return &externalLink, addedTracks, nil
 }
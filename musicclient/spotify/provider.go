@@ -0,0 +1,102 @@
+package spotify
+
+import (
+	"context"
+	"errors"
+	"github.com/shared-spotify/datadog"
+	"github.com/shared-spotify/logger"
+	"github.com/shared-spotify/musicclient/clientcommon"
+	"golang.org/x/oauth2"
+	"net/http"
+)
+
+const retryFailCreateUserFromToken = 5
+
+// The spotify implementation of the music provider
+var Provider clientcommon.MusicProvider = &provider{}
+
+type provider struct{}
+
+func (p *provider) LoginType() string {
+	return clientcommon.SpotifyLoginType
+}
+
+func (p *provider) MetricsName() string {
+	return datadog.SpotifyProvider
+}
+
+func (p *provider) LoginPath() string {
+	return "/login"
+}
+
+func (p *provider) Login(w http.ResponseWriter, r *http.Request) {
+	Authenticate(w, r)
+}
+
+func (p *provider) CallbackPath() string {
+	return "/callback"
+}
+
+func (p *provider) Callback(w http.ResponseWriter, r *http.Request) {
+	CallbackHandler(w, r)
+}
+
+func (p *provider) EncryptToken(token interface{}) (string, error) {
+	oauthToken, ok := token.(*oauth2.Token)
+
+	if !ok {
+		return "", errors.New("token is not a spotify oauth token")
+	}
+
+	return EncryptToken(oauthToken)
+}
+
+func (p *provider) DecryptToken(tokenStr string) (interface{}, error) {
+	return DecryptToken(tokenStr)
+}
+
+func (p *provider) CreateUserFromToken(tokenStr string) (*clientcommon.User, error) {
+	token, err := DecryptToken(tokenStr)
+
+	if err != nil {
+		errMsg := "failed to create user from request - failed to decrypt token "
+		logger.Logger.Error(errMsg, err)
+		return nil, errors.New(errMsg)
+	}
+
+	var user *clientcommon.User
+	retry := 0
+
+	// We retry for spotify because the api throws randomly 503 sometimes
+	for retry < retryFailCreateUserFromToken {
+		user, err = CreateUserFromToken(token, tokenStr)
+
+		if user != nil {
+			break
+		}
+
+		retry += 1
+		logger.Logger.Warningf("Failed to create user from request, retrying with retry count=%d, %v", retry, err)
+	}
+
+	if err != nil {
+		logger.Logger.Error("failed to create user from request - create user from token failed ", err)
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (p *provider) GetAllSongs(user *clientcommon.User, options *clientcommon.LibraryOptions,
+	progress clientcommon.ProgressHook) ([]*clientcommon.Track, error) {
+	return GetAllSongs(user, options, progress)
+}
+
+func (p *provider) GetPlaylists(user *clientcommon.User) ([]*clientcommon.LibraryPlaylist, error) {
+	return GetPlaylists(user)
+}
+
+func (p *provider) CreatePlaylist(user *clientcommon.User, playlistName string, tracks []*clientcommon.Track,
+	ctx context.Context) (*string, []*clientcommon.Track, error) {
+	return CreatePlaylist(user, playlistName, tracks, ctx)
+}
@@ -0,0 +1,109 @@
+package spotify
+
+import (
+	"github.com/shared-spotify/datadog"
+	"github.com/shared-spotify/logger"
+	"github.com/shared-spotify/musicclient/clientcommon"
+	"github.com/zmb3/spotify"
+)
+
+const maxRecommendations = 100
+
+// Get the tracks recommended by spotify for the seeds given, the seeds are taken in turn from the tracks, artists and
+// genres until the max number of seeds is reached, so the first ones of each should be the most relevant
+func GetRecommendations(trackIds []string, artistIds []string, genres []string, limit int) ([]*clientcommon.Track, error) {
+	if limit > maxRecommendations {
+		limit = maxRecommendations
+	}
+
+	client, err := GetSpotifyGenericClient()
+
+	if err != nil {
+		return nil, err
+	}
+
+	// spotify only accepts some genres as seeds
+	availableGenres, err := client.GetAvailableGenreSeeds()
+
+	clientcommon.SendRequestMetric(datadog.SpotifyProvider, datadog.RequestTypeGenreSeeds, false, err)
+
+	if err != nil {
+		logger.Logger.Errorf("Failed to get available genre seeds - %v", err)
+		return nil, err
+	}
+
+	seeds := getSeeds(trackIds, artistIds, getAvailableGenres(genres, availableGenres))
+
+	if len(seeds.Tracks)+len(seeds.Artists)+len(seeds.Genres) == 0 {
+		logger.Logger.Warning("No seeds to get recommendations")
+		return []*clientcommon.Track{}, nil
+	}
+
+	logger.Logger.Infof("Getting recommendations for tracks %v, artists %v and genres %v", seeds.Tracks,
+		seeds.Artists, seeds.Genres)
+
+	recommendations, err := client.GetRecommendations(seeds, nil, &spotify.Options{Limit: &limit})
+
+	clientcommon.SendRequestMetric(datadog.SpotifyProvider, datadog.RequestTypeRecommendations, false, err)
+
+	if err != nil {
+		logger.Logger.Errorf("Failed to get recommendations - %v", err)
+		return nil, err
+	}
+
+	// the recommended tracks do not have their isrc, so we get the full tracks
+	recommendedTrackIds := make([]spotify.ID, 0)
+
+	for _, track := range recommendations.Tracks {
+		recommendedTrackIds = append(recommendedTrackIds, track.ID)
+	}
+
+	tracks, err := GetTracks(client, recommendedTrackIds)
+
+	if err != nil {
+		logger.Logger.Errorf("Failed to get recommended tracks - %v", err)
+		return nil, err
+	}
+
+	return ToTracks(tracks), nil
+}
+
+func getSeeds(trackIds []string, artistIds []string, genres []string) spotify.Seeds {
+	seeds := spotify.Seeds{Artists: []spotify.ID{}, Tracks: []spotify.ID{}, Genres: []string{}}
+
+	for i := 0; ; i++ {
+		if i >= len(trackIds) && i >= len(artistIds) && i >= len(genres) {
+			return seeds
+		}
+
+		if i < len(trackIds) && len(seeds.Tracks)+len(seeds.Artists)+len(seeds.Genres) < spotify.MaxNumberOfSeeds {
+			seeds.Tracks = append(seeds.Tracks, spotify.ID(trackIds[i]))
+		}
+
+		if i < len(artistIds) && len(seeds.Tracks)+len(seeds.Artists)+len(seeds.Genres) < spotify.MaxNumberOfSeeds {
+			seeds.Artists = append(seeds.Artists, spotify.ID(artistIds[i]))
+		}
+
+		if i < len(genres) && len(seeds.Tracks)+len(seeds.Artists)+len(seeds.Genres) < spotify.MaxNumberOfSeeds {
+			seeds.Genres = append(seeds.Genres, genres[i])
+		}
+	}
+}
+
+func getAvailableGenres(genres []string, availableGenres []string) []string {
+	isAvailable := make(map[string]bool)
+
+	for _, genre := range availableGenres {
+		isAvailable[genre] = true
+	}
+
+	result := make([]string, 0)
+
+	for _, genre := range genres {
+		if isAvailable[genre] {
+			result = append(result, genre)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,94 @@
+package spotify
+
+import (
+	"context"
+	"github.com/shared-spotify/logger"
+	"github.com/shared-spotify/musicclient/clientcommon"
+	"github.com/zmb3/spotify"
+	"golang.org/x/oauth2"
+	"sync"
+)
+
+// Same config as the one used by the authenticator, which we need to create our own token source
+var oauthConfig = &oauth2.Config{
+	ClientID:     ClientId,
+	ClientSecret: ClientSecret,
+	RedirectURL:  CallbackUrl,
+	Endpoint: oauth2.Endpoint{
+		AuthURL:  spotify.AuthURL,
+		TokenURL: spotify.TokenURL,
+	},
+}
+
+// Token source that lets us know when the oauth library refreshed the token of the user, so we can save it
+type notifyingTokenSource struct {
+	mutex     sync.Mutex
+	source    oauth2.TokenSource
+	token     *oauth2.Token
+	onRefresh func(token *oauth2.Token)
+}
+
+func newNotifyingTokenSource(token *oauth2.Token, onRefresh func(token *oauth2.Token)) *notifyingTokenSource {
+	return &notifyingTokenSource{
+		source:    oauthConfig.TokenSource(context.Background(), token),
+		token:     token,
+		onRefresh: onRefresh,
+	}
+}
+
+func (s *notifyingTokenSource) Token() (*oauth2.Token, error) {
+	token, refreshed, err := s.refreshToken()
+
+	if err != nil {
+		return nil, err
+	}
+
+	// the token is saved once the lock is released, so the other requests of the user are not blocked
+	if refreshed {
+		s.onRefresh(token)
+	}
+
+	return token, nil
+}
+
+func (s *notifyingTokenSource) refreshToken() (*oauth2.Token, bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	token, err := s.source.Token()
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	if token.AccessToken == s.token.AccessToken {
+		return token, false, nil
+	}
+
+	s.token = token
+
+	return token, true, nil
+}
+
+// Returns the client of the user, the user token is updated every time the client refreshes it
+func newClientForUser(token *oauth2.Token, user *clientcommon.User) spotify.Client {
+	tokenSource := newNotifyingTokenSource(token, func(newToken *oauth2.Token) {
+		encryptedToken, err := EncryptToken(newToken)
+
+		if err != nil {
+			logger.Logger.Error("Failed to encrypt refreshed spotify token ", err)
+			return
+		}
+
+		oldToken := user.SetToken(encryptedToken)
+
+		// the infos of the user are not known yet if the token is refreshed when we create the user
+		if user.UserInfos != nil {
+			clientcommon.NotifyTokenRefreshed(user, oldToken)
+		}
+	})
+
+	httpClient := oauth2.NewClient(context.Background(), tokenSource)
+
+	return spotify.NewClient(httpClient)
+}
@@ -7,54 +7,122 @@ import (
 	"github.com/shared-spotify/mongoclient"
 	"github.com/shared-spotify/musicclient/clientcommon"
 	"github.com/zmb3/spotify"
+	"net/http"
 	"strings"
 	"time"
 )
 
 var maxPerPage = 50
 
+// the tracks are relinked to the ones playable in the market of the user, spotify then gives the original ones
+var relinkingMarket = "from_token"
+
 const maxWaitBetweenCalls = 100 * time.Millisecond
 const maxWaitBetweenSearchCalls = 40 * time.Millisecond
 
-func GetAllSongs(user *clientcommon.User) ([]*spotify.FullTrack, error) {
+func GetAllSongs(user *clientcommon.User, options *clientcommon.LibraryOptions,
+	progress clientcommon.ProgressHook) ([]*clientcommon.Track, error) {
+	allTracks := make([]*clientcommon.Track, 0)
+
 	// Get the liked songs
-	logger.WithUser(user.GetUserId()).Info("Fetching all spotify saved songs for user")
+	if options.Sources.Includes(clientcommon.LibrarySourceLikedSongs) {
+		logger.WithUser(user.GetUserId()).Info("Fetching all spotify saved songs for user")
 
-	savedTracks, err := getSavedSongs(user)
+		savedTracks, err := getSavedSongs(user, progress)
 
-	if err != nil {
-		logger.WithUser(user.GetUserId()).Errorf("Failed to fetch all spotify tracks for user %s %v", user.GetUserId(), err)
-		return nil, err
-	}
+		if err != nil {
+			logger.WithUser(user.GetUserId()).Errorf("Failed to fetch all spotify tracks for user %s %v", user.GetUserId(), err)
+			return nil, err
+		}
 
-	logger.WithUser(user.GetUserId()).Info("Successfully fetched all spotify saved songs for user")
+		logger.WithUser(user.GetUserId()).Info("Successfully fetched all spotify saved songs for user")
+
+		allTracks = append(allTracks,
+			clientcommon.SetLibrarySource(savedTracks, clientcommon.LibrarySourceLikedSongs)...)
+	}
 
 	// Get the playlist songs
-	logger.WithUser(user.GetUserId()).Info("Fetching all spotify playlist tracks for user")
+	if options.IncludesPlaylists() {
+		logger.WithUser(user.GetUserId()).Info("Fetching all spotify playlist tracks for user")
 
-	playlistTracks, err := getAllPlaylistSongs(user)
+		playlistTracks, err := getAllPlaylistSongs(user, options, progress)
 
-	if err != nil {
-		logger.WithUser(user.GetUserId()).Error("Failed to fetch all spotify playlist tracks for user ", err)
-		return nil, err
+		if err != nil {
+			logger.WithUser(user.GetUserId()).Error("Failed to fetch all spotify playlist tracks for user ", err)
+			return nil, err
+		}
+
+		logger.WithUser(user.GetUserId()).Info("Successfully fetched all spotify playlist tracks for user")
+
+		allTracks = append(allTracks, playlistTracks...)
 	}
 
-	logger.WithUser(user.GetUserId()).Info("Successfully fetched all spotify playlist tracks for user")
+	// Get the top tracks
+	if options.Sources.Includes(clientcommon.LibrarySourceTopTracks) {
+		logger.WithUser(user.GetUserId()).Info("Fetching spotify top tracks for user")
 
-	// Merge all the songs here
-	allTracks := make([]*spotify.FullTrack, 0)
-	allTracks = append(allTracks, savedTracks...)
-	allTracks = append(allTracks, playlistTracks...)
+		topTracks, err := getTopTracks(user, progress)
+
+		// the source is optional, the room is still processed with the rest of the library
+		if isMissingScopeError(err) {
+			logger.WithUser(user.GetUserId()).Warningf("Skipped spotify top tracks for user, the token of the user "+
+				"does not have the scope to read them, the user needs to log in again %v", err)
+			topTracks = []*spotify.FullTrack{}
+			err = nil
+		}
+
+		if err != nil {
+			logger.WithUser(user.GetUserId()).Error("Failed to fetch spotify top tracks for user ", err)
+			return nil, err
+		}
+
+		logger.WithUser(user.GetUserId()).Info("Successfully fetched spotify top tracks for user")
+
+		allTracks = append(allTracks,
+			clientcommon.SetLibrarySource(ToTracks(topTracks), clientcommon.LibrarySourceTopTracks)...)
+	}
+
+	// Get the recently played tracks
+	if options.Sources.Includes(clientcommon.LibrarySourceRecentlyPlayed) {
+		logger.WithUser(user.GetUserId()).Info("Fetching spotify recently played tracks for user")
+
+		recentTracks, err := getRecentlyPlayedTracks(user, progress)
+
+		// the source is optional, the room is still processed with the rest of the library
+		if isMissingScopeError(err) {
+			logger.WithUser(user.GetUserId()).Warningf("Skipped spotify recently played tracks for user, the token of the user "+
+				"does not have the scope to read them, the user needs to log in again %v", err)
+			recentTracks = []*spotify.FullTrack{}
+			err = nil
+		}
+
+		if err != nil {
+			logger.WithUser(user.GetUserId()).Error("Failed to fetch spotify recently played tracks for user ", err)
+			return nil, err
+		}
+
+		logger.WithUser(user.GetUserId()).Info("Successfully fetched spotify recently played tracks for user")
+
+		allTracks = append(allTracks,
+			clientcommon.SetLibrarySource(ToTracks(recentTracks), clientcommon.LibrarySourceRecentlyPlayed)...)
+	}
 
 	return allTracks, nil
 }
 
-// This method gets all the songs "liked" by a user
-func getSavedSongs(user *clientcommon.User) ([]*spotify.FullTrack, error) {
+// The scopes to read the top and recently played tracks were added later, spotify forbids reading them with the
+// tokens of the users who logged in before
+func isMissingScopeError(err error) bool {
+	spotifyError, ok := err.(spotify.Error)
+	return ok && spotifyError.Status == http.StatusForbidden
+}
+
+// This method gets all the songs "liked" by a user, with the time he liked them
+func getSavedSongs(user *clientcommon.User, progress clientcommon.ProgressHook) ([]*clientcommon.Track, error) {
 	client := user.SpotifyClient
 
-	allTracks := make([]*spotify.FullTrack, 0)
-	savedTrackPage, err := client.CurrentUsersTracksOpt(&spotify.Options{Limit: &maxPerPage})
+	allTracks := make([]*clientcommon.Track, 0)
+	savedTrackPage, err := client.CurrentUsersTracksOpt(&spotify.Options{Limit: &maxPerPage, Country: &relinkingMarket})
 
 	clientcommon.SendRequestMetric(datadog.SpotifyProvider, datadog.RequestTypeSavedSongs, true, err)
 
@@ -68,12 +136,15 @@ func getSavedSongs(user *clientcommon.User) ([]*spotify.FullTrack, error) {
 	for page := 1; ; page++ {
 		logger.WithUser(user.GetUserId()).Debugf("Page %d has %d tracks for user", page, len(savedTrackPage.Tracks))
 
-		// Transform all the SavedTrack into FullTrack and add them to the list
+		// Transform all the SavedTrack into tracks and add them to the list
 		for _, savedTrack := range savedTrackPage.Tracks {
 			fullTrack := savedTrack.FullTrack
-			allTracks = append(allTracks, &fullTrack)
+			allTracks = append(allTracks, toLibraryTrack(&fullTrack, savedTrack.AddedAt))
 		}
 
+		progress.Report(clientcommon.ProgressStepPageFetched, clientcommon.SourceSavedSongs, len(allTracks),
+			savedTrackPage.Total)
+
 		time.Sleep(maxWaitBetweenCalls)
 
 		// Go to next page
@@ -97,11 +168,53 @@ func getSavedSongs(user *clientcommon.User) ([]*spotify.FullTrack, error) {
 	return allTracks, nil
 }
 
-// This method gets all the songs from the playlists of the user
-func getAllPlaylistSongs(user *clientcommon.User) ([]*spotify.FullTrack, error) {
+// This method gets all the songs from the playlists of the user included by the options, with the source of their
+// playlist
+func getAllPlaylistSongs(user *clientcommon.User, options *clientcommon.LibraryOptions,
+	progress clientcommon.ProgressHook) ([]*clientcommon.Track, error) {
+	allTracks := make([]*clientcommon.Track, 0)
+
+	playlists, err := getPlaylists(user, progress)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// For each playlist included, get the associated tracks
+	for _, playlist := range playlists {
+		if !options.IncludesPlaylist(playlist) {
+			logger.WithUser(user.GetUserId()).Debugf("Skipped playlist %s as it is not included", playlist.Id)
+			continue
+		}
+
+		tracks, err := getSongsForPlaylist(user, playlist.Id)
+
+		if err != nil {
+			return nil, err
+		}
+
+		logger.WithUser(user.GetUserId()).Debugf("Got %d tracks from playlist %s for user", len(tracks), playlist.Id)
+
+		allTracks = append(allTracks,
+			clientcommon.SetLibrarySource(tracks, options.GetPlaylistSource(playlist))...)
+
+		progress.Report(clientcommon.ProgressStepPageFetched, clientcommon.SourcePlaylistSongs, len(allTracks), 0)
+	}
+
+	logger.WithUser(user.GetUserId()).Infof("Found %d playlist tracks for user", len(allTracks))
+
+	return allTracks, nil
+}
+
+func GetPlaylists(user *clientcommon.User) ([]*clientcommon.LibraryPlaylist, error) {
+	return getPlaylists(user, nil)
+}
+
+// This method gets all the playlists of the user, the ones he created and the ones he "liked"
+func getPlaylists(user *clientcommon.User, progress clientcommon.ProgressHook) ([]*clientcommon.LibraryPlaylist, error) {
 	client := user.SpotifyClient
 
-	allTracks := make([]*spotify.FullTrack, 0)
+	playlists := make([]*clientcommon.LibraryPlaylist, 0)
 
 	simplePlaylistPage, err := client.CurrentUsersPlaylistsOpt(&spotify.Options{Limit: &maxPerPage})
 
@@ -117,33 +230,13 @@ func getAllPlaylistSongs(user *clientcommon.User) ([]*spotify.FullTrack, error)
 	for page := 1; ; page++ {
 		logger.WithUser(user.GetUserId()).Debugf("Page %d has %d playlists for user", page, len(simplePlaylistPage.Playlists))
 
-		// For each playlist, get the associated tracks
 		for _, simplePlaylist := range simplePlaylistPage.Playlists {
-
-			// If the playlist is owned by someone else and was just "liked" by the user, do not include it
-			if simplePlaylist.Owner.ID != user.GetId() {
-				continue
-			}
-
-			// FIXME: be more robust to this later, as in case the playlist is renamed, it will still count
-			//    although we could say if the user renamed the playlists he want to keep the songs for it
-			// If the playlist has the name credits and was created by us, we don't include it
-			if strings.Contains(simplePlaylist.Name, clientcommon.NameCredits) {
-				continue
-			}
-
-			playlistId := simplePlaylist.ID.String()
-			tracks, err := getSongsForPlaylist(user, playlistId)
-
-			if err != nil {
-				return nil, err
-			}
-
-			logger.WithUser(user.GetUserId()).Debugf("Got %d tracks from playlist %s for user", len(tracks), playlistId)
-
-			allTracks = append(allTracks, tracks...)
+			playlists = append(playlists, toLibraryPlaylist(simplePlaylist, user))
 		}
 
+		progress.Report(clientcommon.ProgressStepPageFetched, clientcommon.SourcePlaylists, len(playlists),
+			simplePlaylistPage.Total)
+
 		time.Sleep(maxWaitBetweenCalls)
 
 		// Go to next page
@@ -162,16 +255,78 @@ func getAllPlaylistSongs(user *clientcommon.User) ([]*spotify.FullTrack, error)
 		}
 	}
 
-	logger.WithUser(user.GetUserId()).Infof("Found %d playlist tracks for user", len(allTracks))
+	return playlists, nil
+}
+
+// This method gets the tracks the user listened to the most, spotify only gives the first ones
+func getTopTracks(user *clientcommon.User, progress clientcommon.ProgressHook) ([]*spotify.FullTrack, error) {
+	client := user.SpotifyClient
+
+	allTracks := make([]*spotify.FullTrack, 0)
+	topTrackPage, err := client.CurrentUsersTopTracksOpt(&spotify.Options{Limit: &maxPerPage})
+
+	clientcommon.SendRequestMetric(datadog.SpotifyProvider, datadog.RequestTypeTopTracks, true, err)
+
+	if err != nil {
+		logger.WithUser(user.GetUserId()).Errorf("Failed to get top tracks for user %v", err)
+		return nil, err
+	}
+
+	for _, topTrack := range topTrackPage.Tracks {
+		fullTrack := topTrack
+		allTracks = append(allTracks, &fullTrack)
+	}
+
+	progress.Report(clientcommon.ProgressStepPageFetched, clientcommon.SourceTopTracks, len(allTracks),
+		len(allTracks))
+
+	logger.WithUser(user.GetUserId()).Infof("Found %d top tracks for user", len(allTracks))
 
 	return allTracks, nil
 }
 
-func getSongsForPlaylist(user *clientcommon.User, playlistId string) ([]*spotify.FullTrack, error) {
+// This method gets the tracks the user listened to lately, spotify only gives the last ones
+func getRecentlyPlayedTracks(user *clientcommon.User, progress clientcommon.ProgressHook) ([]*spotify.FullTrack, error) {
 	client := user.SpotifyClient
 
-	allTracks := make([]*spotify.FullTrack, 0)
-	playlistTrackPage, err := client.GetPlaylistTracksOpt(spotify.ID(playlistId), &spotify.Options{Limit: &maxPerPage}, "")
+	recentlyPlayedItems, err := client.PlayerRecentlyPlayedOpt(&spotify.RecentlyPlayedOptions{Limit: maxPerPage})
+
+	clientcommon.SendRequestMetric(datadog.SpotifyProvider, datadog.RequestTypeRecentlyPlayed, true, err)
+
+	if err != nil {
+		logger.WithUser(user.GetUserId()).Errorf("Failed to get recently played tracks for user %v", err)
+		return nil, err
+	}
+
+	// spotify only gives the simple tracks, which do not have the isrc, so we get the full tracks
+	trackIds := make([]spotify.ID, 0)
+
+	for _, recentlyPlayedItem := range recentlyPlayedItems {
+		trackIds = append(trackIds, recentlyPlayedItem.Track.ID)
+	}
+
+	allTracks, err := GetTracks(client, trackIds)
+
+	if err != nil {
+		logger.WithUser(user.GetUserId()).Errorf("Failed to get full recently played tracks for user %v", err)
+		return nil, err
+	}
+
+	progress.Report(clientcommon.ProgressStepPageFetched, clientcommon.SourceRecentlyPlayed, len(allTracks),
+		len(allTracks))
+
+	logger.WithUser(user.GetUserId()).Infof("Found %d recently played tracks for user", len(allTracks))
+
+	return allTracks, nil
+}
+
+// This method gets all the songs of a playlist, with the time they were added to it
+func getSongsForPlaylist(user *clientcommon.User, playlistId string) ([]*clientcommon.Track, error) {
+	client := user.SpotifyClient
+
+	allTracks := make([]*clientcommon.Track, 0)
+	playlistTrackPage, err := client.GetPlaylistTracksOpt(spotify.ID(playlistId),
+		&spotify.Options{Limit: &maxPerPage, Country: &relinkingMarket}, "")
 
 	clientcommon.SendRequestMetric(datadog.SpotifyProvider, datadog.RequestTypePlaylistSongs, true, err)
 
@@ -186,10 +341,10 @@ func getSongsForPlaylist(user *clientcommon.User, playlistId string) ([]*spotify
 		logger.WithUser(user.GetUserId()).Debugf("Page %d has %d tracks for playlist %s for user", page,
 			len(playlistTrackPage.Tracks), playlistId)
 
-		// Transform all the PlaylistTrack into FullTrack and add them to the list
+		// Transform all the PlaylistTrack into tracks and add them to the list
 		for _, playlistTrack := range playlistTrackPage.Tracks {
 			fullTrack := playlistTrack.Track
-			allTracks = append(allTracks, &fullTrack)
+			allTracks = append(allTracks, toLibraryTrack(&fullTrack, playlistTrack.AddedAt))
 		}
 
 		// TODO: remove this, we need rate limit in another way
@@ -238,19 +393,101 @@ func GetTracks(client *spotify.Client, spotifyIds []spotify.ID) ([]*spotify.Full
 	return allTracks, nil
 }
 
-func GetTrackForISRCs(user *clientcommon.User, isrcs []string) ([]*spotify.FullTrack, error) {
+// Find the spotify version of the tracks coming from other providers, so we can use them with spotify
+func ResolveTracks(tracks []*clientcommon.Track, progress clientcommon.ProgressHook) error {
+	tracksToResolve := make(map[string][]*clientcommon.Track)
+	isrcs := make([]string, 0)
+
+	for _, track := range tracks {
+		isrc, ok := clientcommon.GetTrackISRC(track)
+
+		if !ok {
+			continue
+		}
+
+		if _, ok := track.GetProviderId(clientcommon.SpotifyLoginType); ok {
+			continue
+		}
+
+		if _, ok := tracksToResolve[isrc]; !ok {
+			isrcs = append(isrcs, isrc)
+		}
+
+		tracksToResolve[isrc] = append(tracksToResolve[isrc], track)
+	}
+
+	if len(isrcs) == 0 {
+		return nil
+	}
+
+	spotifyTracks, err := getTrackForISRCs(isrcs, progress)
+
+	if err != nil {
+		return err
+	}
+
+	for _, spotifyTrack := range spotifyTracks {
+		isrc, _ := clientcommon.GetTrackISRC(spotifyTrack)
+
+		for _, track := range tracksToResolve[isrc] {
+			track.Merge(spotifyTrack)
+		}
+	}
+
+	logger.Logger.Infof("Resolved %d spotify tracks out of %d tracks to resolve", len(spotifyTracks), len(isrcs))
+
+	return nil
+}
+
+// Search the tracks with this name by this artist in the spotify catalog
+func SearchTracks(name string, artist string, limit int) ([]*clientcommon.Track, error) {
+	client, err := GetSpotifyGenericClient()
+
+	if err != nil {
+		return nil, err
+	}
+
+	// the quotes would end the fields of the query
+	query := fmt.Sprintf(`track:"%s" artist:"%s"`, strings.ReplaceAll(name, `"`, ""),
+		strings.ReplaceAll(artist, `"`, ""))
+	results, err := client.SearchOpt(query, spotify.SearchTypeTrack, &spotify.Options{Limit: &limit})
+
+	clientcommon.SendRequestMetric(datadog.SpotifyProvider, datadog.RequestTypeSearch, false, err)
+
+	if err != nil {
+		logger.Logger.Warningf("Failed to search tracks on spotify for query %s %v", query, err)
+		return nil, err
+	}
+
+	tracks := make([]*spotify.FullTrack, 0)
+
+	for _, result := range results.Tracks.Tracks {
+		track := result
+		tracks = append(tracks, &track)
+	}
+
+	// TODO: remove this, we need rate limit in another way
+	time.Sleep(maxWaitBetweenSearchCalls)
+
+	return ToTracks(tracks), nil
+}
+
+func getTrackForISRCs(isrcs []string, progress clientcommon.ProgressHook) ([]*clientcommon.Track, error) {
 	tracks := make([]*spotify.FullTrack, 0)
 
 	isrcMapping, err := mongoclient.GetIsrcmappings(isrcs)
 	tracksToSearch := make([]spotify.ID, 0)
+	newIsrcMapping := make([]mongoclient.IsrcMapping, 0)
 
 	if err != nil {
 		// if we have a mongo error, we continue normally
 		isrcMapping = make(map[string]string)
-		logger.WithUser(user.GetUserId()).Warning("Failed to get isrc mappings ", err)
+		logger.Logger.Warning("Failed to get isrc mappings ", err)
 	}
 
-	for _, isrc := range isrcs {
+	for i, isrc := range isrcs {
+		progress.Report(clientcommon.ProgressStepIsrcConverted, clientcommon.SourceCatalog, i, len(isrcs))
+
 		// if we already had the spotify id, we don't make the search call
 		if spotifyId, ok := isrcMapping[isrc]; ok {
 			tracksToSearch = append(tracksToSearch, spotify.ID(spotifyId))
@@ -270,12 +507,12 @@ func GetTrackForISRCs(user *clientcommon.User, isrcs []string) ([]*spotify.FullT
 		clientcommon.SendRequestMetric(datadog.SpotifyProvider, datadog.RequestTypeSearch, false, err)
 
 		if err != nil {
-			logger.WithUser(user.GetUserId()).Warning("Failed to query track by isrc on spotify ", err)
+			logger.Logger.Warning("Failed to query track by isrc on spotify ", err)
 			continue
 		}
 
 		if len(results.Tracks.Tracks) == 0 {
-			logger.WithUser(user.GetUserId()).Debugf("No track found on spotify for isrc: %s, " +
+			logger.Logger.Debugf("No track found on spotify for isrc: %s, " +
 				"retrying with country code", isrc)
 
 			// we retry the same search query, with country code
@@ -285,12 +522,12 @@ func GetTrackForISRCs(user *clientcommon.User, isrcs []string) ([]*spotify.FullT
 			clientcommon.SendRequestMetric(datadog.SpotifyProvider, datadog.RequestTypeSearch, false, err)
 
 			if err != nil {
-				logger.WithUser(user.GetUserId()).Warning("Failed to query track by isrc on spotify ", err)
+				logger.Logger.Warning("Failed to query track by isrc on spotify ", err)
 				continue
 			}
 
 			if len(results.Tracks.Tracks) == 0 {
-				logger.WithUser(user.GetUserId()).Warningf("No track found on spotify for isrc: %s", isrc)
+				logger.Logger.Warningf("No track found on spotify for isrc: %s", isrc)
 				continue
 			}
 		}
@@ -301,6 +538,7 @@ func GetTrackForISRCs(user *clientcommon.User, isrcs []string) ([]*spotify.FullT
 		track := trackResults[0]
 
 		tracks = append(tracks, &track)
+		newIsrcMapping = append(newIsrcMapping, mongoclient.IsrcMapping{Isrc: isrc, SpotifyId: track.ID.String()})
 
 		// TODO: remove this, we need rate limit in another way
 		time.Sleep(maxWaitBetweenSearchCalls)
@@ -316,18 +554,25 @@ func GetTrackForISRCs(user *clientcommon.User, isrcs []string) ([]*spotify.FullT
 	foundTracks, err := GetTracks(client, tracksToSearch)
 
 	if err != nil {
-		logger.WithUser(user.GetUserId()).Error("Failed to fetch spotify songs by Id ", err)
+		logger.Logger.Error("Failed to fetch spotify songs by Id ", err)
 		return nil, err
 	}
 
-	logger.WithUser(user.GetUserId()).Infof("Used ISRC cache for %d songs for a total of %d songs",
-		len(foundTracks), len(isrcs))
+	logger.Logger.Infof("Used ISRC cache for %d songs for a total of %d songs", len(foundTracks), len(isrcs))
 	tracks = append(tracks, foundTracks...)
 
-	logger.WithUser(user.GetUserId()).Infof(
-		"Converted %d apple music songs to %d spotify tracks",
-		len(isrcs),
-		len(tracks))
+	// keep a record of the new mappings found to be quicker next time
+	if len(newIsrcMapping) > 0 {
+		err = mongoclient.InsertIsrcMapping(newIsrcMapping)
+
+		if err != nil {
+			logger.Logger.Errorf("Failed to insert %d isrc mapping", len(newIsrcMapping))
+		}
+	}
+
+	progress.Report(clientcommon.ProgressStepIsrcConverted, clientcommon.SourceCatalog, len(isrcs), len(isrcs))
 
-	return tracks, nil
-}
\ No newline at end of file
+	logger.Logger.Infof("Converted %d isrcs to %d spotify tracks", len(isrcs), len(tracks))
+
+	return ToTracks(tracks), nil
+}
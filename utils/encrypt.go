@@ -1,16 +1,37 @@
 package utils
 
 import (
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"github.com/shared-spotify/logger"
+	"golang.org/x/crypto/hkdf"
+	"io"
 )
 
+// Encrypted data is stored in a versioned envelope:
+//   version (1 byte) | key id (4 bytes) | random nonce (12 bytes) | ciphertext
+// The version and key id are authenticated along with the ciphertext.
+//
+// Legacy data was sealed with a key derived from the md5 hex of the secret and an all zero nonce, so it always
+// starts with a zero byte. It can still be decrypted during the migration window, but is never produced anymore.
+
+const envelopeVersion = 1
+const legacyVersion = 0
+const keyIdSize = 4
+const keySize = 32 // AES-256
+
+var keyIdInfo = []byte("shared-spotify key id")
+var encryptionKeyInfo = []byte("shared-spotify token encryption v1")
+
 var encryptionError = errors.New("Encryption failed")
 var decryptionError = errors.New("Decryption failed")
+var unknownKeyError = errors.New("Decryption failed, data was encrypted with an unknown key")
 
 func CreateHash(key string) string {
 	hasher := md5.New()
@@ -18,47 +39,182 @@ func CreateHash(key string) string {
 	return hex.EncodeToString(hasher.Sum(nil))
 }
 
-func Encrypt(data []byte, encryptionKey string) ([]byte, error) {
-	block, _ := aes.NewCipher([]byte(CreateHash(encryptionKey)))
+type encryptionKey struct {
+	id        []byte
+	aead      cipher.AEAD
+	legacyGcm cipher.AEAD
+}
+
+// A keyring holds the current key used to encrypt, and the previous keys still accepted to decrypt, so the
+// secret can be rotated without losing what was encrypted before
+type Keyring struct {
+	current     *encryptionKey
+	keys        []*encryptionKey
+	allowLegacy bool
+}
 
-	gcm, err := cipher.NewGCM(block)
+func NewKeyring(currentSecret string, previousSecrets []string, allowLegacy bool) (*Keyring, error) {
+	current, err := newEncryptionKey(currentSecret)
 
 	if err != nil {
-		logger.Logger.Error("Encryption error ", err)
-		return nil, encryptionError
+		return nil, err
 	}
 
-	nonce := make([]byte, gcm.NonceSize())
-	ciphertext := gcm.Seal(nonce, nonce, data, nil)
+	keys := []*encryptionKey{current}
+
+	for _, secret := range previousSecrets {
+		key, err := newEncryptionKey(secret)
 
-	return ciphertext, nil
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	return &Keyring{current, keys, allowLegacy}, nil
 }
 
-func Decrypt(data []byte, encryptionKey string) ([]byte, error) {
-	key := []byte(CreateHash(encryptionKey))
+func newEncryptionKey(secret string) (*encryptionKey, error) {
+	id := make([]byte, keyIdSize)
+	key := make([]byte, keySize)
+
+	if _, err := io.ReadFull(hkdf.New(sha256.New, []byte(secret), nil, keyIdInfo), id); err != nil {
+		return nil, err
+	}
+
+	if _, err := io.ReadFull(hkdf.New(sha256.New, []byte(secret), nil, encryptionKeyInfo), key); err != nil {
+		return nil, err
+	}
 
 	block, err := aes.NewCipher(key)
 
 	if err != nil {
-		logger.Logger.Error("Decryption error ", err)
-		return nil, decryptionError
+		return nil, err
 	}
 
-	gcm, err := cipher.NewGCM(block)
+	aead, err := cipher.NewGCM(block)
 
 	if err != nil {
-		logger.Logger.Error("Decryption error ", err)
-		return nil, decryptionError
+		return nil, err
+	}
+
+	legacyBlock, err := aes.NewCipher([]byte(CreateHash(secret)))
+
+	if err != nil {
+		return nil, err
 	}
 
-	nonceSize := gcm.NonceSize()
-	nonce, ciphertext := data[:nonceSize], data[nonceSize:]
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	legacyGcm, err := cipher.NewGCM(legacyBlock)
 
 	if err != nil {
-		logger.Logger.Error("Decryption error ", err)
+		return nil, err
+	}
+
+	return &encryptionKey{id, aead, legacyGcm}, nil
+}
+
+func (keyring *Keyring) Encrypt(data []byte) ([]byte, error) {
+	key := keyring.current
+
+	header := append([]byte{envelopeVersion}, key.id...)
+	nonce := make([]byte, key.aead.NonceSize())
+
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		logger.Logger.Error("Encryption error, failed to generate nonce ", err)
+		return nil, encryptionError
+	}
+
+	envelope := append(header, nonce...)
+
+	return key.aead.Seal(envelope, nonce, data, header), nil
+}
+
+func (keyring *Keyring) Decrypt(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, decryptionError
+	}
+
+	switch data[0] {
+
+	case envelopeVersion:
+		return keyring.decryptEnvelope(data)
+
+	case legacyVersion:
+		if !keyring.allowLegacy {
+			logger.Logger.Error("Decryption error, legacy encrypted data is not accepted anymore")
+			return nil, decryptionError
+		}
+
+		return keyring.decryptLegacy(data)
+
+	default:
+		logger.Logger.Errorf("Decryption error, unknown envelope version %d", data[0])
+		return nil, decryptionError
+	}
+}
+
+// Returns true if the data was encrypted with the current key and format, otherwise it should be encrypted again
+func (keyring *Keyring) IsCurrent(data []byte) bool {
+	headerSize := 1 + keyIdSize
+
+	return len(data) > headerSize &&
+		data[0] == envelopeVersion &&
+		bytes.Equal(data[1:headerSize], keyring.current.id)
+}
+
+func (keyring *Keyring) decryptEnvelope(data []byte) ([]byte, error) {
+	headerSize := 1 + keyIdSize
+
+	if len(data) < headerSize {
 		return nil, decryptionError
 	}
 
-	return plaintext, nil
+	header, keyId := data[:headerSize], data[1:headerSize]
+
+	for _, key := range keyring.keys {
+		if !bytes.Equal(key.id, keyId) {
+			continue
+		}
+
+		nonceSize := key.aead.NonceSize()
+
+		if len(data) < headerSize+nonceSize {
+			return nil, decryptionError
+		}
+
+		nonce, ciphertext := data[headerSize:headerSize+nonceSize], data[headerSize+nonceSize:]
+		plaintext, err := key.aead.Open(nil, nonce, ciphertext, header)
+
+		if err != nil {
+			logger.Logger.Error("Decryption error ", err)
+			return nil, decryptionError
+		}
+
+		return plaintext, nil
+	}
+
+	logger.Logger.Error(unknownKeyError)
+	return nil, unknownKeyError
+}
+
+// Legacy data does not say which key was used, so we try all of them
+func (keyring *Keyring) decryptLegacy(data []byte) ([]byte, error) {
+	for _, key := range keyring.keys {
+		nonceSize := key.legacyGcm.NonceSize()
+
+		if len(data) < nonceSize {
+			return nil, decryptionError
+		}
+
+		nonce, ciphertext := data[:nonceSize], data[nonceSize:]
+		plaintext, err := key.legacyGcm.Open(nil, nonce, ciphertext, nil)
+
+		if err == nil {
+			return plaintext, nil
+		}
+	}
+
+	logger.Logger.Error("Decryption error, legacy data could not be decrypted with any key")
+	return nil, decryptionError
 }
@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"testing"
+)
+
+// Seals the data the way it was before the envelope, with the md5 hex of the secret and an all zero nonce
+func encryptLegacy(t *testing.T, secret string, data []byte) []byte {
+	block, err := aes.NewCipher([]byte(CreateHash(secret)))
+
+	if err != nil {
+		t.Fatalf("Failed to create legacy cipher %v", err)
+	}
+
+	gcm, err := cipher.NewGCM(block)
+
+	if err != nil {
+		t.Fatalf("Failed to create legacy gcm %v", err)
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+
+	return gcm.Seal(nonce, nonce, data, nil)
+}
+
+func encryptWith(t *testing.T, secret string, data []byte) []byte {
+	keyring, err := NewKeyring(secret, nil, false)
+
+	if err != nil {
+		t.Fatalf("Failed to create keyring %v", err)
+	}
+
+	encrypted, err := keyring.Encrypt(data)
+
+	if err != nil {
+		t.Fatalf("Failed to encrypt %v", err)
+	}
+
+	return encrypted
+}
+
+func TestKeyringDecrypt(t *testing.T) {
+	data := []byte("token")
+
+	tamperedHeader := encryptWith(t, "current", data)
+	tamperedHeader[1] ^= 0xff
+
+	tamperedCiphertext := encryptWith(t, "current", data)
+	tamperedCiphertext[len(tamperedCiphertext)-1] ^= 0xff
+
+	tests := []struct {
+		name        string
+		encrypted   []byte
+		allowLegacy bool
+		expectError error
+		isCurrent   bool
+	}{
+		{"current key", encryptWith(t, "current", data), false, nil, true},
+		{"previous key", encryptWith(t, "previous", data), false, nil, false},
+		{"unknown key", encryptWith(t, "unknown", data), false, unknownKeyError, false},
+		{"key id changed", tamperedHeader, false, unknownKeyError, false},
+		{"ciphertext changed", tamperedCiphertext, false, decryptionError, true},
+		{"legacy allowed", encryptLegacy(t, "current", data), true, nil, false},
+		{"legacy with previous key", encryptLegacy(t, "previous", data), true, nil, false},
+		{"legacy not allowed", encryptLegacy(t, "current", data), false, decryptionError, false},
+		{"legacy unknown key", encryptLegacy(t, "unknown", data), true, decryptionError, false},
+		{"empty", []byte{}, true, decryptionError, false},
+		{"unknown version", []byte{2, 1, 2, 3, 4, 5}, true, decryptionError, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			keyring, err := NewKeyring("current", []string{"previous"}, test.allowLegacy)
+
+			if err != nil {
+				t.Fatalf("Failed to create keyring %v", err)
+			}
+
+			if isCurrent := keyring.IsCurrent(test.encrypted); isCurrent != test.isCurrent {
+				t.Errorf("Expected is current to be %t, got %t", test.isCurrent, isCurrent)
+			}
+
+			decrypted, err := keyring.Decrypt(test.encrypted)
+
+			if err != test.expectError {
+				t.Fatalf("Expected error %v, got %v", test.expectError, err)
+			}
+
+			if err == nil && string(decrypted) != string(data) {
+				t.Errorf("Expected %s, got %s", data, decrypted)
+			}
+		})
+	}
+}
+
+func TestKeyringEncryptUsesRandomNonces(t *testing.T) {
+	keyring, err := NewKeyring("current", nil, false)
+
+	if err != nil {
+		t.Fatalf("Failed to create keyring %v", err)
+	}
+
+	encrypted, _ := keyring.Encrypt([]byte("token"))
+	otherEncrypted, _ := keyring.Encrypt([]byte("token"))
+
+	if string(encrypted) == string(otherEncrypted) {
+		t.Error("Expected the same data to be encrypted differently each time")
+	}
+}
@@ -0,0 +1,219 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"github.com/shared-spotify/logger"
+	"github.com/shared-spotify/mongoclient"
+	"github.com/shared-spotify/utils"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Workers take the jobs from the persistent queue and run the handler registered for their type
+//
+// While a job runs, the worker sends heartbeats to keep its lease. If the worker is stopped, the jobs it was running
+// are released so another worker can pick them up straight away. If a job is cancelled, its context is cancelled and
+// the job is marked with CancelRequested.
+//
+// A job whose lease expired on its last attempt never gets failed by its worker, the workers mark it as dead and
+// call the dead handler registered for its type.
+
+const pollInterval = 5 * time.Second
+const leaseDuration = 2 * time.Minute
+const heartbeatInterval = 30 * time.Second
+const defaultConcurrency = 4
+
+var Concurrency = getConcurrency()
+
+// Runs a job, returning an error makes the job be retried later
+type Handler func(job *mongoclient.Job, ctx context.Context) error
+
+// Called when a job is dead without its handler knowing, so what the job was doing can be marked as failed
+type DeadHandler func(job *mongoclient.Job, ctx context.Context)
+
+var handlers = make(map[string]Handler)
+var deadHandlers = make(map[string]DeadHandler)
+
+// Unique id of this worker process, used as the owner of the job leases
+var workerId = getWorkerId()
+
+var stopWorkers context.CancelFunc
+var workersStopped sync.WaitGroup
+
+func getConcurrency() int {
+	concurrency, err := strconv.Atoi(os.Getenv("WORKER_CONCURRENCY"))
+
+	if err != nil || concurrency <= 0 {
+		return defaultConcurrency
+	}
+
+	return concurrency
+}
+
+func getWorkerId() string {
+	hostname, err := os.Hostname()
+
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	return fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), utils.GenerateHash(8))
+}
+
+func RegisterHandler(jobType string, handler Handler) {
+	handlers[jobType] = handler
+}
+
+func RegisterDeadHandler(jobType string, handler DeadHandler) {
+	deadHandlers[jobType] = handler
+}
+
+// Start the workers for all the job types registered
+func Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	stopWorkers = cancel
+
+	for jobType, handler := range handlers {
+		for i := 0; i < Concurrency; i++ {
+			workersStopped.Add(1)
+			go run(jobType, handler, ctx)
+		}
+
+		workersStopped.Add(1)
+		go buryExpiredJobs(jobType, ctx)
+
+		logger.Logger.Warningf("Started %d workers for jobs %s with id %s", Concurrency, jobType, workerId)
+	}
+}
+
+// Stop all the workers and wait for them to release their jobs
+func Stop() {
+	if stopWorkers == nil {
+		return
+	}
+
+	stopWorkers()
+	workersStopped.Wait()
+
+	logger.Logger.Warning("All workers stopped")
+}
+
+func run(jobType string, handler Handler, ctx context.Context) {
+	defer workersStopped.Done()
+
+	for {
+		job, err := mongoclient.AcquireJob(jobType, workerId, leaseDuration, context.Background())
+
+		if err == nil && job != nil {
+			runJob(job, handler, ctx)
+			continue
+		}
+
+		// nothing to do, we wait before looking for new jobs
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// The leases are checked as often as they expire
+func buryExpiredJobs(jobType string, ctx context.Context) {
+	defer workersStopped.Done()
+
+	ticker := time.NewTicker(leaseDuration)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for {
+			job, err := mongoclient.BuryExpiredJob(jobType, context.Background())
+
+			if err != nil || job == nil {
+				break
+			}
+
+			if deadHandler, ok := deadHandlers[jobType]; ok {
+				deadHandler(job, context.Background())
+			}
+		}
+	}
+}
+
+func runJob(job *mongoclient.Job, handler Handler, workerCtx context.Context) {
+	jobCtx, cancel := context.WithCancel(workerCtx)
+	defer cancel()
+
+	// keep the lease while the job runs, and stop the job if another worker took it
+	heartbeatDone := make(chan struct{})
+	defer close(heartbeatDone)
+
+	go func() {
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-heartbeatDone:
+				return
+			case <-ticker.C:
+				cancelRequested, err := mongoclient.HeartbeatJob(job, leaseDuration, context.Background())
+
+				if err == mongoclient.ErrJobLeaseLost {
+					cancel()
+					return
+				}
+
+				// the handler checks the job to know it was cancelled and not interrupted
+				if cancelRequested {
+					job.CancelRequested = true
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	err := runHandler(job, handler, jobCtx)
+
+	if job.CancelRequested {
+		_ = mongoclient.CancelJob(job, context.Background())
+		return
+	}
+
+	if err == nil {
+		_ = mongoclient.CompleteJob(job, context.Background())
+		return
+	}
+
+	// the worker is shutting down, we give the job back to the queue
+	if workerCtx.Err() != nil {
+		_ = mongoclient.ReleaseJob(job, context.Background())
+		return
+	}
+
+	_ = mongoclient.FailJob(job, err, context.Background())
+}
+
+func runHandler(job *mongoclient.Job, handler Handler, ctx context.Context) (err error) {
+	// Recovery so a job cannot crash the worker
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Logger.Errorf("An unknown error happened while running job %s - error %v \n%s",
+				job.Id, r, string(debug.Stack()))
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+
+	return handler(job, ctx)
+}